@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"novella/internal/model"
+	"novella/internal/store"
+)
+
+const usage = `usage: novella-admin <command> [flags]
+
+commands:
+  backup   -out FILE   write a consistent snapshot of the live database
+  restore  -in FILE    replace the database with a snapshot (stop the server first)
+  export   -dir DIR    write users, novels, chapters, comments and bookmarks as NDJSON
+  rotate-key -new-key-file FILE | -decrypt
+                       re-encrypt the JSON database (stop the server first)
+  set-role -email EMAIL -role ROLE
+                       make a user a reader, author, moderator or admin, e.g. to
+                       appoint the first admin (json driver: stop the server first)
+
+Every command accepts -driver and -db, defaulting to DB_DRIVER and DB_PATH.
+The current encryption key is read from DB_ENCRYPTION_KEY or
+DB_ENCRYPTION_KEY_FILE.
+`
+
+type database interface {
+	Backup(path string) error
+	Dataset() (store.Dataset, error)
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	driver := fs.String("driver", os.Getenv("DB_DRIVER"), "database driver: json or sqlite")
+	dbPath := fs.String("db", os.Getenv("DB_PATH"), "database path")
+
+	key, err := store.KeyFromEnv()
+	if err != nil {
+		log.Fatalf("invalid encryption key: %v", err)
+	}
+
+	switch cmd {
+	case "backup":
+		out := fs.String("out", "", "snapshot file to write")
+		fs.Parse(os.Args[2:])
+		required(fs, "out", *out)
+		err = backup(resolve(driver, dbPath), *dbPath, key, *out)
+	case "restore":
+		in := fs.String("in", "", "snapshot file to restore")
+		fs.Parse(os.Args[2:])
+		required(fs, "in", *in)
+		err = restore(resolve(driver, dbPath), *dbPath, key, *in)
+	case "export":
+		dir := fs.String("dir", "", "directory for the NDJSON files")
+		fs.Parse(os.Args[2:])
+		required(fs, "dir", *dir)
+		err = export(resolve(driver, dbPath), *dbPath, key, *dir)
+	case "rotate-key":
+		newKeyFile := fs.String("new-key-file", "", "file holding the new key (base64 or hex)")
+		decrypt := fs.Bool("decrypt", false, "store the database in plaintext")
+		fs.Parse(os.Args[2:])
+		if *decrypt == (*newKeyFile != "") {
+			fmt.Fprintln(os.Stderr, "exactly one of -new-key-file and -decrypt is required")
+			fs.Usage()
+			os.Exit(2)
+		}
+		err = rotateKey(resolve(driver, dbPath), *dbPath, key, *newKeyFile)
+	case "set-role":
+		email := fs.String("email", "", "email address of the user")
+		role := fs.String("role", "", "reader, author, moderator or admin")
+		fs.Parse(os.Args[2:])
+		required(fs, "email", *email)
+		required(fs, "role", *role)
+		err = setRole(resolve(driver, dbPath), *dbPath, key, *email, model.Role(*role))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", cmd, err)
+	}
+}
+
+func required(fs *flag.FlagSet, name, value string) {
+	if value == "" {
+		fmt.Fprintf(os.Stderr, "-%s is required\n", name)
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// resolve applies the same defaults as cmd/server.
+func resolve(driver, dbPath *string) string {
+	if *driver == "" {
+		*driver = "json"
+	}
+	if *dbPath == "" {
+		switch *driver {
+		case "sqlite":
+			*dbPath = "./data/novella.sqlite"
+		default:
+			*dbPath = "./data/novella.db.json"
+		}
+	}
+	return *driver
+}
+
+// open returns a read view of the database that is safe to take while the
+// server is running: the JSON store is loaded without touching its files and
+// SQLite serves reads from a snapshot.
+func open(driver, dbPath string, key []byte) (database, func(), error) {
+	switch driver {
+	case "json":
+		s, err := store.Load(dbPath, store.WithEncryptionKey(key))
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, func() {}, nil
+	case "sqlite":
+		s, err := store.OpenSQLite(dbPath, store.WithEncryptionKey(key))
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, func() { s.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown driver %q (want json or sqlite)", driver)
+	}
+}
+
+func backup(driver, dbPath string, key []byte, out string) error {
+	db, done, err := open(driver, dbPath, key)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if err := db.Backup(out); err != nil {
+		return err
+	}
+	log.Printf("wrote %s backup of %s to %s", driver, dbPath, out)
+	return nil
+}
+
+func restore(driver, dbPath string, key []byte, in string) error {
+	var err error
+	switch driver {
+	case "json":
+		err = store.RestoreJSON(dbPath, in, store.WithEncryptionKey(key))
+	case "sqlite":
+		if key != nil {
+			return store.ErrEncryptionUnsupported
+		}
+		err = store.RestoreSQLite(dbPath, in)
+	default:
+		err = fmt.Errorf("unknown driver %q (want json or sqlite)", driver)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("restored %s from %s; replaced files were renamed to *.pre-restore", dbPath, in)
+	return nil
+}
+
+func export(driver, dbPath string, key []byte, dir string) error {
+	db, done, err := open(driver, dbPath, key)
+	if err != nil {
+		return err
+	}
+	defer done()
+	d, err := db.Dataset()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	if err := writeNDJSON(dir, "users", d.Users); err != nil {
+		return err
+	}
+	if err := writeNDJSON(dir, "novels", d.Novels); err != nil {
+		return err
+	}
+	if err := writeNDJSON(dir, "chapters", d.Chapters); err != nil {
+		return err
+	}
+	if err := writeNDJSON(dir, "revisions", d.Revisions); err != nil {
+		return err
+	}
+	if err := writeNDJSON(dir, "comments", d.Comments); err != nil {
+		return err
+	}
+	return writeNDJSON(dir, "bookmarks", d.Bookmarks)
+}
+
+func rotateKey(driver, dbPath string, oldKey []byte, newKeyFile string) error {
+	if driver != "json" {
+		return store.ErrEncryptionUnsupported
+	}
+	var newKey []byte
+	if newKeyFile != "" {
+		var err error
+		if newKey, err = store.ReadKeyFile(newKeyFile); err != nil {
+			return err
+		}
+	}
+	if err := store.RotateKey(dbPath, oldKey, newKey); err != nil {
+		return err
+	}
+	if newKey == nil {
+		log.Printf("%s is now stored in plaintext", dbPath)
+	} else {
+		log.Printf("re-encrypted %s; point DB_ENCRYPTION_KEY_FILE at %s before restarting", dbPath, newKeyFile)
+	}
+	return nil
+}
+
+func setRole(driver, dbPath string, key []byte, email string, role model.Role) error {
+	var db interface {
+		AssignRole(email string, role model.Role) (model.User, error)
+		Close() error
+	}
+	var err error
+	switch driver {
+	case "json":
+		db, err = store.NewWithDB(dbPath, store.WithEncryptionKey(key))
+	case "sqlite":
+		db, err = store.OpenSQLite(dbPath, store.WithEncryptionKey(key))
+	default:
+		err = fmt.Errorf("unknown driver %q (want json or sqlite)", driver)
+	}
+	if err != nil {
+		return err
+	}
+	u, err := db.AssignRole(email, role)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("%s (user %d) is now %s", u.Email, u.ID, u.Role)
+	return nil
+}
+
+func writeNDJSON[T any](dir, entity string, rows []T) error {
+	path := filepath.Join(dir, entity+".ndjson")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("%s: %d records", path, len(rows))
+	return nil
+}
@@ -0,0 +1,285 @@
+// Command oidc-stub is a minimal OpenID Connect provider for trying out and
+// testing "sign in with" locally. It approves every authorization request:
+// the user is whoever the email parameter (or the form it shows) names.
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const codeTTL = time.Minute
+
+type grant struct {
+	clientID      string
+	redirectURI   string
+	challenge     string
+	nonce         string
+	email         string
+	emailVerified bool
+	expiresAt     time.Time
+}
+
+type stub struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	alg          string
+	rsaKey       *rsa.PrivateKey
+	ecKey        *ecdsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9999", "listen address")
+	issuer := flag.String("issuer", "", "issuer URL (default http://<addr>)")
+	clientID := flag.String("client-id", "novella-dev", "the only client ID accepted")
+	clientSecret := flag.String("client-secret", "", "client secret; empty accepts public clients")
+	alg := flag.String("alg", "RS256", "ID token signing algorithm: RS256 or ES256")
+	flag.Parse()
+
+	s := &stub{
+		issuer:       strings.TrimRight(*issuer, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		alg:          *alg,
+		codes:        make(map[string]grant),
+	}
+	if s.issuer == "" {
+		s.issuer = "http://" + *addr
+	}
+	var err error
+	switch s.alg {
+	case "RS256":
+		s.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		s.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		log.Fatalf("unsupported -alg %q", s.alg)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("GET /authorize", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	log.Printf("oidc stub for client %q listening on %s (issuer %s)", s.clientID, *addr, s.issuer)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func (s *stub) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{s.alg},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *stub) jwks(w http.ResponseWriter, _ *http.Request) {
+	enc := base64.RawURLEncoding.EncodeToString
+	key := map[string]string{"kid": "stub-1", "use": "sig", "alg": s.alg}
+	if s.rsaKey != nil {
+		key["kty"] = "RSA"
+		key["n"] = enc(s.rsaKey.N.Bytes())
+		key["e"] = enc(big.NewInt(int64(s.rsaKey.E)).Bytes())
+	} else {
+		key["kty"] = "EC"
+		key["crv"] = "P-256"
+		key["x"] = enc(s.ecKey.X.FillBytes(make([]byte, 32)))
+		key["y"] = enc(s.ecKey.Y.FillBytes(make([]byte, 32)))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []any{key}})
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!doctype html>
+<title>OIDC stub</title>
+<form method="get" action="/authorize">
+{{range $k, $v := .}}{{range $v}}<input type="hidden" name="{{$k}}" value="{{.}}">{{end}}{{end}}
+<label>Sign in as <input name="email" type="email" required autofocus></label>
+<label><input type="checkbox" name="email_verified" value="true" checked> email verified</label>
+<button>Continue</button>
+</form>
+`))
+
+func (s *stub) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect := q.Get("redirect_uri")
+	switch {
+	case q.Get("response_type") != "code":
+		http.Error(w, "response_type must be code", http.StatusBadRequest)
+		return
+	case q.Get("client_id") != s.clientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case redirect == "":
+		http.Error(w, "redirect_uri is required", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	email := q.Get("email")
+	if email == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		loginForm.Execute(w, q)
+		return
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = grant{
+		clientID:      s.clientID,
+		redirectURI:   redirect,
+		challenge:     q.Get("code_challenge"),
+		nonce:         q.Get("nonce"),
+		email:         email,
+		emailVerified: q.Get("email_verified") != "false",
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	s.mu.Unlock()
+
+	u, err := url.Parse(redirect)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	v := u.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	u.RawQuery = v.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (s *stub) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.clientID || (s.clientSecret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s.clientSecret)) != 1) {
+		tokenError(w, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok || time.Now().After(g.expiresAt):
+		tokenError(w, "invalid_grant")
+		return
+	case g.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, "invalid_grant")
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	idToken, err := s.sign(map[string]any{
+		"iss":            s.issuer,
+		"sub":            "stub|" + strings.ToLower(g.email),
+		"aud":            g.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.email,
+		"email_verified": g.emailVerified,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (s *stub) sign(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": s.alg, "kid": "stub-1", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	signed := enc(header) + "." + enc(payload)
+	sum := sha256.Sum256([]byte(signed))
+	var sig []byte
+	if s.rsaKey != nil {
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, s.rsaKey, crypto.SHA256, sum[:]); err != nil {
+			return "", err
+		}
+	} else {
+		r, ss, err := ecdsa.Sign(rand.Reader, s.ecKey, sum[:])
+		if err != nil {
+			return "", err
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), ss.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + enc(sig), nil
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
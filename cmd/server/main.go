@@ -1,11 +1,16 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"novella/internal/api"
+	"novella/internal/mail"
+	"novella/internal/oidc"
+	"novella/internal/schedule"
 	"novella/internal/store"
 )
 
@@ -14,20 +19,142 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
+	driver := os.Getenv("DB_DRIVER")
+	if driver == "" {
+		driver = "json"
+	}
 	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data/novella.db.json"
+	key, err := store.KeyFromEnv()
+	if err != nil {
+		log.Fatalf("invalid encryption key: %v", err)
+	}
+	var opts []store.Option
+	if v := os.Getenv("SESSION_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid SESSION_TTL: %v", err)
+		}
+		opts = append(opts, store.WithSessionTTL(ttl))
+	}
+	if v := os.Getenv("ACCESS_TOKEN_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid ACCESS_TOKEN_TTL: %v", err)
+		}
+		opts = append(opts, store.WithAccessTokenTTL(ttl))
 	}
 
-	s, err := store.NewWithDB(dbPath)
+	var s store.Backend
+	switch driver {
+	case "json":
+		if dbPath == "" {
+			dbPath = "./data/novella.db.json"
+		}
+		js, err := store.NewWithDB(dbPath, append(opts, store.WithEncryptionKey(key))...)
+		if err != nil {
+			log.Fatalf("failed to initialize store: %v", err)
+		}
+		s = js
+	case "sqlite":
+		if dbPath == "" {
+			dbPath = "./data/novella.sqlite"
+		}
+		// The key can only be for the JSON database being imported; SQLite
+		// databases are not encrypted.
+		src := os.Getenv("DB_IMPORT_JSON")
+		if key != nil && src == "" {
+			log.Fatalf("encryption at rest is only supported by the json driver")
+		}
+		ss, err := store.OpenSQLite(dbPath, opts...)
+		if err != nil {
+			log.Fatalf("failed to initialize store: %v", err)
+		}
+		if src != "" {
+			if err := importJSON(ss, src, key); err != nil {
+				log.Fatalf("failed to import %s: %v", src, err)
+			}
+		}
+		s = ss
+	default:
+		log.Fatalf("unknown DB_DRIVER %q (want json or sqlite)", driver)
+	}
+	defer s.Close()
+	go sweepSessions(s, sessionSweepInterval)
+
+	mailer, err := mail.FromEnv()
 	if err != nil {
-		log.Fatalf("failed to initialize store: %v", err)
+		log.Fatalf("invalid mail configuration: %v", err)
 	}
-	server := api.New(s)
+	dispatcher := mail.NewDispatcher(s, mailer)
+	go dispatcher.Run(mailPollInterval)
+	go schedule.New(s, schedule.LogEvent).Run(publishPollInterval)
+
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+	providers, err := oidc.ProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("invalid OIDC configuration: %v", err)
+	}
+	limits, err := api.ParseRateLimits(os.Getenv("RATE_LIMIT_DEFAULT"), os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		log.Fatalf("invalid rate limit configuration: %v", err)
+	}
+	server := api.New(s, api.Config{
+		PublicURL:      baseURL,
+		Mail:           dispatcher,
+		OIDC:           providers,
+		ClientIPHeader: os.Getenv("CLIENT_IP_HEADER"),
+		RateLimits:     limits,
+	})
 
 	addr := ":" + port
-	log.Printf("novella backend listening on %s (db: %s)", addr, dbPath)
+	log.Printf("novella backend listening on %s (%s db: %s)", addr, driver, dbPath)
 	if err := http.ListenAndServe(addr, server.Routes()); err != nil {
 		log.Fatal(err)
 	}
 }
+
+const (
+	sessionSweepInterval = 10 * time.Minute
+	mailPollInterval     = time.Minute
+	publishPollInterval  = 10 * time.Second
+)
+
+func sweepSessions(s store.Sessions, every time.Duration) {
+	for range time.Tick(every) {
+		n, err := s.SweepSessions(time.Now())
+		if err != nil {
+			log.Printf("session sweep failed: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("swept %d expired sessions", n)
+		}
+	}
+}
+
+// importJSON copies a JSON database, decrypted with key if it is encrypted,
+// into an empty SQL store. Once the SQL store holds data the import is
+// skipped, so DB_IMPORT_JSON can stay set.
+func importJSON(dst *store.SQLStore, path string, key []byte) error {
+	src, err := store.Load(path, store.WithEncryptionKey(key))
+	if err != nil {
+		return err
+	}
+	d, err := src.Dataset()
+	if err != nil {
+		return err
+	}
+	err = dst.Import(d)
+	if errors.Is(err, store.ErrConflict) {
+		log.Printf("skipping import of %s: sqlite database already has data", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("imported %s into sqlite database", path)
+	return nil
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"novella/internal/store"
+)
+
+type forgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+// forgotPassword always answers 202 so that it cannot be used to find out
+// which email addresses are registered.
+func (s *Server) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user, token, err := s.store.CreatePasswordReset(req.Email)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+	case err != nil:
+		log.Printf("password reset: %v", err)
+	default:
+		s.sendMail(user.Email, "Reset your novella password", fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password. It expires in one hour.\n\n%s\n\n"+
+				"If you did not ask for this, you can ignore this email.\n",
+			user.Username, s.link("/reset-password", token)))
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type resetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (s *Server) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := s.store.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, store.ErrUnauthorized) {
+			respondError(w, http.StatusBadRequest, "invalid or expired token")
+			return
+		}
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type verifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+func (s *Server) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user, err := s.store.VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, store.ErrUnauthorized) {
+			respondError(w, http.StatusBadRequest, "invalid or expired token")
+			return
+		}
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) sendVerification(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	if user.EmailVerifiedAt != nil {
+		respondError(w, http.StatusConflict, "email is already verified")
+		return
+	}
+	if err := s.queueVerification(user.ID); err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) queueVerification(userID int64) error {
+	user, token, err := s.store.CreateEmailVerification(userID)
+	if err != nil {
+		log.Printf("email verification for user %d: %v", userID, err)
+		return err
+	}
+	s.sendMail(user.Email, "Confirm your novella email address", fmt.Sprintf(
+		"Hi %s,\n\nConfirm that this is your email address by opening the link below. It expires in two days.\n\n%s\n",
+		user.Username, s.link("/verify-email", token)))
+	return nil
+}
+
+// sendMail queues a message in the outbox. Delivery happens in the
+// background, so a failing mail server does not fail the request.
+func (s *Server) sendMail(to, subject, body string) {
+	if _, err := s.store.EnqueueMail(to, subject, body); err != nil {
+		log.Printf("queue mail: %v", err)
+		return
+	}
+	if s.cfg.Mail != nil {
+		s.cfg.Mail.Notify()
+	}
+}
+
+func (s *Server) link(path, token string) string {
+	return s.cfg.PublicURL + path + "?token=" + url.QueryEscape(token)
+}
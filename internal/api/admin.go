@@ -0,0 +1,250 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"novella/internal/model"
+	"novella/internal/store"
+)
+
+// requireStaff limits the /admin routes to moderators and admins. The store
+// still decides what each of them may do there.
+func (s *Server) requireStaff(next http.HandlerFunc) http.HandlerFunc {
+	return s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := userFromRequest(r)
+		if user.Role != model.RoleModerator && user.Role != model.RoleAdmin {
+			respondError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next(w, r)
+	})
+}
+
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) adminListUsers(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	users, err := s.store.ListUsers(user.ID, q.Get("q"), model.Role(q.Get("role")), limit, offset)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, users)
+}
+
+func (s *Server) adminGetUser(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	u, err := s.store.UserByID(user.ID, id)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, u)
+}
+
+type adminUserReq struct {
+	Role model.Role `json:"role"`
+}
+
+func (s *Server) adminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req adminUserReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	u, err := s.store.SetRole(user.ID, id, req.Role)
+	if errors.Is(err, store.ErrLastAdmin) {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, u)
+}
+
+func (s *Server) adminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	n, err := s.store.RevokeUserSessions(user.ID, id)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]int{"revoked": n})
+}
+
+func (s *Server) adminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	u, err := s.store.UnlockUser(user.ID, id)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, u)
+}
+
+type adminDeleteUserReq struct {
+	Novels     store.NovelDisposition `json:"novels"`
+	TransferTo int64                  `json:"transfer_to"`
+}
+
+func (s *Server) adminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req adminDeleteUserReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err := s.store.DeleteUser(user.ID, id, req.Novels, req.TransferTo)
+	if errors.Is(err, store.ErrLastAdmin) {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminListNovels lists every novel the caller may read, drafts included.
+func (s *Server) adminListNovels(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	authorID, _ := strconv.ParseInt(q.Get("author_id"), 10, 64)
+	novels, err := s.store.ListNovels(q.Get("q"), authorID, true, user.ID, limit, offset)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, novels)
+}
+
+func (s *Server) adminUpdateNovel(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req createNovelReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var status *model.NovelStatus
+	if req.Status != "" {
+		status = &req.Status
+	}
+	n, err := s.store.UpdateNovel(id, user.ID, req.Title, req.Description, req.Genre, status, req.PublishAt.value())
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, n)
+}
+
+func (s *Server) adminDeleteNovel(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteNovel(id, user.ID); err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminDeleteComment(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	novelID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	commentID, ok := pathID(w, r, "comment")
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteComment(novelID, commentID, user.ID); err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminUpdateChapter(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	novelID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	chapterID, ok := pathID(w, r, "chapter")
+	if !ok {
+		return
+	}
+	var req chapterReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ch, err := s.store.UpdateChapter(novelID, chapterID, user.ID, req.Title, req.Content, req.Format, req.Position, req.Status, req.PublishAt.value())
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, ch)
+}
+
+func (s *Server) adminDeleteChapter(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	novelID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	chapterID, ok := pathID(w, r, "chapter")
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteChapter(novelID, chapterID, user.ID); err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"novella/internal/model"
+	"novella/internal/store"
+)
+
+func keyAllows(w http.ResponseWriter, key model.APIKey, scopes []model.Scope) bool {
+	if len(scopes) == 0 {
+		respondError(w, http.StatusForbidden, "api keys cannot be used here")
+		return false
+	}
+	for _, sc := range scopes {
+		if !key.Allows(sc) {
+			respondError(w, http.StatusForbidden, "api key lacks scope "+string(sc))
+			return false
+		}
+	}
+	return true
+}
+
+// requesterID identifies the caller of a route anonymous visitors may use as
+// well. An invalid token counts as anonymous, but a valid API key without
+// scope is refused rather than quietly downgraded.
+func (s *Server) requesterID(w http.ResponseWriter, r *http.Request, scope model.Scope) (int64, bool) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return 0, true
+	}
+	a := s.authenticate(r, token)
+	if a.err != nil {
+		return 0, true
+	}
+	if a.key != nil && !keyAllows(w, *a.key, []model.Scope{scope}) {
+		return 0, false
+	}
+	return a.user.ID, true
+}
+
+type apiKeyReq struct {
+	Name      string        `json:"name"`
+	Scopes    []model.Scope `json:"scopes"`
+	ExpiresAt *time.Time    `json:"expires_at"`
+}
+
+type apiKeyResp struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+func (s *Server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	var req apiKeyReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	key, token, err := s.store.CreateAPIKey(user.ID, req.Name, req.Scopes, req.ExpiresAt)
+	if errors.Is(err, store.ErrTooManyAPIKeys) {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, apiKeyResp{APIKey: key, Key: token})
+}
+
+func (s *Server) myAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	keys, err := s.store.ListAPIKeys(user.ID)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, keys)
+}
+
+func (s *Server) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	if err := s.store.RevokeAPIKey(user.ID, r.PathValue("id")); err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"novella/internal/ratelimit"
+	"novella/internal/store"
+)
+
+// Failed logins from one address are allowed more slack than those against
+// one account, since many users can share an address.
+func newLoginLockout() *ratelimit.Lockout {
+	return ratelimit.NewLockout(20, time.Minute, time.Hour, time.Hour)
+}
+
+// clientIP is the address a request came from: the last entry of the
+// configured proxy header if there is one, else the connection's peer. A
+// list such as X-Forwarded-For starts with whatever the client sent; only
+// the entry the trusted proxy appended can be relied on.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.cfg.ClientIPHeader != "" {
+		if vs := r.Header.Values(s.cfg.ClientIPHeader); len(vs) > 0 {
+			v := vs[len(vs)-1]
+			if ip := strings.TrimSpace(v[strings.LastIndexByte(v, ',')+1:]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func tooManyAttempts(w http.ResponseWriter, until, now time.Time) {
+	secs := max(1, ceilSeconds(until.Sub(now)))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	respondError(w, http.StatusTooManyRequests, "too many failed login attempts")
+}
+
+// loginFailed counts a wrong password or code against the address and
+// answers 429 once either the address or the account is locked. It reports
+// whether it wrote a response.
+func (s *Server) loginFailed(w http.ResponseWriter, ip string, now time.Time, err error) bool {
+	var locked *store.LockedError
+	if !errors.As(err, &locked) && !errors.Is(err, store.ErrUnauthorized) {
+		return false
+	}
+	until := s.loginIPs.Fail(ip, now)
+	if locked != nil && locked.Until.After(until) {
+		until = locked.Until
+	}
+	if until.IsZero() {
+		return false
+	}
+	tooManyAttempts(w, until, now)
+	return true
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"novella/internal/model"
+	"novella/internal/store"
+)
+
+type oidcStartResp struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	State            string    `json:"state"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// startOIDC begins a sign-in with an identity provider. Called with a valid
+// bearer token it links the provider account to the caller instead.
+func (s *Server) startOIDC(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.cfg.OIDC[r.PathValue("provider")]
+	if !ok {
+		respondError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+	var userID int64
+	if user, ok := s.optionalUser(r); ok {
+		userID = user.ID
+	}
+	authURL, flow, state, err := s.flows.Begin(r.Context(), p, userID)
+	if err != nil {
+		log.Printf("oidc start %s: %v", p.Name, err)
+		respondError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+	respondJSON(w, http.StatusOK, oidcStartResp{AuthorizationURL: authURL, State: state, ExpiresAt: flow.ExpiresAt})
+}
+
+type oidcCallbackReq struct {
+	State  string `json:"state"`
+	Code   string `json:"code"`
+	Device string `json:"device"`
+}
+
+func (s *Server) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.cfg.OIDC[r.PathValue("provider")]
+	if !ok {
+		respondError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+	var req oidcCallbackReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	flow, ok := s.flows.Take(req.State)
+	if !ok || flow.Provider != p.Name {
+		respondError(w, http.StatusBadRequest, "unknown or expired state")
+		return
+	}
+	// A link is finished by the user who started it, so that a state handed
+	// to someone else cannot attach their provider account to the starter.
+	if flow.UserID != 0 {
+		user, ok := s.optionalUser(r)
+		if !ok {
+			respondError(w, http.StatusUnauthorized, "sign in to finish linking "+p.Name)
+			return
+		}
+		if user.ID != flow.UserID {
+			respondError(w, http.StatusForbidden, "this link was started by another user")
+			return
+		}
+	}
+	claims, err := p.Exchange(r.Context(), req.Code, flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Printf("oidc callback %s: %v", p.Name, err)
+		respondError(w, http.StatusUnauthorized, "sign-in with "+p.Name+" failed")
+		return
+	}
+	acct := store.ExternalAccount{
+		Provider:      p.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+	}
+
+	if flow.UserID != 0 {
+		id, err := s.store.LinkIdentity(flow.UserID, acct)
+		if err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				respondError(w, http.StatusConflict, "this "+p.Name+" account is linked to another user, or you already linked one")
+				return
+			}
+			s.handleStoreErr(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, id)
+		return
+	}
+
+	user, tokens, err := s.store.LoginWithIdentity(acct, clientFromRequest(r, req.Device))
+	var challenge *store.Challenge
+	switch {
+	case errors.As(err, &challenge):
+		respondJSON(w, http.StatusOK, challengeResp{
+			TwoFactorRequired:  true,
+			ChallengeToken:     challenge.Token,
+			ChallengeExpiresAt: challenge.ExpiresAt,
+		})
+	case errors.Is(err, store.ErrConflict):
+		respondError(w, http.StatusConflict, "an account with this email already exists; sign in and link "+p.Name+" from your profile")
+	case err != nil:
+		s.handleStoreErr(w, err)
+	default:
+		respondJSON(w, http.StatusOK, authResp{tokenResp: newTokenResp(tokens), User: user})
+	}
+}
+
+func (s *Server) myIdentities(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	ids, err := s.store.ListIdentities(user.ID)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, ids)
+}
+
+func (s *Server) unlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	if err := s.store.UnlinkIdentity(user.ID, r.PathValue("provider")); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			respondError(w, http.StatusConflict, "set a password before removing your only sign-in method")
+			return
+		}
+		s.handleStoreErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// optionalUser authenticates the request if it carries a session token.
+func (s *Server) optionalUser(r *http.Request) (model.User, bool) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return model.User{}, false
+	}
+	a := s.authenticate(r, token)
+	return a.user, a.err == nil && a.key == nil
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"novella/internal/store"
+)
+
+type deleteMeReq struct {
+	Password   string                 `json:"password"`
+	Novels     store.NovelDisposition `json:"novels"`
+	TransferTo int64                  `json:"transfer_to"`
+}
+
+func (s *Server) deleteMe(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	var req deleteMeReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err := s.store.DeleteAccount(user.ID, store.AccountDeletion{
+		Reauth:     reauth(r, req.Password),
+		Novels:     req.Novels,
+		TransferTo: req.TransferTo,
+	})
+	switch {
+	case errors.Is(err, store.ErrReauthRequired):
+		respondError(w, http.StatusForbidden, "sign in again to confirm this change")
+	case errors.Is(err, store.ErrUnauthorized):
+		respondError(w, http.StatusForbidden, "invalid password")
+	case errors.Is(err, store.ErrLastAdmin):
+		respondError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		s.handleStoreErr(w, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// exportMe sends a zip archive with one JSON file per kind of record the
+// store holds about the user.
+func (s *Server) exportMe(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	e, err := s.store.ExportAccount(user.ID)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	files := []struct {
+		name string
+		data any
+	}{
+		{"account.json", e.User},
+		{"sessions.json", e.Sessions},
+		{"api_keys.json", e.APIKeys},
+		{"identities.json", e.Identities},
+		{"tokens.json", e.Tokens},
+		{"mail.json", e.Mail},
+		{"novels.json", e.Novels},
+		{"chapters.json", e.Chapters},
+		{"revisions.json", e.Revisions},
+		{"comments.json", e.Comments},
+		{"bookmarks.json", e.Bookmarks},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="novella-export-%d.zip"`, user.ID))
+	w.Header().Set("Cache-Control", "no-store")
+	zw := zip.NewWriter(w)
+	now := time.Now().UTC()
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			enc := json.NewEncoder(fw)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(f.data)
+		}
+		if err != nil {
+			log.Printf("export for user %d failed: %v", user.ID, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("export for user %d failed: %v", user.ID, err)
+	}
+}
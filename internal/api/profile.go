@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"novella/internal/model"
+	"novella/internal/store"
+)
+
+type updateMeReq struct {
+	Username        *string `json:"username"`
+	Email           *string `json:"email"`
+	DisplayName     *string `json:"display_name"`
+	Bio             *string `json:"bio"`
+	AvatarURL       *string `json:"avatar_url"`
+	NewPassword     *string `json:"new_password"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+func (s *Server) updateMe(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	sess, _ := sessionFromRequest(r)
+	var req updateMeReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	updated, err := s.store.UpdateProfile(user.ID, sess.ID, store.ProfileUpdate{
+		Username:        req.Username,
+		Email:           req.Email,
+		DisplayName:     req.DisplayName,
+		Bio:             req.Bio,
+		AvatarURL:       req.AvatarURL,
+		Password:        req.NewPassword,
+		CurrentPassword: req.CurrentPassword,
+	})
+	if errors.Is(err, store.ErrConflict) {
+		respondError(w, http.StatusConflict, "email or username already exists")
+		return
+	}
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	if !strings.EqualFold(strings.TrimSpace(updated.Email), strings.TrimSpace(user.Email)) {
+		s.sendMail(user.Email, "Your novella email address was changed", fmt.Sprintf(
+			"Hi %s,\n\nThe email address of your novella account was changed to %s. If you did not do this, reset your password and contact support.\n",
+			updated.Username, updated.Email))
+		s.queueVerification(updated.ID)
+	}
+	respondJSON(w, http.StatusOK, updated)
+}
+
+type profileResp struct {
+	model.Profile
+	Novels []model.Novel `json:"novels"`
+}
+
+// userProfile is an author page: the public part of the account and the
+// novels it has published.
+func (s *Server) userProfile(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	p, err := s.store.Profile(id)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	novels, err := s.store.ListNovels("", id, false, 0, 0, 0)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, profileResp{Profile: p, Novels: novels})
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"novella/internal/ratelimit"
+)
+
+// RateLimits caps how often one client, a signed-in user or else an
+// address, may call the API. Routes are named by method and path with
+// numeric IDs written as {id}, e.g. "POST /novels/{id}/comments"; each named
+// route has a bucket of its own, and every other route draws from one shared
+// Default bucket per client.
+type RateLimits struct {
+	Default ratelimit.Limit
+	Routes  map[string]ratelimit.Limit
+}
+
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Default: ratelimit.Limit{Requests: 300, Per: time.Minute},
+		Routes: map[string]ratelimit.Limit{
+			"POST /auth/register":        {Requests: 10, Per: time.Minute},
+			"POST /auth/password/forgot": {Requests: 5, Per: time.Minute},
+			"GET /novels":                {Requests: 60, Per: time.Minute},
+			"POST /novels/{id}/comments": {Requests: 10, Per: time.Minute},
+		},
+	}
+}
+
+// ParseRateLimits applies overrides to the defaults: def replaces the
+// default limit, and routes lists route=limit pairs separated by semicolons,
+// e.g. "GET /novels=120/m; POST /novels/{id}/comments=off".
+func ParseRateLimits(def, routes string) (RateLimits, error) {
+	rl := DefaultRateLimits()
+	if strings.TrimSpace(def) != "" {
+		l, err := ratelimit.ParseLimit(def)
+		if err != nil {
+			return RateLimits{}, err
+		}
+		rl.Default = l
+	}
+	for _, pair := range strings.Split(routes, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		route, v, ok := strings.Cut(pair, "=")
+		method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || !hasPath || !strings.HasPrefix(path, "/") {
+			return RateLimits{}, fmt.Errorf("invalid route rate limit %q: want \"METHOD /path=limit\"", pair)
+		}
+		l, err := ratelimit.ParseLimit(v)
+		if err != nil {
+			return RateLimits{}, err
+		}
+		rl.Routes[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = l
+	}
+	return rl, nil
+}
+
+// routeName names r's route the way RateLimits does.
+func routeName(r *http.Request) string {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for i, p := range parts {
+		if _, err := strconv.ParseInt(p, 10, 64); err == nil {
+			parts[i] = "{id}"
+		}
+	}
+	return r.Method + " /" + strings.Join(parts, "/")
+}
+
+// rateLimit refuses requests over their route's limit with 429 and reports
+// the state of the bucket in RateLimit headers. A request with a valid
+// bearer token counts against its user, wherever it comes from.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeName(r)
+		limit, ok := s.cfg.RateLimits.Routes[route]
+		if !ok {
+			route, limit = "default", s.cfg.RateLimits.Default
+		}
+		if limit.Unlimited() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := "ip:" + s.clientIP(r)
+		if token, ok := bearerToken(r); ok {
+			a := s.authenticate(r, token)
+			r = r.WithContext(context.WithValue(r.Context(), authKey, a))
+			if a.err == nil {
+				client = "user:" + strconv.FormatInt(a.user.ID, 10)
+			}
+		}
+		res := s.limiter.Allow(route+" "+client, limit, time.Now())
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Per)))
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(res.RetryAfter))))
+			respondError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
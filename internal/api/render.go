@@ -0,0 +1,76 @@
+package api
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"novella/internal/model"
+)
+
+// renderCacheSize is how many rendered chapter texts are kept in memory.
+const renderCacheSize = 512
+
+// respondChapter sends ch with its content as written, or rendered to HTML
+// when content=html is asked for. Without the parameter a client whose
+// Accept header prefers text/html to JSON gets the HTML on its own.
+func (s *Server) respondChapter(w http.ResponseWriter, r *http.Request, ch model.Chapter) {
+	w.Header().Add("Vary", "Accept")
+	switch r.URL.Query().Get("content") {
+	case "raw":
+		respondJSON(w, http.StatusOK, ch)
+	case "html":
+		ch.Content = s.renders.HTML(ch.Format, ch.Content)
+		ch.Format = model.FormatHTML
+		respondJSON(w, http.StatusOK, ch)
+	case "":
+		if !prefersHTML(r.Header.Get("Accept")) {
+			respondJSON(w, http.StatusOK, ch)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, s.renders.HTML(ch.Format, ch.Content))
+	default:
+		respondError(w, http.StatusBadRequest, "content must be raw or html")
+	}
+}
+
+// prefersHTML reports whether accept ranks text/html above application/json.
+// Ties go to JSON.
+func prefersHTML(accept string) bool {
+	return quality(accept, "text", "html") > quality(accept, "application", "json")
+}
+
+// quality is the q-value accept gives the media type typ/sub, taken from the
+// most specific range that matches it.
+func quality(accept, typ, sub string) float64 {
+	q, best := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		rt, rs, _ := strings.Cut(mt, "/")
+		specificity := 0
+		switch {
+		case rt == typ && rs == sub:
+			specificity = 2
+		case rt == typ && rs == "*":
+			specificity = 1
+		case rt == "*" && rs == "*":
+		default:
+			continue
+		}
+		if specificity <= best {
+			continue
+		}
+		best, q = specificity, 1
+		if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			q = v
+		}
+	}
+	return q
+}
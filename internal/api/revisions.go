@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"novella/internal/diff"
+	"novella/internal/model"
+)
+
+type diffResp struct {
+	From  int         `json:"from"`
+	To    int         `json:"to"`
+	By    string      `json:"by"`
+	Edits []diff.Edit `json:"edits"`
+}
+
+func (s *Server) handleRevisions(w http.ResponseWriter, r *http.Request, novelID, chapterID int64, rest []string) {
+	if len(rest) == 0 || rest[0] == "" {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := userFromRequest(r)
+			revs, err := s.store.ListRevisions(novelID, chapterID, user.ID)
+			if err != nil {
+				s.handleStoreErr(w, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, revs)
+		}, model.ScopeChaptersRead)(w, r)
+		return
+	}
+	if rest[0] == "diff" && len(rest) == 1 {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.diffRevisions(w, r, novelID, chapterID)
+		}, model.ScopeChaptersRead)(w, r)
+		return
+	}
+
+	number, err := strconv.Atoi(rest[0])
+	if err != nil || number <= 0 {
+		respondError(w, http.StatusBadRequest, "invalid revision number")
+		return
+	}
+	switch {
+	case len(rest) == 1 && r.Method == http.MethodGet:
+		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := userFromRequest(r)
+			rev, err := s.store.RevisionByNumber(novelID, chapterID, user.ID, number)
+			if err != nil {
+				s.handleStoreErr(w, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, rev)
+		}, model.ScopeChaptersRead)(w, r)
+	case len(rest) == 2 && rest[1] == "restore" && r.Method == http.MethodPost:
+		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := userFromRequest(r)
+			ch, err := s.store.RestoreRevision(novelID, chapterID, user.ID, number)
+			if err != nil {
+				s.handleStoreErr(w, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, ch)
+		}, model.ScopeChaptersWrite)(w, r)
+	case len(rest) > 2 || (len(rest) == 2 && rest[1] != "restore"):
+		respondError(w, http.StatusNotFound, "not found")
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// diffRevisions compares the revisions ?from and ?to of a chapter, line by
+// line unless ?by=word.
+func (s *Server) diffRevisions(w http.ResponseWriter, r *http.Request, novelID, chapterID int64) {
+	user, _ := userFromRequest(r)
+	q := r.URL.Query()
+	from, err1 := strconv.Atoi(q.Get("from"))
+	to, err2 := strconv.Atoi(q.Get("to"))
+	if err1 != nil || err2 != nil {
+		respondError(w, http.StatusBadRequest, "from and to must be revision numbers")
+		return
+	}
+	by := q.Get("by")
+	compare := diff.Lines
+	switch by {
+	case "", "line":
+		by = "line"
+	case "word":
+		compare = diff.Words
+	default:
+		respondError(w, http.StatusBadRequest, "by must be line or word")
+		return
+	}
+	a, err := s.store.RevisionByNumber(novelID, chapterID, user.ID, from)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	b, err := s.store.RevisionByNumber(novelID, chapterID, user.ID, to)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, diffResp{From: from, To: to, By: by, Edits: compare(a.Content, b.Content)})
+}
@@ -8,17 +8,48 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"novella/internal/model"
+	"novella/internal/oidc"
+	"novella/internal/ratelimit"
+	"novella/internal/render"
 	"novella/internal/store"
 )
 
 type Server struct {
-	store *store.Store
+	store    store.Backend
+	cfg      Config
+	flows    *oidc.Flows
+	loginIPs *ratelimit.Lockout
+	limiter  *ratelimit.Limiter
+	renders  *render.Cache
 }
 
-func New(s *store.Store) *Server {
-	return &Server{store: s}
+// Config holds the settings handlers need beyond the store. PublicURL is the
+// base for links sent by email; Mail, when set, is woken after mail is queued.
+// OIDC maps provider names to the identity providers users can sign in with.
+// ClientIPHeader names the header a trusted proxy puts the client's address
+// in; without one the peer address is used. RateLimits caps how often each
+// client may call each route.
+type Config struct {
+	PublicURL      string
+	Mail           interface{ Notify() }
+	OIDC           map[string]*oidc.Provider
+	ClientIPHeader string
+	RateLimits     RateLimits
+}
+
+func New(s store.Backend, cfg Config) *Server {
+	cfg.PublicURL = strings.TrimRight(cfg.PublicURL, "/")
+	return &Server{
+		store:    s,
+		cfg:      cfg,
+		flows:    oidc.NewFlows(),
+		loginIPs: newLoginLockout(),
+		limiter:  ratelimit.NewLimiter(),
+		renders:  render.NewCache(renderCacheSize),
+	}
 }
 
 func (s *Server) Routes() http.Handler {
@@ -26,12 +57,47 @@ func (s *Server) Routes() http.Handler {
 	mux.HandleFunc("GET /health", s.health)
 	mux.HandleFunc("POST /auth/register", s.register)
 	mux.HandleFunc("POST /auth/login", s.login)
-	mux.HandleFunc("GET /me", s.requireAuth(s.me))
-	mux.HandleFunc("GET /me/bookmarks", s.requireAuth(s.myBookmarks))
+	mux.HandleFunc("POST /auth/login/2fa", s.loginTwoFactor)
+	mux.HandleFunc("POST /auth/oidc/{provider}/start", s.startOIDC)
+	mux.HandleFunc("POST /auth/oidc/{provider}/callback", s.oidcCallback)
+	mux.HandleFunc("POST /auth/refresh", s.refresh)
+	mux.HandleFunc("POST /auth/logout", s.requireAuth(s.logout))
+	mux.HandleFunc("POST /auth/password/forgot", s.forgotPassword)
+	mux.HandleFunc("POST /auth/password/reset", s.resetPassword)
+	mux.HandleFunc("POST /auth/email/verify", s.verifyEmail)
+	mux.HandleFunc("GET /me", s.requireAuth(s.me, model.ScopeProfileRead))
+	mux.HandleFunc("PATCH /me", s.requireAuth(s.updateMe))
+	mux.HandleFunc("DELETE /me", s.requireAuth(s.deleteMe))
+	mux.HandleFunc("GET /me/export", s.requireAuth(s.exportMe))
+	mux.HandleFunc("POST /me/email/verification", s.requireAuth(s.sendVerification))
+	mux.HandleFunc("POST /me/2fa/setup", s.requireAuth(s.setupTwoFactor))
+	mux.HandleFunc("POST /me/2fa/enable", s.requireAuth(s.enableTwoFactor))
+	mux.HandleFunc("POST /me/2fa/disable", s.requireAuth(s.disableTwoFactor))
+	mux.HandleFunc("GET /me/identities", s.requireAuth(s.myIdentities))
+	mux.HandleFunc("DELETE /me/identities/{provider}", s.requireAuth(s.unlinkIdentity))
+	mux.HandleFunc("GET /me/sessions", s.requireAuth(s.mySessions))
+	mux.HandleFunc("DELETE /me/sessions/{id}", s.requireAuth(s.revokeSession))
+	mux.HandleFunc("POST /me/api-keys", s.requireAuth(s.createAPIKey))
+	mux.HandleFunc("GET /me/api-keys", s.requireAuth(s.myAPIKeys))
+	mux.HandleFunc("DELETE /me/api-keys/{id}", s.requireAuth(s.revokeAPIKey))
+	mux.HandleFunc("GET /me/bookmarks", s.requireAuth(s.myBookmarks, model.ScopeBookmarksRead))
+	mux.HandleFunc("GET /users/{id}", s.userProfile)
 	mux.HandleFunc("GET /novels", s.listNovels)
-	mux.HandleFunc("POST /novels", s.requireAuth(s.createNovel))
+	mux.HandleFunc("POST /novels", s.requireAuth(s.createNovel, model.ScopeNovelsWrite))
 	mux.HandleFunc("/novels/", s.novelSubrouter)
-	return loggingMiddleware(mux)
+	mux.HandleFunc("GET /admin/users", s.requireStaff(s.adminListUsers))
+	mux.HandleFunc("GET /admin/users/{id}", s.requireStaff(s.adminGetUser))
+	mux.HandleFunc("PATCH /admin/users/{id}", s.requireStaff(s.adminUpdateUser))
+	mux.HandleFunc("DELETE /admin/users/{id}/sessions", s.requireStaff(s.adminRevokeSessions))
+	mux.HandleFunc("POST /admin/users/{id}/unlock", s.requireStaff(s.adminUnlockUser))
+	mux.HandleFunc("DELETE /admin/users/{id}", s.requireStaff(s.adminDeleteUser))
+	mux.HandleFunc("GET /admin/novels", s.requireStaff(s.adminListNovels))
+	mux.HandleFunc("PATCH /admin/novels/{id}", s.requireStaff(s.adminUpdateNovel))
+	mux.HandleFunc("DELETE /admin/novels/{id}", s.requireStaff(s.adminDeleteNovel))
+	mux.HandleFunc("PATCH /admin/novels/{id}/chapters/{chapter}", s.requireStaff(s.adminUpdateChapter))
+	mux.HandleFunc("DELETE /admin/novels/{id}/chapters/{chapter}", s.requireStaff(s.adminDeleteChapter))
+	mux.HandleFunc("DELETE /admin/novels/{id}/comments/{comment}", s.requireStaff(s.adminDeleteComment))
+	return loggingMiddleware(s.rateLimit(mux))
 }
 
 func loggingMiddleware(next http.Handler) http.Handler {
@@ -43,22 +109,71 @@ func loggingMiddleware(next http.Handler) http.Handler {
 
 type contextKey string
 
-const userKey contextKey = "user"
+const (
+	userKey    contextKey = "user"
+	sessionKey contextKey = "session"
+	apiKeyKey  contextKey = "api_key"
+	authKey    contextKey = "auth"
+)
 
-func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+func bearerToken(r *http.Request) (string, bool) {
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// auth is what a bearer token resolved to: a user with either a session or,
+// for API keys, key.
+type auth struct {
+	user model.User
+	sess model.Session
+	key  *model.APIKey
+	err  error
+}
+
+// authenticate resolves token. The rate limiter already does so for most
+// requests, and the result is reused so the store is asked only once.
+func (s *Server) authenticate(r *http.Request, token string) auth {
+	if a, ok := r.Context().Value(authKey).(auth); ok {
+		return a
+	}
+	var a auth
+	if store.IsAPIKey(token) {
+		var key model.APIKey
+		a.user, key, a.err = s.store.AuthenticateAPIKey(token)
+		a.key = &key
+	} else {
+		a.user, a.sess, a.err = s.store.Authenticate(token)
+	}
+	return a
+}
+
+// requireAuth admits session tokens, and API keys that hold every one of
+// scopes. A route that names no scopes is for sessions only.
+func (s *Server) requireAuth(next http.HandlerFunc, scopes ...model.Scope) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		auth := strings.TrimSpace(r.Header.Get("Authorization"))
-		parts := strings.SplitN(auth, " ", 2)
-		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		token, ok := bearerToken(r)
+		if !ok {
 			respondError(w, http.StatusUnauthorized, "missing bearer token")
 			return
 		}
-		user, err := s.store.UserByToken(parts[1])
-		if err != nil {
+		a := s.authenticate(r, token)
+		if a.err != nil {
 			respondError(w, http.StatusUnauthorized, "invalid token")
 			return
 		}
-		ctx := context.WithValue(r.Context(), userKey, user)
+		ctx := context.WithValue(r.Context(), userKey, a.user)
+		if a.key != nil {
+			if !keyAllows(w, *a.key, scopes) {
+				return
+			}
+			ctx = context.WithValue(ctx, apiKeyKey, *a.key)
+		} else {
+			ctx = context.WithValue(ctx, sessionKey, a.sess)
+		}
 		next(w, r.WithContext(ctx))
 	}
 }
@@ -68,6 +183,15 @@ func userFromRequest(r *http.Request) (model.User, bool) {
 	return u, ok
 }
 
+func sessionFromRequest(r *http.Request) (model.Session, bool) {
+	sess, ok := r.Context().Value(sessionKey).(model.Session)
+	return sess, ok
+}
+
+func clientFromRequest(r *http.Request, device string) store.Client {
+	return store.Client{Device: strings.TrimSpace(device), UserAgent: r.UserAgent()}
+}
+
 func (s *Server) health(w http.ResponseWriter, _ *http.Request) {
 	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
@@ -76,6 +200,7 @@ type registerReq struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 }
 
 func (s *Server) register(w http.ResponseWriter, r *http.Request) {
@@ -84,7 +209,7 @@ func (s *Server) register(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	user, token, err := s.store.Register(req.Username, req.Email, req.Password)
+	user, tokens, err := s.store.Register(req.Username, req.Email, req.Password, clientFromRequest(r, req.Device))
 	if err != nil {
 		if errors.Is(err, store.ErrConflict) {
 			respondError(w, http.StatusConflict, "email or username already exists")
@@ -93,12 +218,14 @@ func (s *Server) register(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	respondJSON(w, http.StatusCreated, map[string]any{"user": user, "token": token})
+	s.queueVerification(user.ID)
+	respondJSON(w, http.StatusCreated, authResp{tokenResp: newTokenResp(tokens), User: user})
 }
 
 type loginReq struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 }
 
 func (s *Server) login(w http.ResponseWriter, r *http.Request) {
@@ -107,12 +234,104 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	user, token, err := s.store.Login(req.Email, req.Password)
+	ip, now := s.clientIP(r), time.Now()
+	if until, locked := s.loginIPs.Locked(ip, now); locked {
+		tooManyAttempts(w, until, now)
+		return
+	}
+	user, tokens, err := s.store.Login(req.Email, req.Password, clientFromRequest(r, req.Device))
+	var challenge *store.Challenge
+	if errors.As(err, &challenge) {
+		respondJSON(w, http.StatusOK, challengeResp{
+			TwoFactorRequired:  true,
+			ChallengeToken:     challenge.Token,
+			ChallengeExpiresAt: challenge.ExpiresAt,
+		})
+		return
+	}
+	if s.loginFailed(w, ip, now, err) {
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusUnauthorized, "invalid credentials")
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]any{"user": user, "token": token})
+	respondJSON(w, http.StatusOK, authResp{tokenResp: newTokenResp(tokens), User: user})
+}
+
+type tokenResp struct {
+	Token          string    `json:"token"`
+	TokenExpiresAt time.Time `json:"token_expires_at"`
+	RefreshToken   string    `json:"refresh_token"`
+}
+
+func newTokenResp(t store.Tokens) tokenResp {
+	return tokenResp{Token: t.Access, TokenExpiresAt: t.AccessExpiresAt, RefreshToken: t.Refresh}
+}
+
+type authResp struct {
+	tokenResp
+	User model.User `json:"user"`
+}
+
+type refreshReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (s *Server) refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tokens, err := s.store.Refresh(req.RefreshToken)
+	if errors.Is(err, store.ErrRefreshReused) {
+		log.Printf("refresh token reused; session revoked")
+	}
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+	respondJSON(w, http.StatusOK, newTokenResp(tokens))
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	sess, _ := sessionFromRequest(r)
+	if err := s.store.RevokeSession(user.ID, sess.ID); err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type sessionResp struct {
+	model.Session
+	Current bool `json:"current"`
+}
+
+func (s *Server) mySessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	current, _ := sessionFromRequest(r)
+	sessions, err := s.store.ListSessions(user.ID)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	res := make([]sessionResp, 0, len(sessions))
+	for _, sess := range sessions {
+		res = append(res, sessionResp{Session: sess, Current: sess.ID == current.ID})
+	}
+	respondJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) revokeSession(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	if err := s.store.RevokeSession(user.ID, r.PathValue("id")); err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (s *Server) me(w http.ResponseWriter, r *http.Request) {
@@ -129,6 +348,29 @@ type createNovelReq struct {
 	Description string            `json:"description"`
 	Genre       string            `json:"genre"`
 	Status      model.NovelStatus `json:"status"`
+	PublishAt   publishAt         `json:"publish_at"`
+}
+
+// publishAt is the publish_at of a request body. Leaving it out keeps the
+// schedule and null cancels it, which the store reads as the zero time.
+type publishAt struct {
+	set bool
+	at  time.Time
+}
+
+func (p *publishAt) UnmarshalJSON(data []byte) error {
+	p.set = true
+	if string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, &p.at)
+}
+
+func (p publishAt) value() *time.Time {
+	if !p.set {
+		return nil
+	}
+	return &p.at
 }
 
 func (s *Server) createNovel(w http.ResponseWriter, r *http.Request) {
@@ -138,9 +380,9 @@ func (s *Server) createNovel(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	n, err := s.store.CreateNovel(user.ID, req.Title, req.Description, req.Genre, req.Status)
+	n, err := s.store.CreateNovel(user.ID, req.Title, req.Description, req.Genre, req.Status, req.PublishAt.value())
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+		s.handleStoreErr(w, err)
 		return
 	}
 	respondJSON(w, http.StatusCreated, n)
@@ -153,15 +395,16 @@ func (s *Server) listNovels(w http.ResponseWriter, r *http.Request) {
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 	authorID, _ := strconv.ParseInt(r.URL.Query().Get("author_id"), 10, 64)
 
-	var requesterID int64
-	auth := strings.TrimSpace(r.Header.Get("Authorization"))
-	if parts := strings.SplitN(auth, " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
-		if u, err := s.store.UserByToken(parts[1]); err == nil {
-			requesterID = u.ID
-		}
+	requesterID, ok := s.requesterID(w, r, model.ScopeNovelsRead)
+	if !ok {
+		return
 	}
 
-	novels := s.store.ListNovels(query, authorID, includeDrafts, requesterID, limit, offset)
+	novels, err := s.store.ListNovels(query, authorID, includeDrafts, requesterID, limit, offset)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
 	respondJSON(w, http.StatusOK, novels)
 }
 
@@ -187,11 +430,11 @@ func (s *Server) novelSubrouter(w http.ResponseWriter, r *http.Request) {
 	case "chapters":
 		s.handleChapters(w, r, novelID, parts[2:])
 	case "comments":
-		s.handleComments(w, r, novelID)
+		s.handleComments(w, r, novelID, parts[2:])
 	case "bookmark":
 		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
 			s.handleBookmark(w, r, novelID)
-		})(w, r)
+		}, model.ScopeBookmarksWrite)(w, r)
 	default:
 		respondError(w, http.StatusNotFound, "not found")
 	}
@@ -200,12 +443,9 @@ func (s *Server) novelSubrouter(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleNovelByID(w http.ResponseWriter, r *http.Request, novelID int64) {
 	switch r.Method {
 	case http.MethodGet:
-		var requesterID int64
-		auth := strings.TrimSpace(r.Header.Get("Authorization"))
-		if parts := strings.SplitN(auth, " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
-			if u, err := s.store.UserByToken(parts[1]); err == nil {
-				requesterID = u.ID
-			}
+		requesterID, ok := s.requesterID(w, r, model.ScopeNovelsRead)
+		if !ok {
+			return
 		}
 		n, err := s.store.NovelByID(novelID, requesterID)
 		if err != nil {
@@ -225,13 +465,13 @@ func (s *Server) handleNovelByID(w http.ResponseWriter, r *http.Request, novelID
 			if req.Status != "" {
 				status = &req.Status
 			}
-			n, err := s.store.UpdateNovel(novelID, user.ID, req.Title, req.Description, req.Genre, status)
+			n, err := s.store.UpdateNovel(novelID, user.ID, req.Title, req.Description, req.Genre, status, req.PublishAt.value())
 			if err != nil {
 				s.handleStoreErr(w, err)
 				return
 			}
 			respondJSON(w, http.StatusOK, n)
-		})(w, r)
+		}, model.ScopeNovelsWrite)(w, r)
 	case http.MethodDelete:
 		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
 			user, _ := userFromRequest(r)
@@ -240,28 +480,32 @@ func (s *Server) handleNovelByID(w http.ResponseWriter, r *http.Request, novelID
 				return
 			}
 			w.WriteHeader(http.StatusNoContent)
-		})(w, r)
+		}, model.ScopeNovelsWrite)(w, r)
 	default:
 		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
 type chapterReq struct {
-	Title    string `json:"title"`
-	Content  string `json:"content"`
-	Position int    `json:"position"`
+	Title     string               `json:"title"`
+	Content   string               `json:"content"`
+	Format    model.ContentFormat  `json:"format"`
+	Position  int                  `json:"position"`
+	Status    *model.ChapterStatus `json:"status"`
+	PublishAt publishAt            `json:"publish_at"`
+}
+
+type chapterOrderReq struct {
+	ChapterIDs []int64 `json:"chapter_ids"`
 }
 
 func (s *Server) handleChapters(w http.ResponseWriter, r *http.Request, novelID int64, rest []string) {
 	if len(rest) == 0 || rest[0] == "" {
 		switch r.Method {
 		case http.MethodGet:
-			var requesterID int64
-			auth := strings.TrimSpace(r.Header.Get("Authorization"))
-			if parts := strings.SplitN(auth, " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
-				if u, err := s.store.UserByToken(parts[1]); err == nil {
-					requesterID = u.ID
-				}
+			requesterID, ok := s.requesterID(w, r, model.ScopeChaptersRead)
+			if !ok {
+				return
 			}
 			chs, err := s.store.ListChapters(novelID, requesterID)
 			if err != nil {
@@ -277,40 +521,67 @@ func (s *Server) handleChapters(w http.ResponseWriter, r *http.Request, novelID
 					respondError(w, http.StatusBadRequest, err.Error())
 					return
 				}
-				ch, err := s.store.CreateChapter(novelID, user.ID, req.Title, req.Content, req.Position)
+				ch, err := s.store.CreateChapter(novelID, user.ID, req.Title, req.Content, req.Format, req.Position, req.Status, req.PublishAt.value())
 				if err != nil {
 					s.handleStoreErr(w, err)
 					return
 				}
 				respondJSON(w, http.StatusCreated, ch)
-			})(w, r)
+			}, model.ScopeChaptersWrite)(w, r)
 		default:
 			respondError(w, http.StatusMethodNotAllowed, "method not allowed")
 		}
 		return
 	}
 
+	if rest[0] == "order" && len(rest) == 1 {
+		if r.Method != http.MethodPut {
+			respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := userFromRequest(r)
+			var req chapterOrderReq
+			if err := decodeJSON(r, &req); err != nil {
+				respondError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			chs, err := s.store.ReorderChapters(novelID, user.ID, req.ChapterIDs)
+			if err != nil {
+				s.handleStoreErr(w, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, chs)
+		}, model.ScopeChaptersWrite)(w, r)
+		return
+	}
+
 	chapterID, err := strconv.ParseInt(rest[0], 10, 64)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "invalid chapter id")
 		return
 	}
+	if len(rest) > 1 {
+		if rest[1] != "revisions" {
+			respondError(w, http.StatusNotFound, "not found")
+			return
+		}
+		s.handleRevisions(w, r, novelID, chapterID, rest[2:])
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
-		var requesterID int64
-		auth := strings.TrimSpace(r.Header.Get("Authorization"))
-		if parts := strings.SplitN(auth, " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
-			if u, err := s.store.UserByToken(parts[1]); err == nil {
-				requesterID = u.ID
-			}
+		requesterID, ok := s.requesterID(w, r, model.ScopeChaptersRead)
+		if !ok {
+			return
 		}
 		ch, err := s.store.ChapterByID(novelID, chapterID, requesterID)
 		if err != nil {
 			s.handleStoreErr(w, err)
 			return
 		}
-		respondJSON(w, http.StatusOK, ch)
+		s.respondChapter(w, r, ch)
 	case http.MethodPatch:
 		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
 			user, _ := userFromRequest(r)
@@ -319,13 +590,13 @@ func (s *Server) handleChapters(w http.ResponseWriter, r *http.Request, novelID
 				respondError(w, http.StatusBadRequest, err.Error())
 				return
 			}
-			ch, err := s.store.UpdateChapter(novelID, chapterID, user.ID, req.Title, req.Content, req.Position)
+			ch, err := s.store.UpdateChapter(novelID, chapterID, user.ID, req.Title, req.Content, req.Format, req.Position, req.Status, req.PublishAt.value())
 			if err != nil {
 				s.handleStoreErr(w, err)
 				return
 			}
 			respondJSON(w, http.StatusOK, ch)
-		})(w, r)
+		}, model.ScopeChaptersWrite)(w, r)
 	case http.MethodDelete:
 		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
 			user, _ := userFromRequest(r)
@@ -334,7 +605,7 @@ func (s *Server) handleChapters(w http.ResponseWriter, r *http.Request, novelID
 				return
 			}
 			w.WriteHeader(http.StatusNoContent)
-		})(w, r)
+		}, model.ScopeChaptersWrite)(w, r)
 	default:
 		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
@@ -345,15 +616,33 @@ type commentReq struct {
 	ChapterID *int64 `json:"chapter_id"`
 }
 
-func (s *Server) handleComments(w http.ResponseWriter, r *http.Request, novelID int64) {
+func (s *Server) handleComments(w http.ResponseWriter, r *http.Request, novelID int64, rest []string) {
+	if len(rest) > 0 && rest[0] != "" {
+		commentID, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid comment id")
+			return
+		}
+		if r.Method != http.MethodDelete {
+			respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := userFromRequest(r)
+			if err := s.store.DeleteComment(novelID, commentID, user.ID); err != nil {
+				s.handleStoreErr(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}, model.ScopeCommentsWrite)(w, r)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		var requesterID int64
-		auth := strings.TrimSpace(r.Header.Get("Authorization"))
-		if parts := strings.SplitN(auth, " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
-			if u, err := s.store.UserByToken(parts[1]); err == nil {
-				requesterID = u.ID
-			}
+		requesterID, ok := s.requesterID(w, r, model.ScopeCommentsRead)
+		if !ok {
+			return
 		}
 		var chapterID *int64
 		if raw := r.URL.Query().Get("chapter_id"); raw != "" {
@@ -384,7 +673,7 @@ func (s *Server) handleComments(w http.ResponseWriter, r *http.Request, novelID
 				return
 			}
 			respondJSON(w, http.StatusCreated, c)
-		})(w, r)
+		}, model.ScopeCommentsWrite)(w, r)
 	default:
 		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
@@ -415,7 +704,12 @@ func (s *Server) handleBookmark(w http.ResponseWriter, r *http.Request, novelID
 
 func (s *Server) myBookmarks(w http.ResponseWriter, r *http.Request) {
 	user, _ := userFromRequest(r)
-	respondJSON(w, http.StatusOK, s.store.MyBookmarks(user.ID))
+	bookmarks, err := s.store.MyBookmarks(user.ID)
+	if err != nil {
+		s.handleStoreErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, bookmarks)
 }
 
 func (s *Server) handleStoreErr(w http.ResponseWriter, err error) {
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"novella/internal/store"
+)
+
+type challengeResp struct {
+	TwoFactorRequired  bool      `json:"two_factor_required"`
+	ChallengeToken     string    `json:"challenge_token"`
+	ChallengeExpiresAt time.Time `json:"challenge_expires_at"`
+}
+
+type loginTwoFactorReq struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	Device         string `json:"device"`
+}
+
+func (s *Server) loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req loginTwoFactorReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ip, now := s.clientIP(r), time.Now()
+	if until, locked := s.loginIPs.Locked(ip, now); locked {
+		tooManyAttempts(w, until, now)
+		return
+	}
+	user, tokens, err := s.store.CompleteLogin(req.ChallengeToken, req.Code, clientFromRequest(r, req.Device))
+	if s.loginFailed(w, ip, now, err) {
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "invalid or expired code")
+		return
+	}
+	respondJSON(w, http.StatusOK, authResp{tokenResp: newTokenResp(tokens), User: user})
+}
+
+type twoFactorReq struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type twoFactorSetupResp struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+func (s *Server) setupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	var req twoFactorReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setup, err := s.store.BeginTwoFactor(user.ID, reauth(r, req.Password))
+	if err != nil {
+		s.handleTwoFactorErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, twoFactorSetupResp{Secret: setup.Secret, OTPAuthURL: setup.URL})
+}
+
+type recoveryCodesResp struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (s *Server) enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	var req twoFactorReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	codes, err := s.store.EnableTwoFactor(user.ID, reauth(r, req.Password), req.Code)
+	if err != nil {
+		s.handleTwoFactorErr(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, recoveryCodesResp{RecoveryCodes: codes})
+}
+
+func (s *Server) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromRequest(r)
+	var req twoFactorReq
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.store.DisableTwoFactor(user.ID, reauth(r, req.Password)); err != nil {
+		s.handleTwoFactorErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reauth confirms a change with password, or with the request's session for
+// accounts that have no password.
+func reauth(r *http.Request, password string) store.Reauth {
+	sess, _ := sessionFromRequest(r)
+	return store.Reauth{Password: password, Session: sess.ID}
+}
+
+func (s *Server) handleTwoFactorErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrReauthRequired):
+		respondError(w, http.StatusForbidden, "sign in again to confirm this change")
+	case errors.Is(err, store.ErrUnauthorized):
+		respondError(w, http.StatusForbidden, "invalid password or code")
+	case errors.Is(err, store.ErrConflict):
+		respondError(w, http.StatusConflict, "two-factor authentication is already enabled")
+	default:
+		s.handleStoreErr(w, err)
+	}
+}
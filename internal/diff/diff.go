@@ -0,0 +1,175 @@
+// Package diff compares two texts line by line or word by word.
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Edit is a run of text both texts share, or one only the new text has
+// (Insert) or only the old one (Delete). Applying the Equal and Insert runs
+// in order gives the new text; the Equal and Delete runs give the old one.
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxEdits bounds the work spent on texts that differ a lot. Past it the
+// part between their common prefix and suffix is reported as one deletion
+// followed by one insertion.
+const maxEdits = 1000
+
+// Lines diffs a and b by lines, each with its trailing newline.
+func Lines(a, b string) []Edit {
+	return diff(splitLines(a), splitLines(b))
+}
+
+// Words diffs a and b by words, treating each run of whitespace between them
+// as a token of its own.
+func Words(a, b string) []Edit {
+	return diff(splitWords(a), splitWords(b))
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func splitWords(s string) []string {
+	var words []string
+	start, space := 0, false
+	for i, r := range s {
+		if unicode.IsSpace(r) != space && i > start {
+			words = append(words, s[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+func diff(a, b []string) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var out edits
+	out.add(Equal, a[:prefix]...)
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if mid, ok := myers(midA, midB); ok {
+		for _, e := range mid {
+			out.add(e.Op, e.Text)
+		}
+	} else {
+		out.add(Delete, midA...)
+		out.add(Insert, midB...)
+	}
+	out.add(Equal, a[len(a)-suffix:]...)
+	if out == nil {
+		return []Edit{}
+	}
+	return out
+}
+
+// edits merges consecutive tokens with the same op into one Edit.
+type edits []Edit
+
+func (es *edits) add(op Op, tokens ...string) {
+	for _, t := range tokens {
+		if n := len(*es); n > 0 && (*es)[n-1].Op == op {
+			(*es)[n-1].Text += t
+			continue
+		}
+		*es = append(*es, Edit{Op: op, Text: t})
+	}
+}
+
+// myers finds a shortest edit script from a to b with Myers' O(ND)
+// algorithm, one token per Edit. It gives up once the script would be
+// longer than maxEdits.
+func myers(a, b []string) ([]Edit, bool) {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace[d] holds v[-d..d] after step d, for walking the path back.
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+				return backtrack(a, b, trace), true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	return nil, false
+}
+
+func backtrack(a, b []string, trace [][]int) []Edit {
+	at := func(d, k int) int { return trace[d][k+d] }
+	x, y := len(a), len(b)
+	var rev []Edit
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(d-1, k-1) < at(d-1, k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(d-1, prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, Edit{Equal, a[x]})
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, Edit{Insert, b[y]})
+		} else {
+			x--
+			rev = append(rev, Edit{Delete, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rev = append(rev, Edit{Equal, a[x]})
+	}
+	res := make([]Edit, len(rev))
+	for i, e := range rev {
+		res[len(rev)-1-i] = e
+	}
+	return res
+}
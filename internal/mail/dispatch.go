@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"novella/internal/model"
+	"novella/internal/store"
+)
+
+const (
+	batchSize   = 50
+	sendTimeout = 30 * time.Second
+	maxAttempts = 8
+	maxBackoff  = 6 * time.Hour
+	keepSent    = 7 * 24 * time.Hour
+)
+
+// Dispatcher delivers queued outbox messages. Failed sends are retried with
+// exponential backoff and given up after maxAttempts.
+type Dispatcher struct {
+	outbox store.Outbox
+	mailer Mailer
+	wake   chan struct{}
+}
+
+func NewDispatcher(outbox store.Outbox, mailer Mailer) *Dispatcher {
+	return &Dispatcher{outbox: outbox, mailer: mailer, wake: make(chan struct{}, 1)}
+}
+
+// Notify asks Run to deliver queued mail now rather than at the next tick.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) Run(every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		d.Flush()
+		if n, err := d.outbox.PruneMail(time.Now().Add(-keepSent)); err != nil {
+			log.Printf("mail: prune failed: %v", err)
+		} else if n > 0 {
+			log.Printf("mail: pruned %d old messages", n)
+		}
+		select {
+		case <-tick.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// Flush sends every message that is due.
+func (d *Dispatcher) Flush() {
+	for {
+		due, err := d.outbox.DueMail(time.Now(), batchSize)
+		if err != nil {
+			log.Printf("mail: reading outbox failed: %v", err)
+			return
+		}
+		for _, m := range due {
+			d.deliver(m)
+		}
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(m model.OutboxMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	err := d.mailer.Send(ctx, Message{To: m.To, Subject: m.Subject, Body: m.Body})
+	cancel()
+	if err == nil {
+		if err := d.outbox.MarkMailSent(m.ID, time.Now()); err != nil {
+			log.Printf("mail: marking message %d sent failed: %v", m.ID, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if m.Attempts+1 < maxAttempts {
+		at := time.Now().Add(min(time.Minute<<m.Attempts, maxBackoff))
+		retryAt = &at
+		log.Printf("mail: sending message %d failed (attempt %d): %v", m.ID, m.Attempts+1, err)
+	} else {
+		log.Printf("mail: giving up on message %d after %d attempts: %v", m.ID, m.Attempts+1, err)
+	}
+	if err := d.outbox.MarkMailFailed(m.ID, err.Error(), retryAt); err != nil {
+		log.Printf("mail: recording failure of message %d failed: %v", m.ID, err)
+	}
+}
@@ -1,14 +1,209 @@
 package model
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Role decides what a user may do beyond their own account; each role has
+// the permissions of the ones before it.
+type Role string
+
+const (
+	RoleReader    Role = "reader"
+	RoleAuthor    Role = "author"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
 
+func (r Role) Valid() bool {
+	switch r {
+	case RoleReader, RoleAuthor, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// User is an account. With two-factor authentication enabled, TOTPSecret
+// holds the authenticator secret and RecoveryCodes the digests of the unused
+// recovery codes; TOTPPending is a secret handed out during enrollment that
+// has not been confirmed with a code yet.
+// FailedLogins counts recent wrong passwords; enough of them lock the account
+// until LockedUntil.
 type User struct {
-	ID           int64     `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordSalt string    `json:"-"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID               int64      `json:"id"`
+	Username         string     `json:"username"`
+	Email            string     `json:"email"`
+	Role             Role       `json:"role"`
+	DisplayName      string     `json:"display_name"`
+	Bio              string     `json:"bio"`
+	AvatarURL        string     `json:"avatar_url"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	PasswordSalt     string     `json:"-"`
+	PasswordHash     string     `json:"-"`
+	TOTPSecret       string     `json:"-"`
+	TOTPPending      string     `json:"-"`
+	TOTPLastStep     int64      `json:"-"`
+	RecoveryCodes    []string   `json:"-"`
+	FailedLogins     int        `json:"-"`
+	LastFailedLogin  *time.Time `json:"-"`
+	LockedUntil      *time.Time `json:"locked_until,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Profile is the part of a user anyone may see.
+type Profile struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (u User) Profile() Profile {
+	return Profile{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarURL:   u.AvatarURL,
+		CreatedAt:   u.CreatedAt,
+	}
+}
+
+type TokenPurpose string
+
+const (
+	TokenPasswordReset  TokenPurpose = "password_reset"
+	TokenVerifyEmail    TokenPurpose = "verify_email"
+	TokenLoginChallenge TokenPurpose = "login_challenge"
+)
+
+// UserToken is a single-use token issued to a user, either sent by email or
+// returned by a login that still needs a second factor. Email is the address
+// the user had when it was issued, so a token does not carry over to an
+// address the user switched to afterwards. Attempts counts failed redemptions.
+type UserToken struct {
+	TokenHash string       `json:"-"`
+	UserID    int64        `json:"user_id"`
+	Purpose   TokenPurpose `json:"purpose"`
+	Email     string       `json:"email"`
+	Attempts  int          `json:"attempts,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+type MailStatus string
+
+const (
+	MailPending MailStatus = "pending"
+	MailSent    MailStatus = "sent"
+	MailFailed  MailStatus = "failed"
+)
+
+// OutboxMessage is an email waiting to be delivered or the record of one.
+// The body is cleared once the message leaves the pending state, since it may
+// hold a token.
+type OutboxMessage struct {
+	ID            int64      `json:"id"`
+	To            string     `json:"to"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body,omitempty"`
+	Status        MailStatus `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// Identity links a user to an account at an external OpenID Connect
+// provider, which knows the user by Subject.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Scope is a permission granted to an API key: a resource and whether the
+// key may read or also change it.
+type Scope string
+
+const (
+	ScopeProfileRead    Scope = "profile:read"
+	ScopeNovelsRead     Scope = "novels:read"
+	ScopeNovelsWrite    Scope = "novels:write"
+	ScopeChaptersRead   Scope = "chapters:read"
+	ScopeChaptersWrite  Scope = "chapters:write"
+	ScopeCommentsRead   Scope = "comments:read"
+	ScopeCommentsWrite  Scope = "comments:write"
+	ScopeBookmarksRead  Scope = "bookmarks:read"
+	ScopeBookmarksWrite Scope = "bookmarks:write"
+)
+
+var Scopes = []Scope{
+	ScopeProfileRead,
+	ScopeNovelsRead, ScopeNovelsWrite,
+	ScopeChaptersRead, ScopeChaptersWrite,
+	ScopeCommentsRead, ScopeCommentsWrite,
+	ScopeBookmarksRead, ScopeBookmarksWrite,
+}
+
+func (s Scope) Valid() bool {
+	return slices.Contains(Scopes, s)
+}
+
+// APIKey lets a script act as its user without a session. Only a digest of
+// the key is stored; Prefix is its first characters, to tell keys apart.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-"`
+	Scopes     []Scope    `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// Allows reports whether the key grants scope. A write scope includes
+// reading the same resource.
+func (k APIKey) Allows(scope Scope) bool {
+	if slices.Contains(k.Scopes, scope) {
+		return true
+	}
+	resource, ok := strings.CutSuffix(string(scope), ":read")
+	return ok && slices.Contains(k.Scopes, Scope(resource+":write"))
+}
+
+// Session is one login on one device. The bearer token it currently accepts
+// expires at AccessExpiresAt and is replaced through a refresh token; the
+// session itself lives until ExpiresAt, which slides with use.
+type Session struct {
+	ID              string    `json:"id"`
+	UserID          int64     `json:"user_id"`
+	TokenHash       string    `json:"-"`
+	Device          string    `json:"device"`
+	UserAgent       string    `json:"user_agent"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastSeenAt      time.Time `json:"last_seen_at"`
+	AccessExpiresAt time.Time `json:"access_expires_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+// RefreshToken is one link in a session's chain of refresh tokens. A token
+// is used once; presenting it again revokes the session.
+type RefreshToken struct {
+	TokenHash string     `json:"-"`
+	SessionID string     `json:"session_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
 }
 
 type NovelStatus string
@@ -18,6 +213,8 @@ const (
 	NovelPublished NovelStatus = "published"
 )
 
+// Novel is a draft or a published novel. A draft with PublishAt set is
+// published at that time.
 type Novel struct {
 	ID          int64       `json:"id"`
 	AuthorID    int64       `json:"author_id"`
@@ -25,18 +222,89 @@ type Novel struct {
 	Description string      `json:"description"`
 	Genre       string      `json:"genre"`
 	Status      NovelStatus `json:"status"`
+	PublishAt   *time.Time  `json:"publish_at,omitempty"`
 	CreatedAt   time.Time   `json:"created_at"`
 	UpdatedAt   time.Time   `json:"updated_at"`
 }
 
+// ChapterStatus decides who sees a chapter of a novel they can read: a
+// published chapter is listed for everyone, an unlisted one is only reached
+// by its ID, and a draft is seen by nobody but those who may read drafts.
+type ChapterStatus string
+
+const (
+	ChapterDraft     ChapterStatus = "draft"
+	ChapterPublished ChapterStatus = "published"
+	ChapterUnlisted  ChapterStatus = "unlisted"
+)
+
+func (s ChapterStatus) Valid() bool {
+	switch s {
+	case ChapterDraft, ChapterPublished, ChapterUnlisted:
+		return true
+	}
+	return false
+}
+
+// ContentFormat is the markup a chapter's content is written in. Chapters
+// are stored as plain text or Markdown; FormatHTML only marks content
+// rendered for a reader.
+type ContentFormat string
+
+const (
+	FormatPlain    ContentFormat = "plain"
+	FormatMarkdown ContentFormat = "markdown"
+	FormatHTML     ContentFormat = "html"
+)
+
+func (f ContentFormat) Valid() bool {
+	return f == FormatPlain || f == FormatMarkdown
+}
+
+// Chapter is part of a novel. An unpublished chapter with PublishAt set is
+// published at that time.
 type Chapter struct {
-	ID        int64     `json:"id"`
+	ID        int64         `json:"id"`
+	NovelID   int64         `json:"novel_id"`
+	Title     string        `json:"title"`
+	Content   string        `json:"content"`
+	Format    ContentFormat `json:"format"`
+	Position  int           `json:"position"`
+	Status    ChapterStatus `json:"status"`
+	PublishAt *time.Time    `json:"publish_at,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// Revision is one saved version of a chapter's content. Revisions are
+// numbered from 1 per chapter; RestoredFrom is set on a revision that brought
+// back an earlier one. AuthorID is nil once the author has deleted their
+// account.
+type Revision struct {
+	ChapterID    int64     `json:"chapter_id"`
+	Number       int       `json:"number"`
+	AuthorID     *int64    `json:"author_id"`
+	Content      string    `json:"content,omitempty"`
+	Words        int       `json:"words"`
+	RestoredFrom *int      `json:"restored_from,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type EventType string
+
+const (
+	EventNovelPublished   EventType = "novel.published"
+	EventChapterPublished EventType = "chapter.published"
+)
+
+// Event reports a scheduled novel or chapter going live. ChapterID is 0 for
+// novels.
+type Event struct {
+	Type      EventType `json:"type"`
 	NovelID   int64     `json:"novel_id"`
+	ChapterID int64     `json:"chapter_id,omitempty"`
 	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	Position  int       `json:"position"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	At        time.Time `json:"at"`
 }
 
 type Comment struct {
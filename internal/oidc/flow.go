@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	flowTTL    = 10 * time.Minute
+	maxPending = 10000
+)
+
+var errTooManyFlows = errors.New("too many sign-ins in progress")
+
+// Flow is an authorization request waiting for its code. UserID is set when
+// a signed-in user is linking the identity rather than signing in with it.
+type Flow struct {
+	Provider  string
+	Verifier  string
+	Nonce     string
+	UserID    int64
+	ExpiresAt time.Time
+}
+
+// Flows holds the flows in progress, keyed by their state parameter. They
+// are kept in memory; a restart only cancels the sign-ins under way.
+type Flows struct {
+	mu      sync.Mutex
+	pending map[string]Flow
+}
+
+func NewFlows() *Flows {
+	return &Flows{pending: make(map[string]Flow)}
+}
+
+// Begin starts a flow with p and returns the URL to send the user to along
+// with the state that identifies the flow.
+func (f *Flows) Begin(ctx context.Context, p *Provider, userID int64) (string, Flow, string, error) {
+	state, err := NewVerifier()
+	if err != nil {
+		return "", Flow{}, "", err
+	}
+	verifier, err := NewVerifier()
+	if err != nil {
+		return "", Flow{}, "", err
+	}
+	nonce, err := NewVerifier()
+	if err != nil {
+		return "", Flow{}, "", err
+	}
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", Flow{}, "", err
+	}
+	flow := Flow{Provider: p.Name, Verifier: verifier, Nonce: nonce, UserID: userID, ExpiresAt: time.Now().Add(flowTTL)}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pending) >= maxPending {
+		f.pruneLocked(time.Now())
+		if len(f.pending) >= maxPending {
+			return "", Flow{}, "", errTooManyFlows
+		}
+	}
+	f.pending[state] = flow
+	return authURL, flow, state, nil
+}
+
+// Take removes and returns the flow for state; each state is good for one
+// callback.
+func (f *Flows) Take(state string) (Flow, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	flow, ok := f.pending[state]
+	delete(f.pending, state)
+	if !ok || !time.Now().Before(flow.ExpiresAt) {
+		return Flow{}, false
+	}
+	return flow, true
+}
+
+func (f *Flows) pruneLocked(now time.Time) {
+	for state, flow := range f.pending {
+		if !now.Before(flow.ExpiresAt) {
+			delete(f.pending, state)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the provider's clock may be off when checking exp
+// and iat.
+const clockSkew = time.Minute
+
+var errInvalidToken = errors.New("invalid id token")
+
+// Claims are the ID token claims novella uses.
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// audience accepts both forms of the aud claim: a string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// flexBool accepts true and "true"; some providers send email_verified as a
+// string.
+type flexBool bool
+
+func (f *flexBool) UnmarshalJSON(b []byte) error {
+	switch strings.Trim(string(b), `"`) {
+	case "true":
+		*f = true
+	case "false", "null", "":
+		*f = false
+	default:
+		return fmt.Errorf("invalid boolean %s", b)
+	}
+	return nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwk is a public key from a JWKS document. Only RSA and P-256 keys are
+// understood; others are skipped.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || n.BitLen() < 2048 {
+			return nil, errors.New("unsupported rsa key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// parseJWT splits a compact JWS and decodes its header, without verifying
+// anything.
+func parseJWT(token string) (jwtHeader, []byte, []byte, []byte, error) {
+	var h jwtHeader
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return h, nil, nil, nil, errInvalidToken
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return h, nil, nil, nil, errInvalidToken
+	}
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return h, nil, nil, nil, errInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return h, nil, nil, nil, errInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return h, nil, nil, nil, errInvalidToken
+	}
+	return h, []byte(parts[0] + "." + parts[1]), payload, sig, nil
+}
+
+// verifySignature checks sig over signed with key. The algorithm must match
+// the key type, so a token cannot pick a weaker check than the key implies.
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	sum := sha256.Sum256(signed)
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errInvalidToken
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+			return errInvalidToken
+		}
+		return nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return errInvalidToken
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, sum[:], r, s) {
+			return errInvalidToken
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", errInvalidToken, alg)
+	}
+}
+
+// validate checks the registered claims of a verified token.
+func (c Claims) validate(issuer, clientID, nonce string, now time.Time) error {
+	if c.Issuer != issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", errInvalidToken, c.Issuer)
+	}
+	found := false
+	for _, aud := range c.Audience {
+		if aud == clientID {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: not issued for this client", errInvalidToken)
+	}
+	if len(c.Audience) > 1 && c.AuthorizedBy != clientID {
+		return fmt.Errorf("%w: not issued for this client", errInvalidToken)
+	}
+	if c.Subject == "" {
+		return fmt.Errorf("%w: missing subject", errInvalidToken)
+	}
+	if !now.Before(time.Unix(c.Expiry, 0).Add(clockSkew)) {
+		return fmt.Errorf("%w: expired", errInvalidToken)
+	}
+	if time.Unix(c.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("%w: issued in the future", errInvalidToken)
+	}
+	if c.Nonce != nonce {
+		return fmt.Errorf("%w: nonce mismatch", errInvalidToken)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Per, in bursts of up to Requests. The zero
+// Limit allows everything.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// ParseLimit reads a limit written as requests/period, where the period is
+// s, m, h or a duration such as 30s: "10/m" is ten requests a minute. "0"
+// and "off" mean unlimited.
+func ParseLimit(v string) (Limit, error) {
+	v = strings.TrimSpace(v)
+	if v == "0" || v == "off" {
+		return Limit{}, nil
+	}
+	n, period, ok := strings.Cut(v, "/")
+	requests, err := strconv.Atoi(strings.TrimSpace(n))
+	if !ok || err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: want requests/period, e.g. 10/m", v)
+	}
+	var per time.Duration
+	switch period = strings.TrimSpace(period); period {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		if per, err = time.ParseDuration(period); err != nil || per <= 0 {
+			return Limit{}, fmt.Errorf("invalid rate limit period %q", period)
+		}
+	}
+	return Limit{Requests: requests, Per: per}, nil
+}
+
+// Result describes a key's bucket after a request. Reset is how long until
+// the bucket is full again; RetryAfter, for a refused request, how long
+// until the next one is allowed.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter keeps a token bucket per key. Each bucket holds up to
+// Limit.Requests tokens, refills continuously over Limit.Per, and every
+// allowed request takes one token.
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	per    time.Duration
+}
+
+// pruneEvery is how often full buckets are dropped; a missing bucket is the
+// same as a full one.
+const pruneEvery = time.Minute
+
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from key's bucket under limit, if there is one.
+func (l *Limiter) Allow(key string, limit Limit, now time.Time) Result {
+	if limit.Unlimited() {
+		return Result{Allowed: true}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastPrune) > pruneEvery {
+		l.pruneLocked(now)
+	}
+
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Per.Seconds()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity}
+		l.buckets[key] = b
+	} else {
+		b.tokens = min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last, b.per = now, limit.Per
+
+	res := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((capacity - b.tokens) / rate)
+	return res
+}
+
+func (l *Limiter) pruneLocked(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.per {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
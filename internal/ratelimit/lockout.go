@@ -0,0 +1,91 @@
+// Package ratelimit slows down clients that fail or call too often.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Backoff is how long the n-th failure past the free allowance locks out
+// for, counting from zero: base, doubling with each failure up to max.
+func Backoff(n int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	return min(d, max)
+}
+
+// Lockout counts failures per key, such as a client address. After Free
+// failures every further one locks the key out for Backoff. Failures are
+// forgotten once a key has gone Window without one.
+type Lockout struct {
+	Free   int
+	Base   time.Duration
+	Max    time.Duration
+	Window time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*lockEntry
+	lastPrune time.Time
+}
+
+type lockEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func NewLockout(free int, base, max, window time.Duration) *Lockout {
+	return &Lockout{Free: free, Base: base, Max: max, Window: window, entries: make(map[string]*lockEntry)}
+}
+
+// Locked reports whether key is locked out at now, and until when.
+func (l *Lockout) Locked(key string, now time.Time) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok || !now.Before(e.lockedUntil) {
+		return time.Time{}, false
+	}
+	return e.lockedUntil, true
+}
+
+// Fail records a failure for key and returns when the lockout it causes
+// ends, or the zero time if it causes none.
+func (l *Lockout) Fail(key string, now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastPrune) > l.Window {
+		l.pruneLocked(now)
+	}
+	e, ok := l.entries[key]
+	if !ok || now.Sub(e.lastFailure) > l.Window {
+		e = &lockEntry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+	if e.failures <= l.Free {
+		return time.Time{}
+	}
+	e.lockedUntil = now.Add(Backoff(e.failures-l.Free-1, l.Base, l.Max))
+	return e.lockedUntil
+}
+
+func (l *Lockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// pruneLocked drops the keys whose failures have been forgotten, so the map
+// only holds recently failing clients.
+func (l *Lockout) pruneLocked(now time.Time) {
+	for key, e := range l.entries {
+		if now.Sub(e.lastFailure) > l.Window && !now.Before(e.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+	l.lastPrune = now
+}
@@ -0,0 +1,749 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Markdown renders src as HTML made of the allowed tags only. It covers the
+// common core of CommonMark: ATX and setext headings, paragraphs with hard
+// line breaks, block quotes, bullet and ordered lists, fenced and indented
+// code, thematic breaks, emphasis, ~~strikethrough~~, code spans, links,
+// images and autolinks. Of raw HTML only the attribute-free authorTags are
+// kept.
+func Markdown(src string) string {
+	lines := strings.Split(normalizeNewlines(src), "\n")
+	for i, line := range lines {
+		lines[i] = expandIndent(line)
+	}
+	var b strings.Builder
+	writeBlocks(&b, lines, false)
+	return sanitize(b.String())
+}
+
+// expandIndent turns the tabs in line's indentation into spaces, to tab
+// stops of 4.
+func expandIndent(line string) string {
+	end := len(line) - len(strings.TrimLeft(line, " \t"))
+	if !strings.Contains(line[:end], "\t") {
+		return line
+	}
+	col := 0
+	for _, c := range line[:end] {
+		if c == '\t' {
+			col += 4 - col%4
+		} else {
+			col++
+		}
+	}
+	return strings.Repeat(" ", col) + line[end:]
+}
+
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func blank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+var (
+	atxHeading    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	thematicBreak = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	setextLine    = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fenceOpen     = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})(.*)$")
+	quoteMarker   = regexp.MustCompile(`^ {0,3}> ?`)
+	listMarker    = regexp.MustCompile(`^( {0,3})([-+*]|[0-9]{1,9}[.)])( +|$)`)
+)
+
+type fence struct {
+	indent int
+	marker string
+}
+
+func openFence(line string) (fence, bool) {
+	m := fenceOpen.FindStringSubmatch(line)
+	if m == nil || m[2][0] == '`' && strings.Contains(m[3], "`") {
+		return fence{}, false
+	}
+	return fence{len(m[1]), m[2]}, true
+}
+
+func (f fence) closedBy(line string) bool {
+	t := strings.TrimRight(line, " \t")
+	return indent(t) < 4 && strings.HasPrefix(strings.TrimLeft(t, " "), f.marker) &&
+		strings.Trim(strings.TrimLeft(t, " "), f.marker[:1]) == ""
+}
+
+// item is the start of a list item: its marker and the indentation of its
+// content.
+type item struct {
+	bullet  byte // '-', '+' or '*', or the '.' or ')' after an ordered number
+	ordered bool
+	start   int
+	width   int
+	empty   bool
+}
+
+func listItem(line string) (item, bool) {
+	m := listMarker.FindStringSubmatch(line)
+	if m == nil {
+		return item{}, false
+	}
+	it := item{bullet: m[2][len(m[2])-1], width: len(m[0]), empty: blank(line[len(m[0]):])}
+	if len(m[2]) > 1 || m[2][0] >= '0' && m[2][0] <= '9' {
+		it.ordered = true
+		it.start, _ = strconv.Atoi(m[2][:len(m[2])-1])
+	}
+	if len(m[3]) > 4 {
+		it.width = len(m[1]) + len(m[2]) + 1
+	} else if m[3] == "" {
+		it.width++
+	}
+	return it, true
+}
+
+func (it item) sameList(other item) bool {
+	return it.ordered == other.ordered && it.bullet == other.bullet
+}
+
+// interrupts reports whether line starts a block that ends a paragraph
+// before it.
+func interrupts(line string) bool {
+	if _, ok := openFence(line); ok {
+		return true
+	}
+	if atxHeading.MatchString(line) || thematicBreak.MatchString(line) || quoteMarker.MatchString(line) {
+		return true
+	}
+	it, ok := listItem(line)
+	return ok && !it.empty && (!it.ordered || it.start == 1)
+}
+
+// writeBlocks renders lines as a sequence of blocks. In a tight list item
+// paragraphs go without <p>.
+func writeBlocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if blank(line) {
+			i++
+			continue
+		}
+		if f, ok := openFence(line); ok {
+			i = writeFenced(b, lines, i, f)
+			continue
+		}
+		if indent(line) >= 4 {
+			i = writeIndented(b, lines, i)
+			continue
+		}
+		if m := atxHeading.FindStringSubmatch(line); m != nil {
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + inline(strings.TrimSpace(m[2]), inText) + "</h" + level + ">\n")
+			i++
+			continue
+		}
+		if thematicBreak.MatchString(line) {
+			b.WriteString("<hr>\n")
+			i++
+			continue
+		}
+		if quoteMarker.MatchString(line) {
+			i = writeQuote(b, lines, i)
+			continue
+		}
+		if it, ok := listItem(line); ok {
+			i = writeList(b, lines, i, it)
+			continue
+		}
+		i = writeParagraph(b, lines, i, tight)
+	}
+}
+
+func writeFenced(b *strings.Builder, lines []string, i int, f fence) int {
+	b.WriteString("<pre><code>")
+	for i++; i < len(lines); i++ {
+		if f.closedBy(lines[i]) {
+			i++
+			break
+		}
+		line := lines[i]
+		line = line[min(f.indent, indent(line)):]
+		b.WriteString(html.EscapeString(line) + "\n")
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+func writeIndented(b *strings.Builder, lines []string, i int) int {
+	var code []string
+	for ; i < len(lines) && (blank(lines[i]) || indent(lines[i]) >= 4); i++ {
+		code = append(code, lines[i][min(4, len(lines[i])):])
+	}
+	for len(code) > 0 && blank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+	b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "\n</code></pre>\n")
+	return i
+}
+
+// writeQuote renders the block quote starting at lines[i]. Lines without the
+// marker that carry on a paragraph belong to it too.
+func writeQuote(b *strings.Builder, lines []string, i int) int {
+	var inner []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if loc := quoteMarker.FindStringIndex(line); loc != nil {
+			inner = append(inner, line[loc[1]:])
+			continue
+		}
+		if blank(line) || len(inner) == 0 || blank(inner[len(inner)-1]) || interrupts(line) {
+			break
+		}
+		inner = append(inner, line)
+	}
+	b.WriteString("<blockquote>\n")
+	writeBlocks(b, inner, false)
+	b.WriteString("</blockquote>\n")
+	return i
+}
+
+// writeList renders the list whose first item, first, starts at lines[i].
+// The list is loose, its paragraphs wrapped in <p>, when a blank line
+// separates its items or the blocks within one.
+func writeList(b *strings.Builder, lines []string, i int, first item) int {
+	var items [][]string
+	loose := false
+	it := first
+	for {
+		body := []string{lines[i][min(it.width, len(lines[i])):]}
+		i++
+		for i < len(lines) {
+			line := lines[i]
+			if blank(line) {
+				j := i
+				for j < len(lines) && blank(lines[j]) {
+					j++
+				}
+				if j == len(lines) || indent(lines[j]) < it.width {
+					break
+				}
+				if len(body) == 1 && blank(body[0]) {
+					break
+				}
+				for ; i < j; i++ {
+					body = append(body, "")
+				}
+				loose = true
+				continue
+			}
+			if indent(line) >= it.width {
+				body = append(body, line[it.width:])
+				i++
+				continue
+			}
+			if _, ok := listItem(line); ok || blank(body[len(body)-1]) || interrupts(line) {
+				break
+			}
+			body = append(body, line)
+			i++
+		}
+		items = append(items, body)
+
+		j := i
+		for j < len(lines) && blank(lines[j]) {
+			j++
+		}
+		next, ok := item{}, false
+		if j < len(lines) && indent(lines[j]) < 4 {
+			next, ok = listItem(lines[j])
+		}
+		if !ok || !next.sameList(first) || thematicBreak.MatchString(lines[j]) {
+			break
+		}
+		if j > i {
+			loose = true
+		}
+		i, it = j, next
+	}
+
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if first.ordered && first.start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(first.start) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, body := range items {
+		var inner strings.Builder
+		writeBlocks(&inner, body, !loose)
+		b.WriteString("<li>" + strings.TrimSuffix(inner.String(), "\n") + "</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// writeParagraph renders the paragraph starting at lines[i], or the setext
+// heading it turns out to be.
+func writeParagraph(b *strings.Builder, lines []string, i int, tight bool) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if m := setextLine.FindStringSubmatch(line); m != nil && len(text) > 0 {
+			level := "2"
+			if m[1][0] == '=' {
+				level = "1"
+			}
+			b.WriteString("<h" + level + ">" + inline(strings.TrimSpace(strings.Join(text, "\n")), inText) + "</h" + level + ">\n")
+			return i + 1
+		}
+		if blank(line) || len(text) > 0 && interrupts(line) {
+			break
+		}
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+	content := inline(strings.TrimRight(strings.Join(text, "\n"), " \t"), inText)
+	if tight {
+		b.WriteString(content + "\n")
+	} else {
+		b.WriteString("<p>" + content + "</p>\n")
+	}
+	return i
+}
+
+// delim is a run of emphasis characters in inline text. Once runs are
+// matched up, opens and closes hold the tags they stand for.
+type delim struct {
+	char              byte
+	n, orig           int
+	canOpen, canClose bool
+	opens, closes     []string
+}
+
+// span is a piece of rendered inline HTML, or a delimiter run.
+type span struct {
+	html  string
+	delim *delim
+}
+
+var (
+	autolink    = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+	emailLink   = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	rawTag      = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9]*)(?:\s[^<>]*)?/?>`)
+	entityRef   = regexp.MustCompile(`^&(?:[a-zA-Z][a-zA-Z0-9]{1,31}|#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6});`)
+	punctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+)
+
+// scope is what inline text sits in: links do not nest, and an image's
+// description holds neither links nor images.
+type scope int
+
+const (
+	inText scope = iota
+	inLink
+	inImage
+)
+
+// inline renders the text of a paragraph or heading.
+func inline(s string, sc scope) string {
+	var spans []span
+	var text []byte
+	flush := func() {
+		if len(text) > 0 {
+			spans = append(spans, span{html: string(text)})
+			text = text[:0]
+		}
+	}
+	brackets := matchBrackets(s)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			text = append(text, "<br>\n"...)
+			i += 2
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(punctuation, s[i+1]) >= 0:
+			text = append(text, html.EscapeString(s[i+1:i+2])...)
+			i += 2
+		case c == '`':
+			n := runLength(s, i, '`')
+			if end := closingBackticks(s, i+n, n); end >= 0 {
+				text = append(text, "<code>"+html.EscapeString(codeSpan(s[i+n:end]))+"</code>"...)
+				i = end + n
+			} else {
+				text = append(text, s[i:i+n]...)
+				i += n
+			}
+		case c == '*' || c == '_' || c == '~':
+			n := runLength(s, i, c)
+			if c == '~' && n != 2 {
+				text = append(text, s[i:i+n]...)
+				i += n
+				break
+			}
+			flush()
+			spans = append(spans, span{delim: newDelim(s, i, n)})
+			i += n
+		case c == '!' && i+1 < len(s) && s[i+1] == '[' && sc != inImage:
+			if out, end, ok := image(s, i+1, brackets[i+1]); ok {
+				text = append(text, out...)
+				i = end
+			} else {
+				text = append(text, '!')
+				i++
+			}
+		case c == '[' && sc == inText:
+			if out, end, ok := link(s, i, brackets[i]); ok {
+				flush()
+				spans = append(spans, span{html: out})
+				i = end
+			} else {
+				text = append(text, '[')
+				i++
+			}
+		case c == '<':
+			out, n := angle(s[i:])
+			text = append(text, out...)
+			i += n
+		case c == '&':
+			if m := entityRef.FindString(s[i:]); m != "" && html.UnescapeString(m) != m {
+				text = append(text, m...)
+				i += len(m)
+			} else {
+				text = append(text, "&amp;"...)
+				i++
+			}
+		case c == '\n':
+			n := 0
+			for n < len(text) && text[len(text)-1-n] == ' ' {
+				n++
+			}
+			text = text[:len(text)-n]
+			if n >= 2 {
+				text = append(text, "<br>"...)
+			}
+			text = append(text, '\n')
+			i++
+			for i < len(s) && s[i] == ' ' {
+				i++
+			}
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			text = append(text, html.EscapeString(s[i:i+size])...)
+			i += size
+		}
+	}
+	flush()
+	matchEmphasis(spans)
+
+	var b strings.Builder
+	for _, sp := range spans {
+		if d := sp.delim; d != nil {
+			b.WriteString(strings.Join(d.closes, ""))
+			b.WriteString(strings.Repeat(string(d.char), d.n))
+			b.WriteString(strings.Join(d.opens, ""))
+			continue
+		}
+		b.WriteString(sp.html)
+	}
+	return b.String()
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// closingBackticks finds the run of exactly n backticks that closes a code
+// span whose content starts at from.
+func closingBackticks(s string, from, n int) int {
+	for i := from; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		m := runLength(s, i, '`')
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
+
+func codeSpan(code string) string {
+	code = strings.ReplaceAll(code, "\n", " ")
+	if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+		code = code[1 : len(code)-1]
+	}
+	return code
+}
+
+// newDelim classifies the run of n delimiters at s[i] by what surrounds it,
+// following CommonMark's flanking rules.
+func newDelim(s string, i, n int) *delim {
+	before, after := ' ', ' '
+	if i > 0 {
+		before, _ = utf8.DecodeLastRuneInString(s[:i])
+	}
+	if i+n < len(s) {
+		after, _ = utf8.DecodeRuneInString(s[i+n:])
+	}
+	isPunct := func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) }
+	left := !unicode.IsSpace(after) && (!isPunct(after) || unicode.IsSpace(before) || isPunct(before))
+	right := !unicode.IsSpace(before) && (!isPunct(before) || unicode.IsSpace(after) || isPunct(after))
+	d := &delim{char: s[i], n: n, orig: n, canOpen: left, canClose: right}
+	if d.char == '_' {
+		d.canOpen = left && (!right || isPunct(before))
+		d.canClose = right && (!left || isPunct(after))
+	}
+	return d
+}
+
+// matchEmphasis pairs each closing delimiter run with the nearest opening
+// one of the same character, the way CommonMark does. Runs left between a
+// matched pair can no longer match; floors remember how far down the stack a
+// kind of closer already looked in vain, so long texts stay linear.
+func matchEmphasis(spans []span) {
+	type kind struct {
+		char    byte
+		mod     int
+		canOpen bool
+	}
+	var stack []*delim
+	floors := map[kind]int{}
+	truncate := func(n int) {
+		stack = stack[:n]
+		for k, f := range floors {
+			floors[k] = min(f, n)
+		}
+	}
+	for _, sp := range spans {
+		closer := sp.delim
+		if closer == nil {
+			continue
+		}
+		for closer.canClose && closer.n > 0 {
+			k := kind{closer.char, closer.orig % 3, closer.canOpen}
+			at := -1
+			for j := len(stack) - 1; j >= floors[k]; j-- {
+				opener := stack[j]
+				if opener.char != closer.char {
+					continue
+				}
+				if (opener.canClose || closer.canOpen) && (opener.orig+closer.orig)%3 == 0 &&
+					(opener.orig%3 != 0 || closer.orig%3 != 0) {
+					continue
+				}
+				at = j
+				break
+			}
+			if at < 0 {
+				floors[k] = len(stack)
+				break
+			}
+			opener := stack[at]
+			use, tag := 1, "em"
+			switch {
+			case closer.char == '~':
+				use, tag = 2, "del"
+			case opener.n >= 2 && closer.n >= 2:
+				use, tag = 2, "strong"
+			}
+			opener.n -= use
+			closer.n -= use
+			opener.opens = slices.Insert(opener.opens, 0, "<"+tag+">")
+			closer.closes = append(closer.closes, "</"+tag+">")
+			if opener.n == 0 {
+				truncate(at)
+			} else {
+				truncate(at + 1)
+			}
+		}
+		if closer.canOpen && closer.n > 0 {
+			stack = append(stack, closer)
+		}
+	}
+}
+
+// matchBrackets maps the index of each "[" in s to that of the "]" closing
+// it, leaving out escaped brackets and those in code spans.
+func matchBrackets(s string) map[int]int {
+	closes := make(map[int]int)
+	var open []int
+	for j := 0; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			n := runLength(s, j, '`')
+			if end := closingBackticks(s, j+n, n); end >= 0 {
+				j = end + n - 1
+			} else {
+				j += n - 1
+			}
+		case '[':
+			open = append(open, j)
+		case ']':
+			if len(open) > 0 {
+				closes[open[len(open)-1]] = j
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	return closes
+}
+
+// maxURL bounds how far a link's destination is looked for, so that text
+// full of brackets is not scanned to its end once per bracket.
+const maxURL = 2048
+
+// destination parses the "(url "title")" that follows link text, starting at
+// s[i].
+func destination(s string, i int) (url, title string, end int, ok bool) {
+	if i >= len(s) || s[i] != '(' {
+		return "", "", 0, false
+	}
+	i = skipSpace(s, i+1)
+	switch {
+	case i < len(s) && s[i] == '<':
+		j := strings.IndexAny(s[i+1:], "<>\n")
+		if j < 0 || s[i+1+j] != '>' {
+			return "", "", 0, false
+		}
+		url, i = s[i+1:i+1+j], i+j+2
+	default:
+		start, depth := i, 0
+		for ; i < len(s) && s[i] > ' ' && i-start < maxURL; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			} else if s[i] == '(' {
+				depth++
+			} else if s[i] == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+		url = s[start:i]
+	}
+	j := skipSpace(s, i)
+	if j > i && j < len(s) && strings.IndexByte(`"'(`, s[j]) >= 0 {
+		closing := s[j]
+		if closing == '(' {
+			closing = ')'
+		}
+		k := j + 1
+		for ; k < len(s) && s[k] != closing && !(closing == ')' && s[k] == '('); k++ {
+			if s[k] == '\\' {
+				k++
+			}
+		}
+		if k >= len(s) || s[k] != closing {
+			return "", "", 0, false
+		}
+		title, j = s[j+1:k], skipSpace(s, k+1)
+	}
+	if j >= len(s) || s[j] != ')' {
+		return "", "", 0, false
+	}
+	return unescape(url), unescape(title), j + 1, true
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// unescape resolves the backslash escapes and entities in a link's URL or
+// title.
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(punctuation, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return html.UnescapeString(b.String())
+}
+
+// link renders the link whose text runs from the "[" at s[i] to the "]" at
+// s[close]. A link to an unsafe URL keeps its text only.
+func link(s string, i, close int) (string, int, bool) {
+	if close <= i {
+		return "", 0, false
+	}
+	url, title, end, ok := destination(s, close+1)
+	if !ok {
+		return "", 0, false
+	}
+	text := inline(s[i+1:close], inLink)
+	if !safeURL(url, linkSchemes...) {
+		return text, end, true
+	}
+	out := `<a href="` + html.EscapeString(url) + `"`
+	if title != "" {
+		out += ` title="` + html.EscapeString(title) + `"`
+	}
+	return out + ` rel="nofollow">` + text + "</a>", end, true
+}
+
+// image renders the image described between the "[" at s[i] and the "]" at
+// s[close]. Its alt text is the description without markup; an image from
+// an unsafe URL is replaced by that text.
+func image(s string, i, close int) (string, int, bool) {
+	if close <= i {
+		return "", 0, false
+	}
+	url, title, end, ok := destination(s, close+1)
+	if !ok {
+		return "", 0, false
+	}
+	alt := html.EscapeString(plainText(inline(s[i+1:close], inImage)))
+	if !safeURL(url, imageSchemes...) {
+		return alt, end, true
+	}
+	out := `<img src="` + html.EscapeString(url) + `" alt="` + alt + `"`
+	if title != "" {
+		out += ` title="` + html.EscapeString(title) + `"`
+	}
+	return out + ">", end, true
+}
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+func plainText(h string) string {
+	return html.UnescapeString(tags.ReplaceAllString(h, ""))
+}
+
+// angle renders what starts with the "<" at the beginning of s: an autolink,
+// one of the authorTags, or else the "<" as text. It returns how much of s
+// it used.
+func angle(s string) (string, int) {
+	if m := autolink.FindStringSubmatch(s); m != nil {
+		if !safeURL(m[1], linkSchemes...) {
+			return html.EscapeString(m[0]), len(m[0])
+		}
+		return `<a href="` + html.EscapeString(m[1]) + `" rel="nofollow">` + html.EscapeString(m[1]) + "</a>", len(m[0])
+	}
+	if m := emailLink.FindStringSubmatch(s); m != nil {
+		return `<a href="mailto:` + html.EscapeString(m[1]) + `" rel="nofollow">` + html.EscapeString(m[1]) + "</a>", len(m[0])
+	}
+	if m := rawTag.FindStringSubmatch(s); m != nil && slices.Contains(authorTags, strings.ToLower(m[2])) {
+		return "<" + m[1] + strings.ToLower(m[2]) + ">", len(m[0])
+	}
+	return "&lt;", 1
+}
@@ -0,0 +1,78 @@
+package render
+
+import "testing"
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"atx heading", "# Heading", "<h1>Heading</h1>\n"},
+		{"atx closing hashes", "### Heading ###", "<h3>Heading</h3>\n"},
+		{"atx needs a space", "#no heading", "<p>#no heading</p>\n"},
+		{"setext h1", "Heading\n=======", "<h1>Heading</h1>\n"},
+		{"setext h2", "Sub\n---", "<h2>Sub</h2>\n"},
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		{"hard break spaces", "line  \nbreak", "<p>line<br>\nbreak</p>\n"},
+		{"hard break backslash", "line\\\nbreak", "<p>line<br>\nbreak</p>\n"},
+		{"crlf", "one\r\ntwo\r\n\r\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		{"block quote", "> quote\n> more", "<blockquote>\n<p>quote\nmore</p>\n</blockquote>\n"},
+		{"lazy quote", "> quote\nlazy", "<blockquote>\n<p>quote\nlazy</p>\n</blockquote>\n"},
+		{"tight list", "- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"loose list", "- a\n\n- b", "<ul>\n<li><p>a</p></li>\n<li><p>b</p></li>\n</ul>\n"},
+		{"list item paragraphs", "- a\n\n  b", "<ul>\n<li><p>a</p>\n<p>b</p></li>\n</ul>\n"},
+		{"ordered start", "3. three\n4. four", "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"},
+		{"nested list", "* a\n  * nested\n* b", "<ul>\n<li>a\n<ul>\n<li>nested</li>\n</ul></li>\n<li>b</li>\n</ul>\n"},
+		{"fenced code", "```\ncode <b>\n```", "<pre><code>code &lt;b&gt;\n</code></pre>\n"},
+		{"fenced code info", "```go\nx := 1\n```", "<pre><code>x := 1\n</code></pre>\n"},
+		{"tilde fence", "~~~\ncode\n~~~", "<pre><code>code\n</code></pre>\n"},
+		{"indented code", "    indented\n    code", "<pre><code>indented\ncode\n</code></pre>\n"},
+		{"thematic break", "***", "<hr>\n"},
+		{"emphasis", "*em* _em_ **strong** __strong__", "<p><em>em</em> <em>em</em> <strong>strong</strong> <strong>strong</strong></p>\n"},
+		{"strong emphasis", "***both***", "<p><em><strong>both</strong></em></p>\n"},
+		{"intraword underscore", "foo_bar_", "<p>foo_bar_</p>\n"},
+		{"intraword star", "foo*bar*", "<p>foo<em>bar</em></p>\n"},
+		{"not right flanking", "*foo bar *", "<p>*foo bar *</p>\n"},
+		{"nested strong", "*foo**bar**baz*", "<p><em>foo<strong>bar</strong>baz</em></p>\n"},
+		{"strong inside em", "***a** b*", "<p><em><strong>a</strong> b</em></p>\n"},
+		{"overlapping", "*a **b* c**", "<p><em>a <em><em>b</em> c</em></em></p>\n"},
+		{"overlapping strong first", "**a *b** c*", "<p><em><em>a <em>b</em></em> c</em></p>\n"},
+		{"rule of three", "*foo**bar*", "<p><em>foo**bar</em></p>\n"},
+		{"unmatched", "**foo*", "<p>*<em>foo</em></p>\n"},
+		{"long runs", "foo******bar*********baz", "<p>foo<strong><strong><strong>bar</strong></strong></strong>***baz</p>\n"},
+		{"strikethrough", "~~del~~", "<p><del>del</del></p>\n"},
+		{"single tilde", "~del~", "<p>~del~</p>\n"},
+		{"code span", "`code`", "<p><code>code</code></p>\n"},
+		{"code span backticks", "`` code ` tick ``", "<p><code>code ` tick</code></p>\n"},
+		{"code span over emphasis", "*a `*`*", "<p><em>a <code>*</code></em></p>\n"},
+		{"unclosed code span", "`<a href=\"`\">`", "<p><code>&lt;a href=&#34;</code>&#34;&gt;`</p>\n"},
+		{"link", "[link](http://x.com)", "<p><a href=\"http://x.com\" rel=\"nofollow\">link</a></p>\n"},
+		{"link title", `[link](/u "title")`, "<p><a href=\"/u\" title=\"title\" rel=\"nofollow\">link</a></p>\n"},
+		{"link paren title", "[x](/u (t))", "<p><a href=\"/u\" title=\"t\" rel=\"nofollow\">x</a></p>\n"},
+		{"link nested brackets", "[a [b] c](/u)", "<p><a href=\"/u\" rel=\"nofollow\">a [b] c</a></p>\n"},
+		{"link nested parens", "[link](foo(and(bar)))", "<p><a href=\"foo(and(bar))\" rel=\"nofollow\">link</a></p>\n"},
+		{"link escaped parens", `[link](\(foo\))`, "<p><a href=\"(foo)\" rel=\"nofollow\">link</a></p>\n"},
+		{"link emphasis", "[link *em*](/u)", "<p><a href=\"/u\" rel=\"nofollow\">link <em>em</em></a></p>\n"},
+		{"link beats emphasis", "*[foo*](/u)", "<p>*<a href=\"/u\" rel=\"nofollow\">foo*</a></p>\n"},
+		{"empty link", "[x]()", "<p><a href=\"\" rel=\"nofollow\">x</a></p>\n"},
+		{"no destination", "[link]", "<p>[link]</p>\n"},
+		{"image", `![alt *em*](/i.png "t")`, "<p><img src=\"/i.png\" alt=\"alt em\" title=\"t\"></p>\n"},
+		{"image in link", "[![img](/i.png)](/u)", "<p><a href=\"/u\" rel=\"nofollow\"><img src=\"/i.png\" alt=\"img\"></a></p>\n"},
+		{"autolink", "<http://x.com>", "<p><a href=\"http://x.com\" rel=\"nofollow\">http://x.com</a></p>\n"},
+		{"email autolink", "<a@b.c>", "<p><a href=\"mailto:a@b.c\" rel=\"nofollow\">a@b.c</a></p>\n"},
+		{"backslash escapes", `\*not em\*`, "<p>*not em*</p>\n"},
+		{"entities", "a &amp; b &copy; &#65;", "<p>a &amp; b &copy; &#65;</p>\n"},
+		{"bare ampersand", "a & b < c", "<p>a &amp; b &lt; c</p>\n"},
+		{"author tags", "<b>bold</b> <i>it</i><br>", "<p><b>bold</b> <i>it</i><br></p>\n"},
+		{"other tags are text", "<span>x</span>", "<p>&lt;span&gt;x&lt;/span&gt;</p>\n"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Markdown(tt.src)
+			if got != tt.want {
+				t.Errorf("Markdown(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+			checkSafe(t, tt.src, got)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package render turns chapter content into HTML for clients that would
+// rather not render it themselves.
+package render
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"html"
+	"regexp"
+	"strings"
+	"sync"
+
+	"novella/internal/model"
+)
+
+// HTML renders content written in format. Plain text becomes paragraphs at
+// blank lines, with line breaks kept.
+func HTML(format model.ContentFormat, content string) string {
+	if format == model.FormatMarkdown {
+		return Markdown(content)
+	}
+	return Plain(content)
+}
+
+var blankLine = regexp.MustCompile(`\n[ \t]*\n`)
+
+func Plain(content string) string {
+	var b strings.Builder
+	for _, para := range blankLine.Split(normalizeNewlines(content), -1) {
+		if para = strings.Trim(para, "\n"); strings.TrimSpace(para) == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(para), "\n", "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+}
+
+// Cache keeps the most recently rendered texts. Entries are keyed by format
+// and a digest of the content, so each revision of a chapter is rendered
+// once however often it is read, and restoring an old revision finds its
+// rendering again.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[cacheKey]*list.Element
+}
+
+type cacheKey struct {
+	format model.ContentFormat
+	sum    [sha256.Size]byte
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	html string
+}
+
+func NewCache(size int) *Cache {
+	return &Cache{size: size, order: list.New(), entries: make(map[cacheKey]*list.Element)}
+}
+
+// HTML is the package's HTML, served from the cache when it can be.
+func (c *Cache) HTML(format model.ContentFormat, content string) string {
+	key := cacheKey{format, sha256.Sum256([]byte(content))}
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*cacheEntry).html
+	}
+	c.mu.Unlock()
+
+	out := HTML(format, content)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&cacheEntry{key, out})
+		for c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package render
+
+import (
+	"testing"
+
+	"novella/internal/model"
+)
+
+func TestPlain(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"one\ntwo\n\nthree", "<p>one<br>\ntwo</p>\n<p>three</p>\n"},
+		{"a\r\n \r\nb", "<p>a</p>\n<p>b</p>\n"},
+		{"\n\n  \n", ""},
+		{"<b>*not markdown*</b> & co", "<p>&lt;b&gt;*not markdown*&lt;/b&gt; &amp; co</p>\n"},
+	}
+	for _, tt := range tests {
+		if got := Plain(tt.src); got != tt.want {
+			t.Errorf("Plain(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(1)
+	if got, want := c.HTML(model.FormatMarkdown, "*a*"), "<p><em>a</em></p>\n"; got != want {
+		t.Errorf("markdown = %q, want %q", got, want)
+	}
+	if got, want := c.HTML(model.FormatPlain, "*a*"), "<p>*a*</p>\n"; got != want {
+		t.Errorf("same content as plain text = %q, want %q", got, want)
+	}
+	if n := c.order.Len(); n != 1 {
+		t.Errorf("cache holds %d entries, want 1", n)
+	}
+}
@@ -0,0 +1,112 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// allowed lists the tags rendered HTML may hold and the attributes each may
+// carry. Everything else is dropped.
+var allowed = map[string][]string{
+	"p": nil, "br": nil, "hr": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"blockquote": nil, "pre": nil,
+	"ul": nil, "ol": {"start"}, "li": nil,
+	"a":   {"href", "title", "rel"},
+	"img": {"src", "alt", "title"},
+	"em":  nil, "strong": nil, "del": nil, "code": nil,
+	"b": nil, "i": nil, "u": nil, "s": nil, "ins": nil, "mark": nil,
+	"small": nil, "sub": nil, "sup": nil, "kbd": nil,
+}
+
+// authorTags are the tags authors may write as HTML in Markdown, without
+// attributes. Other HTML in the source shows up as text.
+var authorTags = []string{"b", "i", "u", "s", "em", "strong", "del", "ins", "mark", "small", "sub", "sup", "kbd", "br"}
+
+var voidTags = []string{"br", "hr", "img"}
+
+// safeURL reports whether u may be linked to: a relative URL or one with a
+// scheme in schemes.
+func safeURL(u string, schemes ...string) bool {
+	if strings.ContainsFunc(u, func(r rune) bool { return r < ' ' || r == 0x7f }) {
+		return false
+	}
+	scheme, _, ok := strings.Cut(u, ":")
+	if !ok || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+	return slices.Contains(schemes, strings.ToLower(scheme))
+}
+
+var linkSchemes = []string{"http", "https", "mailto"}
+var imageSchemes = []string{"http", "https"}
+
+var (
+	tagPattern  = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\s+[a-zA-Z-]+="[^"]*")*)\s*/?>`)
+	attrPattern = regexp.MustCompile(`([a-zA-Z-]+)="([^"]*)"`)
+)
+
+// sanitize keeps only allowed tags and attributes in h, which must hold its
+// text escaped, and closes every element that is left open or closed out
+// of turn.
+func sanitize(h string) string {
+	var b strings.Builder
+	var open []string
+	opened := make(map[string]int)
+	for len(h) > 0 {
+		i := strings.IndexByte(h, '<')
+		if i < 0 {
+			b.WriteString(h)
+			break
+		}
+		b.WriteString(h[:i])
+		h = h[i:]
+		m := tagPattern.FindStringSubmatch(h)
+		if m == nil {
+			b.WriteString("&lt;")
+			h = h[1:]
+			continue
+		}
+		h = h[len(m[0]):]
+		name := strings.ToLower(m[2])
+		attrs, ok := allowed[name]
+		switch {
+		case !ok:
+		case m[1] == "/":
+			if opened[name] == 0 {
+				continue
+			}
+			for {
+				last := open[len(open)-1]
+				open = open[:len(open)-1]
+				opened[last]--
+				b.WriteString("</" + last + ">")
+				if last == name {
+					break
+				}
+			}
+		default:
+			b.WriteString("<" + name)
+			for _, a := range attrPattern.FindAllStringSubmatch(m[3], -1) {
+				key, val := strings.ToLower(a[1]), html.UnescapeString(a[2])
+				if !slices.Contains(attrs, key) ||
+					key == "href" && !safeURL(val, linkSchemes...) ||
+					key == "src" && !safeURL(val, imageSchemes...) {
+					continue
+				}
+				b.WriteString(" " + key + `="` + html.EscapeString(val) + `"`)
+			}
+			b.WriteString(">")
+			if !slices.Contains(voidTags, name) {
+				open = append(open, name)
+				opened[name]++
+			}
+		}
+	}
+	for j := len(open) - 1; j >= 0; j-- {
+		b.WriteString("</" + open[j] + ">")
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var (
+	outputTag  = regexp.MustCompile(`<(/?)([a-z0-9]+)((?: [a-z]+="[^"<>]*")*)>`)
+	outputAttr = regexp.MustCompile(`([a-z]+)="([^"]*)"`)
+)
+
+// checkSafe fails unless every tag in h is an allowed one with allowed
+// attributes, and every link and image points somewhere safe.
+func checkSafe(t *testing.T, src, h string) {
+	t.Helper()
+	rest := outputTag.ReplaceAllStringFunc(h, func(tag string) string {
+		m := outputTag.FindStringSubmatch(tag)
+		attrs, ok := allowed[m[2]]
+		if !ok {
+			t.Errorf("Markdown(%q) = %q: tag %s is not allowed", src, h, m[2])
+		}
+		for _, a := range outputAttr.FindAllStringSubmatch(m[3], -1) {
+			val := html.UnescapeString(a[2])
+			switch {
+			case !slices.Contains(attrs, a[1]):
+				t.Errorf("Markdown(%q) = %q: attribute %s is not allowed on %s", src, h, a[1], m[2])
+			case a[1] == "href" && !safeURL(val, linkSchemes...),
+				a[1] == "src" && !safeURL(val, imageSchemes...):
+				t.Errorf("Markdown(%q) = %q: unsafe %s %q", src, h, a[1], val)
+			}
+		}
+		return ""
+	})
+	if strings.ContainsAny(rest, "<>") {
+		t.Errorf("Markdown(%q) = %q: unescaped markup left over", src, h)
+	}
+}
+
+func TestMarkdownXSS(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"upper case scheme", "[x](JAVASCRIPT:alert(1))", "<p>x</p>\n"},
+		{"vbscript link", "[x](vbscript:msgbox)", "<p>x</p>\n"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>\n"},
+		{"javascript image", "![x](javascript:alert(1))", "<p>x</p>\n"},
+		{"data image", "![x](data:image/png;base64,AAAA)", "<p>x</p>\n"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>\n"},
+		{"javascript in angle destination", "[x](<javascript:alert(1)>)", "<p>x</p>\n"},
+		{"decimal entity in scheme", "[x](java&#115;cript:alert(1))", "<p>x</p>\n"},
+		{"hex entity in scheme", "[x](&#x6A;avascript:alert(1))", "<p>x</p>\n"},
+		{"named entity colon", "[x](javascript&colon;alert(1))", "<p>x</p>\n"},
+		{"tab entity in scheme", "[x](javas&#x09;cript:alert(1))", "<p>x</p>\n"},
+		{"nul entity in scheme", "[x](jav&#0;ascript:alert(1))", "<p>x</p>\n"},
+		{"entity in autolink", "<javascript&#58;alert(1)>", "<p>&lt;javascript&#58;alert(1)&gt;</p>\n"},
+		{"event handler", `<b onclick="alert(1)">y</b>`, "<p><b>y</b></p>\n"},
+		{"event handler on new line", "<b\nonclick=\"alert(1)\">y</b>", "<p><b>y</b></p>\n"},
+		{"unquoted event handler", "<b/onclick=alert(1)>y", "<p>&lt;b/onclick=alert(1)&gt;y</p>\n"},
+		{"attribute on author tag", `<b title="x">y</b>`, "<p><b>y</b></p>\n"},
+		{"upper case tag", "<B>y</B>", "<p><b>y</b></p>\n"},
+		{"raw image", "<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>\n"},
+		{"raw link", `<a href="javascript:alert(1)">x</a>`, "<p>&lt;a href=&#34;javascript:alert(1)&#34;&gt;x&lt;/a&gt;</p>\n"},
+		{"title breaks out", `[x](/u "t\" onmouseover=\"b")`, "<p><a href=\"/u\" title=\"t&#34; onmouseover=&#34;b\" rel=\"nofollow\">x</a></p>\n"},
+		{"alt breaks out", `![x" onerror="alert(1)](/i.png)`, "<p><img src=\"/i.png\" alt=\"x&#34; onerror=&#34;alert(1)\"></p>\n"},
+		{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"style", "<style>x</style>", "<p>&lt;style&gt;x&lt;/style&gt;</p>\n"},
+		{"svg", "<svg onload=alert(1)>", "<p>&lt;svg onload=alert(1)&gt;</p>\n"},
+		{"comment", "<!-- c -->", "<p>&lt;!-- c --&gt;</p>\n"},
+		{"split script", "<scr<b>ipt>alert(1)</script>", "<p>&lt;scr<b>ipt&gt;alert(1)&lt;/script&gt;</b></p>\n"},
+		{"unclosed tag", "<b>unclosed", "<p><b>unclosed</b></p>\n"},
+		{"stray close", "</b>stray", "<p>stray</p>\n"},
+		{"closing block tags", "</b></i></p><script>", "<p>&lt;/p&gt;&lt;script&gt;</p>\n"},
+		{"misnested", "<i><b>x</i></b>", "<p><i><b>x</b></i></p>\n"},
+		{"unclosed across blocks", "<b>one\n\ntwo</b>", "<p><b>one</b></p>\n<p>two</p>\n"},
+		{"html in code span", "`<script>alert(1)</script>`", "<p><code>&lt;script&gt;alert(1)&lt;/script&gt;</code></p>\n"},
+		{"author tag in code span", "`<b>`", "<p><code>&lt;b&gt;</code></p>\n"},
+		{"html in fenced code", "```\n<script>\n```", "<pre><code>&lt;script&gt;\n</code></pre>\n"},
+		{"http link kept", "[x](HtTpS://ok)", "<p><a href=\"HtTpS://ok\" rel=\"nofollow\">x</a></p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Markdown(tt.src)
+			if got != tt.want {
+				t.Errorf("Markdown(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+			checkSafe(t, tt.src, got)
+		})
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com", true},
+		{"/relative/path", true},
+		{"page?a=b:c", true},
+		{"#frag:x", true},
+		{"mailto:a@b.c", true},
+		{"javascript:alert(1)", false},
+		{" javascript:alert(1)", false},
+		{"java\tscript:alert(1)", false},
+		{"data:text/html,x", false},
+		{"vbscript:x", false},
+	}
+	for _, tt := range tests {
+		if got := safeURL(tt.url, linkSchemes...); got != tt.want {
+			t.Errorf("safeURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package schedule publishes scheduled novels and chapters when their time
+// comes.
+package schedule
+
+import (
+	"log"
+	"time"
+
+	"novella/internal/model"
+	"novella/internal/store"
+)
+
+// Handler is told about every novel or chapter the scheduler publishes.
+type Handler func(model.Event)
+
+type Scheduler struct {
+	releases store.Releases
+	handlers []Handler
+}
+
+func New(releases store.Releases, handlers ...Handler) *Scheduler {
+	return &Scheduler{releases: releases, handlers: handlers}
+}
+
+func (s *Scheduler) Run(every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		s.Flush(time.Now())
+		<-tick.C
+	}
+}
+
+// Flush publishes everything due at now and hands the events to the
+// handlers in the order they were due.
+func (s *Scheduler) Flush(now time.Time) {
+	events, err := s.releases.ReleaseDue(now)
+	if err != nil {
+		log.Printf("schedule: publishing failed: %v", err)
+		return
+	}
+	for _, e := range events {
+		for _, h := range s.handlers {
+			h(e)
+		}
+	}
+}
+
+// LogEvent is a Handler that writes each event to the log.
+func LogEvent(e model.Event) {
+	if e.ChapterID != 0 {
+		log.Printf("schedule: %s: chapter %d %q of novel %d", e.Type, e.ChapterID, e.Title, e.NovelID)
+		return
+	}
+	log.Printf("schedule: %s: novel %d %q", e.Type, e.NovelID, e.Title)
+}
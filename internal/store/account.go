@@ -0,0 +1,101 @@
+package store
+
+import (
+	"errors"
+	"sort"
+
+	"novella/internal/model"
+)
+
+// NovelDisposition decides what happens to the novels of a deleted account.
+type NovelDisposition string
+
+const (
+	NovelsDelete   NovelDisposition = "delete"
+	NovelsTransfer NovelDisposition = "transfer"
+)
+
+var (
+	errNovelDisposition = errors.New("novels must be delete or transfer")
+	errTransferTarget   = errors.New("transfer_to must be another user who may publish novels")
+)
+
+// AccountDeletion confirms deleting an account and says what becomes of its
+// novels. With NovelsTransfer they go to the user TransferTo; Novels may be
+// left empty by users who have none.
+type AccountDeletion struct {
+	Reauth
+	Novels     NovelDisposition
+	TransferTo int64
+}
+
+// check validates d for the account userID, which has novels when hasNovels
+// is set. target is the actor TransferTo resolves to.
+func (d AccountDeletion) check(userID int64, hasNovels bool, target actor) error {
+	switch d.Novels {
+	case NovelsDelete:
+	case NovelsTransfer:
+		if hasNovels && (target.owns(userID) || !target.canCreateNovel()) {
+			return errTransferTarget
+		}
+	case "":
+		if hasNovels {
+			return errNovelDisposition
+		}
+	default:
+		return errNovelDisposition
+	}
+	return nil
+}
+
+// AccountExport is everything a backend holds about one user: the account,
+// its credentials without their secrets, the novels it wrote with their
+// chapters, the chapter revisions it wrote, and its comments and bookmarks. Mail bodies are left out, since
+// a pending message may carry a token.
+type AccountExport struct {
+	User       model.User            `json:"user"`
+	Sessions   []model.Session       `json:"sessions"`
+	APIKeys    []model.APIKey        `json:"api_keys"`
+	Identities []model.Identity      `json:"identities"`
+	Tokens     []model.UserToken     `json:"tokens"`
+	Mail       []model.OutboxMessage `json:"mail"`
+	Novels     []model.Novel         `json:"novels"`
+	Chapters   []model.Chapter       `json:"chapters"`
+	Revisions  []model.Revision      `json:"revisions"`
+	Comments   []model.Comment       `json:"comments"`
+	Bookmarks  []model.Bookmark      `json:"bookmarks"`
+}
+
+func newAccountExport(u model.User) AccountExport {
+	return AccountExport{
+		User:       u,
+		Sessions:   []model.Session{},
+		APIKeys:    []model.APIKey{},
+		Identities: []model.Identity{},
+		Tokens:     []model.UserToken{},
+		Mail:       []model.OutboxMessage{},
+		Novels:     []model.Novel{},
+		Chapters:   []model.Chapter{},
+		Revisions:  []model.Revision{},
+		Comments:   []model.Comment{},
+		Bookmarks:  []model.Bookmark{},
+	}
+}
+
+// tidy puts every list in a stable order, oldest first, so exports of the
+// two backends compare equal, and drops the mail bodies.
+func (e *AccountExport) tidy() {
+	sort.Slice(e.Sessions, func(i, j int) bool { return e.Sessions[i].CreatedAt.Before(e.Sessions[j].CreatedAt) })
+	sort.Slice(e.APIKeys, func(i, j int) bool { return e.APIKeys[i].CreatedAt.Before(e.APIKeys[j].CreatedAt) })
+	sort.Slice(e.Identities, func(i, j int) bool { return e.Identities[i].CreatedAt.Before(e.Identities[j].CreatedAt) })
+	sort.Slice(e.Tokens, func(i, j int) bool { return e.Tokens[i].CreatedAt.Before(e.Tokens[j].CreatedAt) })
+	sort.Slice(e.Mail, func(i, j int) bool { return e.Mail[i].ID < e.Mail[j].ID })
+	sort.Slice(e.Novels, func(i, j int) bool { return e.Novels[i].ID < e.Novels[j].ID })
+	sort.Slice(e.Chapters, func(i, j int) bool { return e.Chapters[i].ID < e.Chapters[j].ID })
+	sort.Slice(e.Revisions, func(i, j int) bool { return lessRevision(e.Revisions[i], e.Revisions[j]) })
+	sort.Slice(e.Comments, func(i, j int) bool { return e.Comments[i].ID < e.Comments[j].ID })
+	sort.Slice(e.Bookmarks, func(i, j int) bool { return e.Bookmarks[i].NovelID < e.Bookmarks[j].NovelID })
+	for i := range e.Mail {
+		e.Mail[i].Body = ""
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"novella/internal/model"
+)
+
+const (
+	apiKeyPrefix  = "nvk_"
+	maxAPIKeys    = 25
+	maxAPIKeyName = 100
+)
+
+var (
+	ErrTooManyAPIKeys = errors.New("too many api keys")
+	errAPIKeyName     = errors.New("name is required")
+	errAPIKeyScopes   = errors.New("at least one valid scope is required")
+	errAPIKeyExpiry   = errors.New("expires_at must be in the future")
+)
+
+// IsAPIKey tells API keys apart from session bearer tokens.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+func newAPIKey(userID int64, name string, scopes []model.Scope, expiresAt *time.Time, now time.Time) (model.APIKey, string, error) {
+	name = clip(strings.TrimSpace(name), maxAPIKeyName)
+	if name == "" {
+		return model.APIKey{}, "", errAPIKeyName
+	}
+	if len(scopes) == 0 {
+		return model.APIKey{}, "", errAPIKeyScopes
+	}
+	for _, sc := range scopes {
+		if !sc.Valid() {
+			return model.APIKey{}, "", errAPIKeyScopes
+		}
+	}
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return model.APIKey{}, "", errAPIKeyExpiry
+		}
+		at := expiresAt.UTC()
+		expiresAt = &at
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	token := apiKeyPrefix + secret
+	return model.APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:len(apiKeyPrefix)+6],
+		TokenHash: hashToken(token),
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}, token, nil
+}
+
+func apiKeyActive(k model.APIKey, now time.Time) bool {
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// Like sessions, keys record their last use at most once per touchInterval.
+func apiKeyNeedsTouch(k model.APIKey, now time.Time) bool {
+	return k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= touchInterval
+}
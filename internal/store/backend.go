@@ -0,0 +1,191 @@
+package store
+
+import (
+	"io"
+	"time"
+
+	"novella/internal/model"
+)
+
+// Backend is the storage contract the HTTP layer depends on. *Store is the
+// in-memory implementation backed by the JSON DB file; *SQLStore keeps
+// everything in SQLite.
+type Backend interface {
+	io.Closer
+	Users
+	Profiles
+	Privacy
+	Sessions
+	APIKeys
+	TwoFactor
+	Identities
+	Accounts
+	Outbox
+	Releases
+	Novels
+	Chapters
+	Revisions
+	Comments
+	Bookmarks
+	Admin
+}
+
+// Login fails with a *Challenge for users with two-factor authentication;
+// CompleteLogin then opens the session once the second factor checks out.
+// Repeated wrong passwords lock the account, and Login fails with a
+// *LockedError until the lockout ends.
+type Users interface {
+	Register(username, email, password string, client Client) (model.User, Tokens, error)
+	Login(email, password string, client Client) (model.User, Tokens, error)
+	CompleteLogin(challenge, code string, client Client) (model.User, Tokens, error)
+}
+
+// Profiles are the parts of an account users edit themselves, and the view
+// of it anyone may see. Changing the password signs out every session but
+// keepSession and revokes every API key.
+type Profiles interface {
+	UpdateProfile(userID int64, keepSession string, p ProfileUpdate) (model.User, error)
+	Profile(userID int64) (model.Profile, error)
+}
+
+// Privacy lets users take their data with them or remove it. DeleteAccount
+// needs the password, or a recent sign-in; it removes the account with its
+// credentials and bookmarks, keeps its comments without an author, and
+// deletes its novels or hands them to another user. ExportAccount returns
+// everything held about the user.
+type Privacy interface {
+	DeleteAccount(userID int64, d AccountDeletion) error
+	ExportAccount(userID int64) (AccountExport, error)
+}
+
+// Sessions are looked up by bearer token and slide their expiry on use.
+// SweepSessions deletes the sessions that expired before now.
+type Sessions interface {
+	Authenticate(token string) (model.User, model.Session, error)
+	Refresh(refreshToken string) (Tokens, error)
+	ListSessions(userID int64) ([]model.Session, error)
+	RevokeSession(userID int64, sessionID string) error
+	SweepSessions(now time.Time) (int, error)
+}
+
+// APIKeys are long-lived credentials users create for scripts. The key
+// itself is only returned by CreateAPIKey. AuthenticateAPIKey rejects
+// expired keys and records when a key was last used.
+type APIKeys interface {
+	CreateAPIKey(userID int64, name string, scopes []model.Scope, expiresAt *time.Time) (model.APIKey, string, error)
+	ListAPIKeys(userID int64) ([]model.APIKey, error)
+	RevokeAPIKey(userID int64, id string) error
+	AuthenticateAPIKey(token string) (model.User, model.APIKey, error)
+}
+
+// TwoFactor enrolls users in TOTP two-factor authentication. Every change
+// requires the current password, or a recent sign-in for accounts without
+// one (see Reauth); enabling also requires a code from the new secret and
+// returns the recovery codes, which are not shown again.
+type TwoFactor interface {
+	BeginTwoFactor(userID int64, re Reauth) (TwoFactorSetup, error)
+	EnableTwoFactor(userID int64, re Reauth, code string) ([]string, error)
+	DisableTwoFactor(userID int64, re Reauth) error
+}
+
+// Identities links users to accounts at OpenID Connect providers.
+// LoginWithIdentity signs in the linked user, or registers a new one when no
+// user has the email address. An address that belongs to a user who has not
+// linked the identity fails with ErrConflict rather than being taken over.
+// Like Login, it fails with a *Challenge for users with two-factor
+// authentication.
+type Identities interface {
+	LoginWithIdentity(acct ExternalAccount, client Client) (model.User, Tokens, error)
+	LinkIdentity(userID int64, acct ExternalAccount) (model.Identity, error)
+	ListIdentities(userID int64) ([]model.Identity, error)
+	UnlinkIdentity(userID int64, provider string) error
+}
+
+// Accounts issues and redeems the single-use tokens sent by email. Issuing a
+// token replaces any earlier one of the same purpose for that user, and
+// resetting a password revokes all of the user's sessions and API keys.
+type Accounts interface {
+	CreatePasswordReset(email string) (model.User, string, error)
+	ResetPassword(token, password string) (model.User, error)
+	CreateEmailVerification(userID int64) (model.User, string, error)
+	VerifyEmail(token string) (model.User, error)
+}
+
+// Outbox persists outgoing email until a dispatcher has delivered it.
+type Outbox interface {
+	EnqueueMail(to, subject, body string) (model.OutboxMessage, error)
+	DueMail(now time.Time, limit int) ([]model.OutboxMessage, error)
+	MarkMailSent(id int64, at time.Time) error
+	MarkMailFailed(id int64, reason string, retryAt *time.Time) error
+	PruneMail(before time.Time) (int, error)
+}
+
+// Releases publishes the drafts and chapters whose publish_at has come.
+// ReleaseDue reports one event for each. A chapter of a novel that is still
+// a draft waits, and goes live with the first release after the novel does.
+type Releases interface {
+	ReleaseDue(now time.Time) ([]model.Event, error)
+}
+
+// publishAt schedules a draft: nil leaves the schedule as it is, and on
+// updates the zero time cancels it.
+type Novels interface {
+	CreateNovel(authorID int64, title, description, genre string, status model.NovelStatus, publishAt *time.Time) (model.Novel, error)
+	ListNovels(query string, authorID int64, includeDrafts bool, requesterID int64, limit, offset int) ([]model.Novel, error)
+	NovelByID(id int64, requesterID int64) (model.Novel, error)
+	UpdateNovel(id, requesterID int64, title, description, genre string, status *model.NovelStatus, publishAt *time.Time) (model.Novel, error)
+	DeleteNovel(id, requesterID int64) error
+}
+
+// format is plain or markdown; an empty one means plain text on create and
+// leaves the format as it is on update. status and publishAt work as for
+// novels; a chapter created without a status is published unless it is
+// scheduled. Readers who may not see drafts
+// only get published chapters listed, numbered without gaps for the others.
+//
+// Positions run from 1 without gaps. Creating or moving a chapter to a
+// position shifts the ones after it, and ReorderChapters takes the IDs of
+// every chapter of the novel in their new order.
+type Chapters interface {
+	CreateChapter(novelID, requesterID int64, title, content string, format model.ContentFormat, position int, status *model.ChapterStatus, publishAt *time.Time) (model.Chapter, error)
+	ListChapters(novelID, requesterID int64) ([]model.Chapter, error)
+	ChapterByID(novelID, chapterID, requesterID int64) (model.Chapter, error)
+	UpdateChapter(novelID, chapterID, requesterID int64, title, content string, format model.ContentFormat, position int, status *model.ChapterStatus, publishAt *time.Time) (model.Chapter, error)
+	DeleteChapter(novelID, chapterID, requesterID int64) error
+	ReorderChapters(novelID, requesterID int64, chapterIDs []int64) ([]model.Chapter, error)
+}
+
+// Revisions is the history of a chapter's content. Every change to the
+// content adds a revision; restoring one adds another with the old content.
+// ListRevisions leaves out the content of each revision.
+type Revisions interface {
+	ListRevisions(novelID, chapterID, requesterID int64) ([]model.Revision, error)
+	RevisionByNumber(novelID, chapterID, requesterID int64, number int) (model.Revision, error)
+	RestoreRevision(novelID, chapterID, requesterID int64, number int) (model.Chapter, error)
+}
+
+type Comments interface {
+	CreateComment(novelID int64, chapterID *int64, userID int64, body string) (model.Comment, error)
+	ListComments(novelID, requesterID int64, chapterID *int64) ([]model.Comment, error)
+	DeleteComment(novelID, commentID, requesterID int64) error
+}
+
+type Bookmarks interface {
+	UpsertBookmark(userID, novelID int64, chapterID *int64) (model.Bookmark, error)
+	MyBookmarks(userID int64) ([]model.Bookmark, error)
+}
+
+// Admin manages other users' accounts. Every method requires actorID to be
+// allowed to manage users; SetRole and DeleteUser fail with ErrLastAdmin
+// rather than leave no admin behind. DeleteUser removes an account as
+// DeleteAccount does, though not the actor's own.
+type Admin interface {
+	ListUsers(actorID int64, query string, role model.Role, limit, offset int) ([]model.User, error)
+	UserByID(actorID, userID int64) (model.User, error)
+	SetRole(actorID, userID int64, role model.Role) (model.User, error)
+	RevokeUserSessions(actorID, userID int64) (int, error)
+	UnlockUser(actorID, userID int64) (model.User, error)
+	DeleteUser(actorID, userID int64, novels NovelDisposition, transferTo int64) error
+}
+
+var _ Backend = (*Store)(nil)
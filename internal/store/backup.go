@@ -0,0 +1,118 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Backup writes the store's current state to path as a standalone snapshot
+// that NewWithDB and RestoreJSON accept.
+func (s *Store) Backup(path string) error {
+	s.mu.RLock()
+	data, err := s.marshalStateLocked()
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o600)
+}
+
+// RestoreJSON replaces the JSON database at dbPath with the snapshot at
+// backupPath. The server must be stopped. The files it replaces, journals
+// included, are kept with a .pre-restore suffix. opts apply to both the
+// backup and the restored database.
+func RestoreJSON(dbPath, backupPath string, opts ...Option) error {
+	src, err := Load(backupPath, opts...)
+	if err != nil {
+		return fmt.Errorf("read backup: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return err
+	}
+	for _, p := range []string{dbPath, dbPath + ".prev", dbPath + ".wal", dbPath + ".wal.prev"} {
+		if err := moveAside(p); err != nil {
+			return err
+		}
+	}
+	return src.Backup(dbPath)
+}
+
+// Backup writes a consistent copy of the database to path with VACUUM INTO,
+// which runs against a read snapshot and does not block writers.
+func (s *SQLStore) Backup(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := s.db.Exec(`VACUUM INTO ?`, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// RestoreSQLite replaces the SQLite database at dbPath with the copy at
+// backupPath after checking its integrity. The server must be stopped. The
+// files it replaces are kept with a .pre-restore suffix.
+func RestoreSQLite(dbPath, backupPath string) error {
+	if err := checkSQLiteBackup(backupPath); err != nil {
+		return fmt.Errorf("read backup: %w", err)
+	}
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return err
+	}
+	for _, p := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+		if err := moveAside(p); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(dbPath, data, 0o600)
+}
+
+func checkSQLiteBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if latest := sqlMigrations[len(sqlMigrations)-1].version; version == 0 || version > latest {
+		return fmt.Errorf("schema version %d is not supported by this build (max %d)", version, latest)
+	}
+	return nil
+}
+
+func moveAside(path string) error {
+	err := os.Rename(path, path+".pre-restore")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
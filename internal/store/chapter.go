@@ -0,0 +1,155 @@
+package store
+
+import (
+	"errors"
+	"slices"
+
+	"novella/internal/model"
+)
+
+var (
+	errChapterOrder  = errors.New("chapter_ids must list every chapter of the novel once")
+	errContentFormat = errors.New("format must be plain or markdown")
+)
+
+// setFormat sets the format of ch's content. An empty format leaves it as
+// it is, which for a new chapter is plain text.
+func setFormat(ch *model.Chapter, format model.ContentFormat) error {
+	switch {
+	case format == "" && ch.Format == "":
+		ch.Format = model.FormatPlain
+	case format == "":
+	case !format.Valid():
+		return errContentFormat
+	default:
+		ch.Format = format
+	}
+	return nil
+}
+
+// lessChapter orders the chapters of a novel by position, the older first
+// where two share one.
+func lessChapter(a, b model.Chapter) bool {
+	if a.Position != b.Position {
+		return a.Position < b.Position
+	}
+	return a.ID < b.ID
+}
+
+func compareChapters(a, b model.Chapter) int {
+	if lessChapter(a, b) {
+		return -1
+	}
+	if lessChapter(b, a) {
+		return 1
+	}
+	return 0
+}
+
+// Chapters are numbered 1 to n within their novel. The functions below take
+// the chapters of one novel, chs, and return all of them in their new order
+// and numbered that way, for the store to save those whose position changed.
+// Numbering everything each time also closes any gaps left by chapters
+// written before positions were kept this way.
+
+// placeChapter moves ch, which may be new, to pos and shifts the chapters
+// from there on back. A pos of 0 or past the end puts ch last.
+func placeChapter(chs []model.Chapter, ch *model.Chapter, pos int) []model.Chapter {
+	res := slices.DeleteFunc(slices.Clone(chs), func(c model.Chapter) bool { return c.ID == ch.ID })
+	slices.SortFunc(res, compareChapters)
+	if pos <= 0 || pos > len(res) {
+		pos = len(res) + 1
+	}
+	ch.Position = pos
+	return numberChapters(slices.Insert(res, pos-1, *ch))
+}
+
+// removeChapter leaves ch out and closes the gap it leaves.
+func removeChapter(chs []model.Chapter, ch model.Chapter) []model.Chapter {
+	res := slices.DeleteFunc(slices.Clone(chs), func(c model.Chapter) bool { return c.ID == ch.ID })
+	slices.SortFunc(res, compareChapters)
+	return numberChapters(res)
+}
+
+// reorderChapters puts the chapters in the order of ids, which must name
+// each of them once.
+func reorderChapters(chs []model.Chapter, ids []int64) ([]model.Chapter, error) {
+	if len(ids) != len(chs) {
+		return nil, errChapterOrder
+	}
+	byID := make(map[int64]model.Chapter, len(chs))
+	for _, ch := range chs {
+		byID[ch.ID] = ch
+	}
+	res := make([]model.Chapter, 0, len(ids))
+	for _, id := range ids {
+		ch, ok := byID[id]
+		if !ok {
+			return nil, errChapterOrder
+		}
+		delete(byID, id)
+		res = append(res, ch)
+	}
+	return numberChapters(res), nil
+}
+
+func numberChapters(chs []model.Chapter) []model.Chapter {
+	for i := range chs {
+		chs[i].Position = i + 1
+	}
+	return chs
+}
+
+// publishedPosition is where ch falls among the published chapters of its
+// novel, chs. Readers see chapters numbered this way, without gaps for the
+// ones they cannot list; an unlisted chapter gets the number it would have
+// if it were published.
+func publishedPosition(chs []model.Chapter, ch model.Chapter) int {
+	pos := 1
+	for _, c := range chs {
+		if c.ID != ch.ID && c.Status == model.ChapterPublished && lessChapter(c, ch) {
+			pos++
+		}
+	}
+	return pos
+}
+
+// listChapters returns the chapters of n, chs, that a may list, in order and
+// numbered the way a sees them.
+func (a actor) listChapters(n model.Novel, chs []model.Chapter) []model.Chapter {
+	res := make([]model.Chapter, 0, len(chs))
+	for _, ch := range chs {
+		if a.canListChapter(n, ch) {
+			res = append(res, ch)
+		}
+	}
+	slices.SortFunc(res, compareChapters)
+	if !a.canReadUnreleased(n) {
+		for i := range res {
+			res[i].Position = i + 1
+		}
+	}
+	return res
+}
+
+// chapterAsSeen returns ch, one of the chapters of n, chs, numbered the way
+// a sees it.
+func (a actor) chapterAsSeen(n model.Novel, chs []model.Chapter, ch model.Chapter) model.Chapter {
+	if !a.canReadUnreleased(n) {
+		ch.Position = publishedPosition(chs, ch)
+	}
+	return ch
+}
+
+// fallbackChapter is where bookmarks on ch go when it becomes a draft: the
+// last published chapter before it, if there is one.
+func fallbackChapter(chs []model.Chapter, ch model.Chapter) *model.Chapter {
+	var to *model.Chapter
+	for i, c := range chs {
+		if c.ID != ch.ID && c.Status == model.ChapterPublished && lessChapter(c, ch) &&
+			(to == nil || lessChapter(*to, c)) {
+			to = &chs[i]
+		}
+	}
+	return to
+}
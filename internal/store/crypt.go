@@ -0,0 +1,168 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Encrypted snapshots start with snapshotMagic and encrypted journal lines
+// with journalPrefix. Both are followed by the key ID, the GCM nonce and the
+// ciphertext; journal lines are base64 encoded so they stay newline-free.
+const (
+	snapshotMagic = "NVENC1"
+	journalPrefix = "e1:"
+	keyIDSize     = 8
+
+	snapshotAAD = "novella snapshot"
+	journalAAD  = "novella journal"
+)
+
+var (
+	ErrWrongKey = errors.New("database is encrypted with a different key")
+	ErrNoKey    = errors.New("database is encrypted but no encryption key is configured")
+)
+
+type sealer struct {
+	aead cipher.AEAD
+	id   []byte
+}
+
+// newSealer returns nil for a nil key, which leaves the files in plaintext.
+func newSealer(key []byte) (*sealer, error) {
+	if key == nil {
+		return nil, nil
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(append([]byte("novella key id:"), key...))
+	return &sealer{aead: aead, id: sum[:keyIDSize]}, nil
+}
+
+func (b *sealer) seal(plain []byte, aad string) ([]byte, error) {
+	out := make([]byte, keyIDSize+b.aead.NonceSize(), keyIDSize+b.aead.NonceSize()+len(plain)+b.aead.Overhead())
+	copy(out, b.id)
+	if _, err := rand.Read(out[keyIDSize:]); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(out, out[keyIDSize:], plain, []byte(aad)), nil
+}
+
+func (b *sealer) open(data []byte, aad string) ([]byte, error) {
+	if len(data) < keyIDSize+b.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	if !bytes.Equal(data[:keyIDSize], b.id) {
+		return nil, ErrWrongKey
+	}
+	nonce := data[keyIDSize : keyIDSize+b.aead.NonceSize()]
+	return b.aead.Open(nil, nonce, data[keyIDSize+b.aead.NonceSize():], []byte(aad))
+}
+
+func (s *Store) encodeSnapshot(data []byte) ([]byte, error) {
+	if s.box == nil {
+		return data, nil
+	}
+	sealed, err := s.box.seal(data, snapshotAAD)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(snapshotMagic), sealed...), nil
+}
+
+func (s *Store) decodeSnapshot(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(snapshotMagic)) {
+		if s.box != nil {
+			s.unencrypted = true
+		}
+		return data, nil
+	}
+	if s.box == nil {
+		return nil, ErrNoKey
+	}
+	plain, err := s.box.open(data[len(snapshotMagic):], snapshotAAD)
+	if err != nil && !errors.Is(err, ErrWrongKey) {
+		return nil, fmt.Errorf("%w: %v", errCorruptSnapshot, err)
+	}
+	return plain, err
+}
+
+func (s *Store) encodeJournalLine(line []byte) ([]byte, error) {
+	if s.box == nil {
+		return line, nil
+	}
+	sealed, err := s.box.seal(line, journalAAD)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(journalPrefix)+base64.StdEncoding.EncodedLen(len(sealed)))
+	copy(out, journalPrefix)
+	base64.StdEncoding.Encode(out[len(journalPrefix):], sealed)
+	return out, nil
+}
+
+func (s *Store) decodeJournalLine(line []byte) ([]byte, error) {
+	if !bytes.HasPrefix(line, []byte(journalPrefix)) {
+		if s.box != nil {
+			s.unencrypted = true
+		}
+		return line, nil
+	}
+	if s.box == nil {
+		return nil, ErrNoKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(line[len(journalPrefix):]))
+	if err != nil {
+		return nil, err
+	}
+	return s.box.open(sealed, journalAAD)
+}
+
+// ParseKey accepts a 32-byte key encoded as base64 or hex.
+func ParseKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, errors.New("encryption key must be 32 bytes encoded as base64 or hex")
+}
+
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(string(data))
+}
+
+// KeyFromEnv returns the key configured by DB_ENCRYPTION_KEY or
+// DB_ENCRYPTION_KEY_FILE, or nil when neither is set.
+func KeyFromEnv() ([]byte, error) {
+	if v := os.Getenv("DB_ENCRYPTION_KEY"); v != "" {
+		return ParseKey(v)
+	}
+	if path := os.Getenv("DB_ENCRYPTION_KEY_FILE"); path != "" {
+		return ReadKeyFile(path)
+	}
+	return nil, nil
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"sort"
+
+	"novella/internal/model"
+)
+
+// Dataset is a complete copy of the records held by a backend, used to move
+// data between backends. Users carry their password salt and hash, and
+// sessions, tokens and API keys their digest.
+type Dataset struct {
+	Users      []model.User
+	Sessions   []model.Session
+	Refresh    []model.RefreshToken
+	UserTokens []model.UserToken
+	Outbox     []model.OutboxMessage
+	Identities []model.Identity
+	APIKeys    []model.APIKey
+	Novels     []model.Novel
+	Chapters   []model.Chapter
+	Revisions  []model.Revision
+	Comments   []model.Comment
+	Bookmarks  []model.Bookmark
+
+	NextUserID    int64
+	NextNovelID   int64
+	NextChapterID int64
+	NextCommentID int64
+	NextMailID    int64
+}
+
+func (s *Store) Dataset() (Dataset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d := Dataset{
+		Users:         make([]model.User, 0, len(s.usersByID)),
+		Sessions:      make([]model.Session, 0, len(s.sessionsByID)),
+		Refresh:       make([]model.RefreshToken, 0, len(s.refreshTokens)),
+		UserTokens:    make([]model.UserToken, 0, len(s.userTokens)),
+		Outbox:        make([]model.OutboxMessage, 0, len(s.outbox)),
+		Identities:    make([]model.Identity, 0, len(s.identities)),
+		APIKeys:       make([]model.APIKey, 0, len(s.apiKeys)),
+		Novels:        make([]model.Novel, 0, len(s.novelsByID)),
+		Chapters:      make([]model.Chapter, 0, len(s.chaptersByID)),
+		Revisions:     make([]model.Revision, 0),
+		Comments:      make([]model.Comment, 0, len(s.commentsByID)),
+		Bookmarks:     make([]model.Bookmark, 0, len(s.bookmarks)),
+		NextUserID:    s.nextUserID,
+		NextNovelID:   s.nextNovelID,
+		NextChapterID: s.nextChapterID,
+		NextCommentID: s.nextCommentID,
+		NextMailID:    s.nextMailID,
+	}
+	for _, u := range s.usersByID {
+		d.Users = append(d.Users, u)
+	}
+	for _, sess := range s.sessionsByID {
+		d.Sessions = append(d.Sessions, sess)
+	}
+	for _, rt := range s.refreshTokens {
+		d.Refresh = append(d.Refresh, rt)
+	}
+	for _, t := range s.userTokens {
+		d.UserTokens = append(d.UserTokens, t)
+	}
+	for _, m := range s.outbox {
+		d.Outbox = append(d.Outbox, m)
+	}
+	for _, id := range s.identities {
+		d.Identities = append(d.Identities, id)
+	}
+	for _, k := range s.apiKeys {
+		d.APIKeys = append(d.APIKeys, k)
+	}
+	for _, n := range s.novelsByID {
+		d.Novels = append(d.Novels, n)
+	}
+	for _, ch := range s.chaptersByID {
+		d.Chapters = append(d.Chapters, ch)
+	}
+	for _, revs := range s.revisions {
+		d.Revisions = append(d.Revisions, revs...)
+	}
+	for _, c := range s.commentsByID {
+		d.Comments = append(d.Comments, c)
+	}
+	for _, b := range s.bookmarks {
+		d.Bookmarks = append(d.Bookmarks, b)
+	}
+
+	sort.Slice(d.Users, func(i, j int) bool { return d.Users[i].ID < d.Users[j].ID })
+	sort.Slice(d.Sessions, func(i, j int) bool { return d.Sessions[i].ID < d.Sessions[j].ID })
+	sort.Slice(d.Refresh, func(i, j int) bool { return d.Refresh[i].TokenHash < d.Refresh[j].TokenHash })
+	sort.Slice(d.UserTokens, func(i, j int) bool { return d.UserTokens[i].TokenHash < d.UserTokens[j].TokenHash })
+	sort.Slice(d.Outbox, func(i, j int) bool { return d.Outbox[i].ID < d.Outbox[j].ID })
+	sort.Slice(d.Identities, func(i, j int) bool {
+		return identityKey(d.Identities[i].Provider, d.Identities[i].Subject) < identityKey(d.Identities[j].Provider, d.Identities[j].Subject)
+	})
+	sort.Slice(d.APIKeys, func(i, j int) bool { return d.APIKeys[i].ID < d.APIKeys[j].ID })
+	sort.Slice(d.Novels, func(i, j int) bool { return d.Novels[i].ID < d.Novels[j].ID })
+	sort.Slice(d.Chapters, func(i, j int) bool { return d.Chapters[i].ID < d.Chapters[j].ID })
+	sort.Slice(d.Revisions, func(i, j int) bool { return lessRevision(d.Revisions[i], d.Revisions[j]) })
+	sort.Slice(d.Comments, func(i, j int) bool { return d.Comments[i].ID < d.Comments[j].ID })
+	sort.Slice(d.Bookmarks, func(i, j int) bool {
+		if d.Bookmarks[i].UserID != d.Bookmarks[j].UserID {
+			return d.Bookmarks[i].UserID < d.Bookmarks[j].UserID
+		}
+		return d.Bookmarks[i].NovelID < d.Bookmarks[j].NovelID
+	})
+	return d, nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"novella/internal/model"
+)
+
+var (
+	errNoEmail         = errors.New("the identity provider did not share an email address")
+	errUnverifiedEmail = errors.New("the identity provider has not verified this email address")
+)
+
+// ExternalAccount is what an identity provider asserted about the user
+// signing in.
+type ExternalAccount struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+func identityKey(provider, subject string) string {
+	return provider + ":" + subject
+}
+
+func newIdentity(userID int64, acct ExternalAccount) model.Identity {
+	return model.Identity{
+		Provider:  acct.Provider,
+		Subject:   acct.Subject,
+		UserID:    userID,
+		Email:     strings.TrimSpace(acct.Email),
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// checkExternalEmail refuses a first sign-in whose email the identity
+// provider has not verified: the account it creates claims that email.
+func checkExternalEmail(acct ExternalAccount) error {
+	if normalize(acct.Email) == "" {
+		return errNoEmail
+	}
+	if !acct.EmailVerified {
+		return errUnverifiedEmail
+	}
+	return nil
+}
+
+// newExternalUser is the account registered on a first sign-in with an
+// identity provider. It has no password until the user sets one through a
+// password reset.
+func newExternalUser(acct ExternalAccount, username string) model.User {
+	now := time.Now().UTC()
+	return model.User{
+		Username:        username,
+		Email:           strings.TrimSpace(acct.Email),
+		Role:            defaultRole,
+		CreatedAt:       now,
+		EmailVerifiedAt: &now,
+	}
+}
+
+// pickUsername derives a free username from the email address, adding a
+// number when the plain name is taken.
+func pickUsername(email string, taken func(norm string) (bool, error)) (string, error) {
+	base, _, _ := strings.Cut(strings.TrimSpace(email), "@")
+	if base == "" {
+		base = "reader"
+	}
+	name := base
+	for i := 2; ; i++ {
+		exists, err := taken(normalize(name))
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return name, nil
+		}
+		if i > 1000 {
+			return "", fmt.Errorf("%w: no free username for %q", ErrConflict, base)
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
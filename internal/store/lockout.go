@@ -0,0 +1,70 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"novella/internal/model"
+	"novella/internal/ratelimit"
+)
+
+// An account allows freeLoginFailures wrong passwords within
+// loginFailureWindow; each one after that locks it, for loginLockoutBase at
+// first and twice as long every time, up to loginLockoutMax.
+const (
+	freeLoginFailures  = 5
+	loginLockoutBase   = time.Minute
+	loginLockoutMax    = time.Hour
+	loginFailureWindow = 24 * time.Hour
+)
+
+var ErrLocked = errors.New("account temporarily locked")
+
+// LockedError is returned by Login while the account is locked. The
+// password is not checked until Until.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string { return ErrLocked.Error() }
+
+func (e *LockedError) Unwrap() error { return ErrLocked }
+
+func loginLocked(u model.User, now time.Time) error {
+	if u.LockedUntil != nil && now.Before(*u.LockedUntil) {
+		return &LockedError{Until: *u.LockedUntil}
+	}
+	return nil
+}
+
+func countLoginFailure(u *model.User, now time.Time) {
+	if u.LastFailedLogin == nil || now.Sub(*u.LastFailedLogin) > loginFailureWindow {
+		u.FailedLogins = 0
+	}
+	u.FailedLogins++
+	u.LastFailedLogin = &now
+	if u.FailedLogins > freeLoginFailures {
+		until := now.Add(ratelimit.Backoff(u.FailedLogins-freeLoginFailures-1, loginLockoutBase, loginLockoutMax))
+		u.LockedUntil = &until
+	}
+}
+
+// clearLoginFailures reports whether there was anything to clear.
+func clearLoginFailures(u *model.User) bool {
+	if u.FailedLogins == 0 && u.LastFailedLogin == nil && u.LockedUntil == nil {
+		return false
+	}
+	u.FailedLogins = 0
+	u.LastFailedLogin = nil
+	u.LockedUntil = nil
+	return true
+}
+
+// failedLogin is the error for a wrong password that countLoginFailure has
+// counted against u.
+func failedLogin(u model.User, now time.Time) error {
+	if err := loginLocked(u, now); err != nil {
+		return err
+	}
+	return ErrUnauthorized
+}
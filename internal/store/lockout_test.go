@@ -0,0 +1,61 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"novella/internal/totp"
+)
+
+func TestWrongCodesLockAccount(t *testing.T) {
+	sqlStore, err := OpenSQLite(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlStore.Close()
+
+	for name, b := range map[string]Backend{"json": New(), "sqlite": sqlStore} {
+		t.Run(name, func(t *testing.T) {
+			const password = "correct horse battery"
+			user, _, err := b.Register("ada", "ada@example.com", password, Client{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			re := Reauth{Password: password}
+			setup, err := b.BeginTwoFactor(user.ID, re)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := totp.Code(setup.Secret, totp.Step(time.Now()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.EnableTwoFactor(user.ID, re, code); err != nil {
+				t.Fatal(err)
+			}
+
+			// Each attempt starts a fresh challenge, so only the account
+			// lockout stands between the password and the code.
+			for i := range freeLoginFailures + 1 {
+				_, _, err := b.Login("ada@example.com", password, Client{})
+				var challenge *Challenge
+				if !errors.As(err, &challenge) {
+					t.Fatalf("login %d: got %v, want a challenge", i, err)
+				}
+				_, _, err = b.CompleteLogin(challenge.Token, "wrong", Client{})
+				want := ErrUnauthorized
+				if i == freeLoginFailures {
+					want = ErrLocked
+				}
+				if !errors.Is(err, want) {
+					t.Fatalf("code %d: got %v, want %v", i, err, want)
+				}
+			}
+			if _, _, err := b.Login("ada@example.com", password, Client{}); !errors.Is(err, ErrLocked) {
+				t.Fatalf("login after wrong codes: got %v, want %v", err, ErrLocked)
+			}
+		})
+	}
+}
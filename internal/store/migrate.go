@@ -0,0 +1,304 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"novella/internal/model"
+)
+
+// schemaVersion is the version of the snapshot and journal format this build
+// writes. Bump it together with a new entry in migrations whenever a change to
+// the model or to persistentState would not round-trip through older files.
+const schemaVersion = 15
+
+// migration upgrades data written at version-1 to version. snapshot rewrites
+// the raw snapshot document; op, when set, rewrites a single journal op.
+type migration struct {
+	version  int
+	name     string
+	snapshot func(doc map[string]json.RawMessage) error
+	op       func(op *walOp) error
+}
+
+var migrations = []migration{
+	{
+		version:  1,
+		name:     "drop stored secondary indexes",
+		snapshot: migrateDropIndexes,
+	},
+	{
+		version:  2,
+		name:     "hash session tokens",
+		snapshot: migrateHashSessions,
+		op:       migrateHashSessionOp,
+	},
+	{
+		version:  3,
+		name:     "session records",
+		snapshot: migrateSessionRecords,
+		op:       migrateSessionRecordOp,
+	},
+	recordMigration(4, "access token expiry", "sessions", []string{kindSession}, setAccessExpiry),
+	{
+		// New record kinds only; the version keeps older builds from
+		// dropping them.
+		version: 5,
+		name:    "account tokens and mail outbox",
+	},
+	{
+		version: 6,
+		name:    "two-factor authentication",
+	},
+	{
+		version: 7,
+		name:    "external identities",
+	},
+	recordMigration(8, "user roles", "users_by_id", []string{kindUser}, setDefaultRole),
+	{
+		version: 9,
+		name:    "api keys",
+	},
+	{
+		version: 10,
+		name:    "login lockout",
+	},
+	{
+		version: 11,
+		name:    "user profiles",
+	},
+	{
+		version: 12,
+		name:    "chapter revisions",
+	},
+	{
+		version: 13,
+		name:    "scheduled publishing",
+	},
+	recordMigration(14, "chapter status", "chapters_by_id", []string{kindChapter}, setChapterStatus),
+	recordMigration(15, "chapter formats", "chapters_by_id", []string{kindChapter}, setChapterFormat),
+}
+
+// Files written before versioning carried the lookup maps alongside the
+// entities. They are rebuilt on load now, and a stale copy would shadow them.
+func migrateDropIndexes(doc map[string]json.RawMessage) error {
+	for _, key := range []string{"users_by_email", "users_by_username", "chapter_ids_by_novel", "comment_ids_by_novel"} {
+		delete(doc, key)
+	}
+	return nil
+}
+
+func migrateHashSessions(doc map[string]json.RawMessage) error {
+	raw, ok := doc["sessions"]
+	if !ok {
+		return nil
+	}
+	var sessions map[string]int64
+	if err := json.Unmarshal(raw, &sessions); err != nil {
+		return err
+	}
+	hashed := make(map[string]int64, len(sessions))
+	for token, uid := range sessions {
+		hashed[hashToken(token)] = uid
+	}
+	out, err := json.Marshal(hashed)
+	if err != nil {
+		return err
+	}
+	doc["sessions"] = out
+	return nil
+}
+
+func migrateHashSessionOp(op *walOp) error {
+	if op.Kind == kindSession {
+		op.Key = hashToken(op.Key)
+	}
+	return nil
+}
+
+// Sessions used to map a token digest straight to a user ID. They become
+// records keyed by session ID; the original creation time is unknown, so the
+// session counts as created and last seen now.
+func migrateSessionRecords(doc map[string]json.RawMessage) error {
+	raw, ok := doc["sessions"]
+	if !ok {
+		return nil
+	}
+	var sessions map[string]int64
+	if err := json.Unmarshal(raw, &sessions); err != nil {
+		return err
+	}
+	records := make(map[string]sessionRecord, len(sessions))
+	for tokenHash, uid := range sessions {
+		r := legacySessionRecord(tokenHash, uid)
+		records[r.ID] = r
+	}
+	out, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	doc["sessions"] = out
+	return nil
+}
+
+func migrateSessionRecordOp(op *walOp) error {
+	if op.Kind != kindSession {
+		return nil
+	}
+	if op.Del {
+		op.Key = legacySessionID(op.Key)
+		return nil
+	}
+	var uid int64
+	if err := json.Unmarshal(op.Value, &uid); err != nil {
+		return err
+	}
+	r := legacySessionRecord(op.Key, uid)
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	op.Key, op.Value = r.ID, value
+	return nil
+}
+
+func legacySessionRecord(tokenHash string, uid int64) sessionRecord {
+	now := time.Now().UTC()
+	return newSessionRecord(model.Session{
+		ID:         legacySessionID(tokenHash),
+		UserID:     uid,
+		TokenHash:  tokenHash,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(DefaultSessionTTL),
+	})
+}
+
+// Sessions opened before refresh tokens keep their token until the session
+// itself expires; the client logs in again after that.
+func setAccessExpiry(sess map[string]json.RawMessage) {
+	sess["access_expires_at"] = sess["expires_at"]
+}
+
+// Everyone could publish before roles existed, so existing accounts become
+// authors.
+func setDefaultRole(u map[string]json.RawMessage) {
+	if _, ok := u["role"]; !ok {
+		u["role"] = json.RawMessage(`"` + model.RoleAuthor + `"`)
+	}
+}
+
+// Chapters were all published before they had a status, except those still
+// waiting for their publish_at, which become scheduled drafts.
+func setChapterStatus(ch map[string]json.RawMessage) {
+	if _, ok := ch["status"]; ok {
+		return
+	}
+	status := model.ChapterPublished
+	if at, ok := ch["publish_at"]; ok && string(at) != "null" {
+		status = model.ChapterDraft
+	}
+	ch["status"] = json.RawMessage(`"` + status + `"`)
+}
+
+// Chapters were plain text before they had a format.
+func setChapterFormat(ch map[string]json.RawMessage) {
+	if _, ok := ch["format"]; !ok {
+		ch["format"] = json.RawMessage(`"` + model.FormatPlain + `"`)
+	}
+}
+
+// recordMigration is a migration that applies fix to each record stored
+// under key in the snapshot and to each put of one of kinds in the journal.
+func recordMigration(version int, name, key string, kinds []string, fix func(map[string]json.RawMessage)) migration {
+	return migration{
+		version: version,
+		name:    name,
+		snapshot: func(doc map[string]json.RawMessage) error {
+			raw, ok := doc[key]
+			if !ok {
+				return nil
+			}
+			var records map[string]map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &records); err != nil {
+				return err
+			}
+			for _, r := range records {
+				fix(r)
+			}
+			out, err := json.Marshal(records)
+			if err != nil {
+				return err
+			}
+			doc[key] = out
+			return nil
+		},
+		op: func(op *walOp) error {
+			if op.Del || !slices.Contains(kinds, op.Kind) {
+				return nil
+			}
+			var r map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &r); err != nil {
+				return err
+			}
+			fix(r)
+			value, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			op.Value = value
+			return nil
+		},
+	}
+}
+
+func checkVersion(v int) error {
+	if v < 0 || v > schemaVersion {
+		return fmt.Errorf("schema version %d is not supported by this build (max %d)", v, schemaVersion)
+	}
+	return nil
+}
+
+func migrateSnapshot(doc map[string]json.RawMessage) (int, error) {
+	from := 0
+	if raw, ok := doc["version"]; ok {
+		if err := json.Unmarshal(raw, &from); err != nil {
+			return 0, fmt.Errorf("invalid schema version: %w", err)
+		}
+	}
+	if err := checkVersion(from); err != nil {
+		return 0, err
+	}
+	for _, m := range migrations {
+		if m.version <= from {
+			continue
+		}
+		if m.snapshot != nil {
+			if err := m.snapshot(doc); err != nil {
+				return 0, fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		doc["version"] = json.RawMessage(fmt.Sprint(m.version))
+	}
+	return from, nil
+}
+
+func migrateEntry(entry *walEntry) error {
+	if err := checkVersion(entry.Version); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= entry.Version || m.op == nil {
+			continue
+		}
+		for i := range entry.Ops {
+			if err := m.op(&entry.Ops[i]); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+	}
+	entry.Version = schemaVersion
+	return nil
+}
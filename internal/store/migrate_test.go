@@ -0,0 +1,387 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"novella/internal/model"
+)
+
+func TestMigrationsInOrder(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Fatalf("migration %q has version %d, want %d", m.name, m.version, i+1)
+		}
+	}
+	if last := migrations[len(migrations)-1].version; last != schemaVersion {
+		t.Fatalf("last migration is version %d, but schemaVersion is %d", last, schemaVersion)
+	}
+	for i, m := range sqlMigrations {
+		if m.version != i+1 {
+			t.Fatalf("sql migration %q has version %d, want %d", m.name, m.version, i+1)
+		}
+	}
+}
+
+// Every fixture under testdata/json is named for the schema version it was
+// written at, and holds the same data: ada's novel 1 with chapters One and
+// Two, and a comment by each of ada and bo. Fixtures with a journal were
+// compacted after ada's chapter One; the rest of the data is in the journal.
+func TestMigrateJSON(t *testing.T) {
+	tests := []struct {
+		fixture string
+		check   func(t *testing.T, s *Store)
+	}{
+		{"v0-indexes.json", func(t *testing.T, s *Store) {
+			checkSignedIn(t, s, map[string]int64{
+				"1f0b35ef8ad276c7eb460b356d3597ddc01e557cecde747d3d5afa983c69fc1d": 1,
+			})
+		}},
+		{"v0.json", func(t *testing.T, s *Store) {
+			checkSignedIn(t, s, map[string]int64{
+				"38fb626adaeccc303a7d68d6c64d51182a1b1885e46683003e92a0dc76eca48c": 1,
+				"54c1995538a59887dab9bf979fb63efbe259bacdb538590d7d2929167fffc9cf": 2,
+			})
+		}},
+		{"v1.json", func(t *testing.T, s *Store) {
+			checkSignedIn(t, s, map[string]int64{
+				"f8e8748da5b11407b35e3d01507da8a626d24688d51a3b5155add9bbb827f1c4": 1,
+				"ac250f6b4c1169db501d7a6000f6707d0a468d6bcded1f5ee7fd53f7cf806c87": 2,
+			})
+		}},
+		{"v2.json", func(t *testing.T, s *Store) {
+			checkSignedIn(t, s, map[string]int64{
+				"88aaf37419bf45103fefab6a1c9feffbad8fa97b86bf56e4c2b26d093ff065d1": 1,
+				"c9e9dd9a77ab2ef4ed3add63b9ea3c8a19cf7f8c4bc9a6391536ebc0b7ebd314": 2,
+			})
+		}},
+		{"v3.json", func(t *testing.T, s *Store) {
+			if len(s.sessionsByID) != 2 {
+				t.Fatalf("got %d sessions, want 2", len(s.sessionsByID))
+			}
+			for _, sess := range s.sessionsByID {
+				if !sess.AccessExpiresAt.Equal(sess.ExpiresAt) {
+					t.Errorf("session %s access expires at %v, want %v", sess.ID, sess.AccessExpiresAt, sess.ExpiresAt)
+				}
+			}
+		}},
+		{"v4.json", nil},
+		{"v5.json", nil},
+		{"v6.json", nil},
+		{"v7.json", func(t *testing.T, s *Store) {
+			for id, u := range s.usersByID {
+				if u.Role != model.RoleAuthor {
+					t.Errorf("user %d has role %q, want author", id, u.Role)
+				}
+			}
+		}},
+		{"v8.json", nil},
+		{"v9.json", nil},
+		{"v10.json", nil},
+		{"v11.json", func(t *testing.T, s *Store) {
+			checkFirstRevision(t, s)
+		}},
+		{"v12.json", nil},
+		{"v13.json", func(t *testing.T, s *Store) {
+			checkChapterStatus(t, s)
+		}},
+		{"v14.json", func(t *testing.T, s *Store) {
+			checkChapterFormat(t, s)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			s, path := openJSONFixture(t, tt.fixture)
+			checkFixture(t, s)
+			if tt.check != nil {
+				tt.check(t, s)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				t.Fatal(err)
+			}
+			var version int
+			if err := json.Unmarshal(doc["version"], &version); err != nil || version != schemaVersion {
+				t.Errorf("snapshot version = %s after upgrade, want %d", doc["version"], schemaVersion)
+			}
+			if _, ok := doc["users_by_email"]; ok {
+				t.Error("upgraded snapshot still stores its indexes")
+			}
+
+			s, err = NewWithDB(path)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			defer s.Close()
+			if s.migrated {
+				t.Error("upgraded files were migrated again")
+			}
+			checkFixture(t, s)
+			if tt.check != nil {
+				tt.check(t, s)
+			}
+		})
+	}
+}
+
+func TestMigrateJSONTooNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	doc, err := json.Marshal(map[string]int{"version": schemaVersion + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, doc, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWithDB(path); err == nil {
+		t.Fatal("opened a snapshot from a newer build")
+	}
+}
+
+// The fixtures under testdata/sqlite are dumps of databases holding the same
+// data as the JSON ones, taken at the user_version in their name.
+func TestMigrateSQLite(t *testing.T) {
+	tests := []struct {
+		fixture string
+		check   func(t *testing.T, s *SQLStore)
+	}{
+		{"v1.sql", func(t *testing.T, s *SQLStore) {
+			checkSignedIn(t, s, map[string]int64{
+				"e020481f39d6000d82ad596fece4d980f205a78801ea7828d8ebbafa69f56d9c": 1,
+				"d5621702fe6eaae86793d2669fe2024505cc714da0001295a9f1cb4edf829874": 2,
+			})
+		}},
+		{"v2.sql", func(t *testing.T, s *SQLStore) {
+			checkSignedIn(t, s, map[string]int64{
+				"350bde6cfe65baff8e837d9bc503128ff8e4ec19de40a5a2cb4e4238c8ead651": 1,
+				"5ef53a7bb0cd67b03a5582f995ae318229e7ca96838ca03cda63bead5c8d2e81": 2,
+			})
+		}},
+		{"v3.sql", func(t *testing.T, s *SQLStore) {
+			var n int
+			if err := s.db.QueryRow(`SELECT COUNT(*) FROM sessions WHERE access_expires_at = expires_at`).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			if n != 2 {
+				t.Errorf("%d sessions have their access expiry set, want 2", n)
+			}
+		}},
+		{"v4.sql", nil},
+		{"v5.sql", func(t *testing.T, s *SQLStore) {
+			u, err := userByID(s.db, 1)
+			if err != nil || u.Username != "ada" || u.TwoFactorEnabled {
+				t.Errorf("user 1 = %+v (%v), want ada without two-factor", u, err)
+			}
+		}},
+		{"v6.sql", nil},
+		{"v7.sql", func(t *testing.T, s *SQLStore) {
+			for _, id := range []int64{1, 2} {
+				u, err := userByID(s.db, id)
+				if err != nil || u.Role != model.RoleAuthor {
+					t.Errorf("user %d has role %q (%v), want author", id, u.Role, err)
+				}
+			}
+		}},
+		{"v8.sql", nil},
+		{"v9.sql", nil},
+		{"v10.sql", nil},
+		{"v11.sql", func(t *testing.T, s *SQLStore) {
+			d := AccountDeletion{Reauth: Reauth{Password: "correct horse battery"}}
+			if err := s.DeleteAccount(2, d); err != nil {
+				t.Fatalf("delete bo: %v", err)
+			}
+			comments, err := s.ListComments(1, 1, nil)
+			if err != nil || len(comments) != 2 {
+				t.Fatalf("comments = %+v (%v), want both kept", comments, err)
+			}
+			for _, c := range comments {
+				if c.Body == "Hello" && c.UserID != 0 {
+					t.Errorf("bo's comment still has author %d", c.UserID)
+				}
+			}
+		}},
+		{"v12.sql", func(t *testing.T, s *SQLStore) {
+			checkFirstRevision(t, s)
+		}},
+		{"v13.sql", nil},
+		{"v14.sql", func(t *testing.T, s *SQLStore) {
+			checkChapterStatus(t, s)
+		}},
+		{"v15.sql", func(t *testing.T, s *SQLStore) {
+			checkChapterFormat(t, s)
+		}},
+	}
+	latest := sqlMigrations[len(sqlMigrations)-1].version
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			s := openSQLFixture(t, tt.fixture)
+			var version int
+			if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+				t.Fatal(err)
+			}
+			if version != latest {
+				t.Errorf("user_version = %d after upgrade, want %d", version, latest)
+			}
+			checkFixture(t, s)
+			if tt.check != nil {
+				tt.check(t, s)
+			}
+		})
+	}
+}
+
+func TestMigrateSQLiteTooNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, len(sqlMigrations)+1))
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := OpenSQLite(path); err == nil {
+		s.Close()
+		t.Fatal("opened a database from a newer build")
+	}
+}
+
+// openJSONFixture copies testdata/json/<name> and its journal, if any, into a
+// temporary directory and opens the store there, which upgrades both files.
+func openJSONFixture(t *testing.T, name string) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db.json")
+	for _, suffix := range []string{"", ".wal"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "json", name+suffix))
+		if os.IsNotExist(err) && suffix != "" {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path+suffix, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := NewWithDB(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	return s, path
+}
+
+// openSQLFixture loads the dump testdata/sqlite/<name> into a new database
+// and opens it, which upgrades it.
+func openSQLFixture(t *testing.T, name string) *SQLStore {
+	t.Helper()
+	dump, err := os.ReadFile(filepath.Join("testdata", "sqlite", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(string(dump))
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// checkFixture checks the data every fixture holds.
+func checkFixture(t *testing.T, b Backend) {
+	t.Helper()
+	chapters, err := b.ListChapters(1, 1)
+	if err != nil {
+		t.Fatalf("chapters: %v", err)
+	}
+	if len(chapters) != 2 || chapters[0].Title != "One" || chapters[1].Title != "Two" {
+		t.Errorf("chapters = %+v, want One and Two", chapters)
+	}
+	comments, err := b.ListComments(1, 1, nil)
+	if err != nil {
+		t.Fatalf("comments: %v", err)
+	}
+	if len(comments) != 2 {
+		t.Errorf("got %d comments, want 2", len(comments))
+	}
+}
+
+// checkSignedIn checks that each token, issued before sessions were
+// records, still signs in its user with the session it was migrated to.
+func checkSignedIn(t *testing.T, b Backend, tokens map[string]int64) {
+	t.Helper()
+	for token, uid := range tokens {
+		u, sess, err := b.Authenticate(token)
+		if err != nil || u.ID != uid {
+			t.Errorf("token %.8s… signs in user %d (%v), want %d", token, u.ID, err, uid)
+			continue
+		}
+		if want := legacySessionID(hashToken(token)); sess.ID != want {
+			t.Errorf("token %.8s… is in session %s, want %s", token, sess.ID, want)
+		}
+	}
+}
+
+// checkFirstRevision checks that chapter One, written before revisions were
+// kept, shows its current content as revision 1.
+func checkFirstRevision(t *testing.T, b Backend) {
+	t.Helper()
+	revs, err := b.ListRevisions(1, 1, 1)
+	if err != nil || len(revs) != 1 {
+		t.Fatalf("revisions = %+v (%v), want one", revs, err)
+	}
+	r, err := b.RevisionByNumber(1, 1, 1, 1)
+	if err != nil || r.Content != "First chapter, revised." {
+		t.Errorf("revision 1 = %q (%v), want the current content", r.Content, err)
+	}
+}
+
+// checkChapterStatus checks that chapter One became published and chapter
+// Two, still waiting for its publish_at, a draft.
+func checkChapterStatus(t *testing.T, b Backend) {
+	t.Helper()
+	for id, want := range map[int64]model.ChapterStatus{1: model.ChapterPublished, 2: model.ChapterDraft} {
+		ch, err := b.ChapterByID(1, id, 1)
+		if err != nil || ch.Status != want {
+			t.Errorf("chapter %d has status %q (%v), want %q", id, ch.Status, err, want)
+		}
+	}
+}
+
+// checkChapterFormat checks that chapters written before formats existed
+// became plain text.
+func checkChapterFormat(t *testing.T, b Backend) {
+	t.Helper()
+	for _, id := range []int64{1, 2} {
+		ch, err := b.ChapterByID(1, id, 1)
+		if err != nil || ch.Format != model.FormatPlain {
+			t.Errorf("chapter %d has format %q (%v), want %q", id, ch.Format, err, model.FormatPlain)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultSessionTTL is how long a session stays valid after it was last used.
+// DefaultAccessTokenTTL is how long a bearer token is accepted before the
+// client has to refresh it.
+const (
+	DefaultSessionTTL     = 30 * 24 * time.Hour
+	DefaultAccessTokenTTL = 15 * time.Minute
+)
+
+var ErrEncryptionUnsupported = errors.New("encryption at rest is only supported by the json driver")
+
+type options struct {
+	key        []byte
+	sessionTTL time.Duration
+	accessTTL  time.Duration
+}
+
+type Option func(*options) error
+
+func buildOptions(opts []Option) (options, error) {
+	o := options{sessionTTL: DefaultSessionTTL, accessTTL: DefaultAccessTokenTTL}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return options{}, err
+		}
+	}
+	return o, nil
+}
+
+// WithEncryptionKey encrypts the JSON database at rest with AES-256-GCM. A
+// nil key leaves the files in plaintext.
+func WithEncryptionKey(key []byte) Option {
+	return func(o *options) error {
+		if key != nil && len(key) != 32 {
+			return fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+		}
+		o.key = key
+		return nil
+	}
+}
+
+// WithSessionTTL sets the sliding expiry of sessions: each use pushes the
+// expiry to ttl from now.
+func WithSessionTTL(ttl time.Duration) Option {
+	return func(o *options) error {
+		if ttl <= 0 {
+			return fmt.Errorf("session ttl must be positive, got %s", ttl)
+		}
+		o.sessionTTL = ttl
+		return nil
+	}
+}
+
+// WithAccessTokenTTL sets how long an access token is valid. It is capped by
+// the session TTL.
+func WithAccessTokenTTL(ttl time.Duration) Option {
+	return func(o *options) error {
+		if ttl <= 0 {
+			return fmt.Errorf("access token ttl must be positive, got %s", ttl)
+		}
+		o.accessTTL = ttl
+		return nil
+	}
+}
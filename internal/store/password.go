@@ -0,0 +1,101 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Password hashes are stored in the PHC string format,
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+//
+// so the algorithm and its cost can change without a schema migration. Hashes
+// from before the switch are a hex SHA-256 of salt+":"+password, with the salt
+// in its own field; they are verified as such and replaced on the next login.
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	saltLen int
+	keyLen  uint32
+}
+
+var passwordParams = argon2Params{
+	memory:  64 * 1024,
+	time:    3,
+	threads: 2,
+	saltLen: 16,
+	keyLen:  32,
+}
+
+const argon2Prefix = "$argon2id$"
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// dummyHash is verified against when no user matches a login, so that the
+// response time does not reveal which email addresses are registered.
+var dummyHash, _ = hashPassword("novella dummy password")
+
+func hashPassword(password string) (string, error) {
+	p := passwordParams
+	salt := make([]byte, p.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword reports whether password matches the stored hash, and
+// whether the hash should be replaced because it uses the legacy scheme or
+// outdated parameters.
+func verifyPassword(legacySalt, hash, password string) (ok, rehash bool) {
+	if !strings.HasPrefix(hash, argon2Prefix) {
+		sum := sha256.Sum256([]byte(legacySalt + ":" + password))
+		want := []byte(hex.EncodeToString(sum[:]))
+		return subtle.ConstantTimeCompare(want, []byte(hash)) == 1, true
+	}
+	p, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return false, false
+	}
+	got := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, false
+	}
+	return true, p != passwordParams
+}
+
+func decodeArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(strings.TrimPrefix(hash, argon2Prefix), "$")
+	if len(parts) != 4 {
+		return p, nil, nil, errInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, errInvalidHash
+	}
+	p.saltLen, p.keyLen = len(salt), uint32(len(key))
+	return p, salt, key, nil
+}
@@ -2,51 +2,154 @@ package store
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"novella/internal/model"
 )
 
+const minCompactBytes = 1 << 20
+
+var errCorruptSnapshot = errors.New("corrupt snapshot")
+
+// persistentState is the snapshot written on compaction. Secondary indexes
+// are not stored; they are rebuilt from the entity maps on load.
 type persistentState struct {
-	UsersByID         map[int64]model.User      `json:"users_by_id"`
-	UsersByEmail      map[string]int64          `json:"users_by_email"`
-	UsersByUsername   map[string]int64          `json:"users_by_username"`
-	NovelsByID        map[int64]model.Novel     `json:"novels_by_id"`
-	ChaptersByID      map[int64]model.Chapter   `json:"chapters_by_id"`
-	ChapterIDsByNovel map[int64][]int64         `json:"chapter_ids_by_novel"`
-	CommentsByID      map[int64]model.Comment   `json:"comments_by_id"`
-	CommentIDsByNovel map[int64][]int64         `json:"comment_ids_by_novel"`
-	Bookmarks         map[string]model.Bookmark `json:"bookmarks"`
-	Sessions          map[string]int64          `json:"sessions"`
-	NextUserID        int64                     `json:"next_user_id"`
-	NextNovelID       int64                     `json:"next_novel_id"`
-	NextChapterID     int64                     `json:"next_chapter_id"`
-	NextCommentID     int64                     `json:"next_comment_id"`
+	Version       int                           `json:"version"`
+	Seq           uint64                        `json:"seq"`
+	UsersByID     map[int64]userRecord          `json:"users_by_id"`
+	NovelsByID    map[int64]model.Novel         `json:"novels_by_id"`
+	ChaptersByID  map[int64]model.Chapter       `json:"chapters_by_id"`
+	Revisions     map[string]model.Revision     `json:"revisions"`
+	CommentsByID  map[int64]model.Comment       `json:"comments_by_id"`
+	Bookmarks     map[string]model.Bookmark     `json:"bookmarks"`
+	Sessions      map[string]sessionRecord      `json:"sessions"`
+	RefreshTokens map[string]model.RefreshToken `json:"refresh_tokens"`
+	UserTokens    map[string]model.UserToken    `json:"user_tokens"`
+	Outbox        map[int64]model.OutboxMessage `json:"outbox"`
+	Identities    map[string]model.Identity     `json:"identities"`
+	APIKeys       map[string]apiKeyRecord       `json:"api_keys"`
+	NextUserID    int64                         `json:"next_user_id"`
+	NextNovelID   int64                         `json:"next_novel_id"`
+	NextChapterID int64                         `json:"next_chapter_id"`
+	NextCommentID int64                         `json:"next_comment_id"`
+	NextMailID    int64                         `json:"next_mail_id"`
 }
 
 func (s *Store) loadLocked() error {
-	data, err := os.ReadFile(s.dbPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+	dir := filepath.Dir(s.dbPath)
+	if dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
 		}
-		return err
 	}
 
-	var state persistentState
-	if err := json.Unmarshal(data, &state); err != nil {
+	recovered, err := s.readLocked()
+	if err != nil {
+		return err
+	}
+	if err := s.openJournalLocked(); err != nil {
 		return err
 	}
+	if recovered {
+		if err := os.Rename(s.dbPath, s.dbPath+".corrupt"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.restoreSnapshotLocked()
+	}
+	if s.migrated {
+		log.Printf("store: upgraded %s to schema version %d", s.dbPath, schemaVersion)
+	}
+	if s.unencrypted {
+		log.Printf("store: encrypting %s", s.dbPath)
+	}
+	if s.migrated || s.unencrypted {
+		return s.rewriteGenerationsLocked()
+	}
+	if s.journalSize >= s.compactThreshold() {
+		return s.compactLocked()
+	}
+	return nil
+}
+
+// readLocked loads the snapshot and replays both journal segments without
+// writing to any file. It reports whether the snapshot had to be rebuilt from
+// the previous generation.
+func (s *Store) readLocked() (bool, error) {
+	state, size, from, err := s.readSnapshot(s.dbPath)
+	recovered := false
+	if err != nil {
+		if !os.IsNotExist(err) && !errors.Is(err, errCorruptSnapshot) {
+			return false, fmt.Errorf("load %s: %w", s.dbPath, err)
+		}
+		prev, prevSize, prevFrom, prevErr := s.readSnapshot(s.prevPath())
+		switch {
+		case prevErr == nil:
+			log.Printf("store: %s is unusable (%v); recovering from %s", s.dbPath, err, s.prevPath())
+			state, size, from, recovered = prev, prevSize, prevFrom, true
+		case os.IsNotExist(err) && os.IsNotExist(prevErr):
+		default:
+			return false, fmt.Errorf("load %s: %w", s.dbPath, err)
+		}
+	}
+	s.restoreLocked(state)
+	s.snapshotSize = size
+	s.migrated = size > 0 && from != schemaVersion
+
+	if _, err := s.replayJournalFileLocked(s.prevJournalPath()); err != nil {
+		return false, err
+	}
+	end, err := s.replayJournalFileLocked(s.journalPath())
+	if err != nil {
+		return false, err
+	}
+	s.journalSize = end
+	return recovered, nil
+}
 
-	if state.UsersByID != nil {
-		s.usersByID = state.UsersByID
+// readSnapshot decodes the snapshot at path, migrating it to schemaVersion,
+// and reports the version it was written at.
+func (s *Store) readSnapshot(path string) (persistentState, int64, int, error) {
+	var state persistentState
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return state, 0, 0, err
+	}
+	data, err := s.decodeSnapshot(raw)
+	if err != nil {
+		return state, 0, 0, err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return state, 0, 0, fmt.Errorf("%w: %v", errCorruptSnapshot, err)
+	}
+	from, err := migrateSnapshot(doc)
+	if err != nil {
+		return state, 0, 0, err
+	}
+	if from != schemaVersion {
+		if data, err = json.Marshal(doc); err != nil {
+			return state, 0, 0, err
+		}
 	}
-	if state.UsersByEmail != nil {
-		s.usersByEmail = state.UsersByEmail
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, 0, 0, fmt.Errorf("%w: %v", errCorruptSnapshot, err)
 	}
-	if state.UsersByUsername != nil {
-		s.usersByUsername = state.UsersByUsername
+	return state, int64(len(raw)), from, nil
+}
+
+func (s *Store) prevPath() string {
+	return s.dbPath + ".prev"
+}
+
+func (s *Store) restoreLocked(state persistentState) {
+	s.seq = state.Seq
+	for _, r := range state.UsersByID {
+		s.indexUserLocked(r.user())
 	}
 	if state.NovelsByID != nil {
 		s.novelsByID = state.NovelsByID
@@ -54,62 +157,237 @@ func (s *Store) loadLocked() error {
 	if state.ChaptersByID != nil {
 		s.chaptersByID = state.ChaptersByID
 	}
-	if state.ChapterIDsByNovel != nil {
-		s.chapterIDsByNovel = state.ChapterIDsByNovel
+	for _, r := range state.Revisions {
+		s.indexRevisionLocked(r)
 	}
 	if state.CommentsByID != nil {
 		s.commentsByID = state.CommentsByID
 	}
-	if state.CommentIDsByNovel != nil {
-		s.commentIDsByNovel = state.CommentIDsByNovel
-	}
 	if state.Bookmarks != nil {
 		s.bookmarks = state.Bookmarks
 	}
-	if state.Sessions != nil {
-		s.sessions = state.Sessions
+	for _, r := range state.Sessions {
+		s.indexSessionLocked(r.session())
+	}
+	for hash, rt := range state.RefreshTokens {
+		rt.TokenHash = hash
+		s.indexRefreshLocked(rt)
+	}
+	for hash, t := range state.UserTokens {
+		t.TokenHash = hash
+		s.userTokens[hash] = t
+	}
+	if state.Outbox != nil {
+		s.outbox = state.Outbox
+	}
+	if state.Identities != nil {
+		s.identities = state.Identities
+	}
+	for _, r := range state.APIKeys {
+		s.indexAPIKeyLocked(r.apiKey())
+	}
+
+	for id, ch := range s.chaptersByID {
+		s.chapterIDsByNovel[ch.NovelID] = append(s.chapterIDsByNovel[ch.NovelID], id)
+	}
+	for id, c := range s.commentsByID {
+		s.commentIDsByNovel[c.NovelID] = append(s.commentIDsByNovel[c.NovelID], id)
+	}
+	for _, ids := range s.chapterIDsByNovel {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	for _, ids := range s.commentIDsByNovel {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+
+	s.nextUserID = max(s.nextUserID, state.NextUserID)
+	s.nextNovelID = max(s.nextNovelID, state.NextNovelID)
+	s.nextChapterID = max(s.nextChapterID, state.NextChapterID)
+	s.nextCommentID = max(s.nextCommentID, state.NextCommentID)
+	s.nextMailID = max(s.nextMailID, state.NextMailID)
+}
+
+func (s *Store) stateLocked() persistentState {
+	users := make(map[int64]userRecord, len(s.usersByID))
+	for id, u := range s.usersByID {
+		users[id] = newUserRecord(u)
+	}
+	sessions := make(map[string]sessionRecord, len(s.sessionsByID))
+	for id, sess := range s.sessionsByID {
+		sessions[id] = newSessionRecord(sess)
+	}
+	revisions := make(map[string]model.Revision)
+	for _, revs := range s.revisions {
+		for _, r := range revs {
+			revisions[revisionKey(r.ChapterID, r.Number)] = r
+		}
+	}
+	apiKeys := make(map[string]apiKeyRecord, len(s.apiKeys))
+	for id, k := range s.apiKeys {
+		apiKeys[id] = newAPIKeyRecord(k)
+	}
+	return persistentState{
+		Version:       schemaVersion,
+		Seq:           s.seq,
+		UsersByID:     users,
+		NovelsByID:    s.novelsByID,
+		ChaptersByID:  s.chaptersByID,
+		Revisions:     revisions,
+		CommentsByID:  s.commentsByID,
+		Bookmarks:     s.bookmarks,
+		Sessions:      sessions,
+		RefreshTokens: s.refreshTokens,
+		UserTokens:    s.userTokens,
+		Outbox:        s.outbox,
+		Identities:    s.identities,
+		APIKeys:       apiKeys,
+		NextUserID:    s.nextUserID,
+		NextNovelID:   s.nextNovelID,
+		NextChapterID: s.nextChapterID,
+		NextCommentID: s.nextCommentID,
+		NextMailID:    s.nextMailID,
+	}
+}
+
+// compactThreshold keeps the journal no larger than the snapshot it sits on,
+// so rewriting the snapshot costs amortized O(1) per journaled byte.
+func (s *Store) compactThreshold() int64 {
+	return max(minCompactBytes, s.snapshotSize)
+}
+
+// compactLocked writes the current state as a new snapshot generation and
+// starts a fresh journal. The previous snapshot and journal segment are kept
+// as *.prev so a damaged snapshot can be rebuilt on the next start. Entries
+// left in the journal by a crash mid-compaction carry sequence numbers the
+// new snapshot already covers and are skipped on replay.
+func (s *Store) compactLocked() error {
+	data, err := s.marshalStateLocked()
+	if err != nil {
+		return err
+	}
+
+	if err := linkReplace(s.dbPath, s.prevPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := writeFileAtomic(s.dbPath, data, 0o600); err != nil {
+		return err
+	}
+	s.snapshotSize = int64(len(data))
+
+	if err := os.Rename(s.journalPath(), s.prevJournalPath()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.journalPath(), os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	old := s.journal
+	s.journal = f
+	s.journalSize = 0
+	if old != nil {
+		old.Close()
 	}
-	s.nextUserID = state.NextUserID
-	s.nextNovelID = state.NextNovelID
-	s.nextChapterID = state.NextChapterID
-	s.nextCommentID = state.NextCommentID
+	return syncDir(filepath.Dir(s.dbPath))
+}
 
+// restoreSnapshotLocked writes the state recovered from the previous
+// generation back as the snapshot. Unlike compactLocked it leaves both
+// journal segments alone: *.prev and its journal must still add up to the
+// current state in case the new snapshot is lost as well.
+func (s *Store) restoreSnapshotLocked() error {
+	data, err := s.marshalStateLocked()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.dbPath, data, 0o600); err != nil {
+		return err
+	}
+	s.snapshotSize = int64(len(data))
 	return nil
 }
 
-func (s *Store) persistLocked() error {
-	if s.dbPath == "" {
-		return nil
+// rewriteGenerationsLocked compacts twice so that the previous generation,
+// which is kept for recovery, is also rewritten in the current format and
+// with the current key. Older generations can hold raw session tokens.
+func (s *Store) rewriteGenerationsLocked() error {
+	if err := s.compactLocked(); err != nil {
+		return err
+	}
+	return s.compactLocked()
+}
+
+func (s *Store) marshalStateLocked() ([]byte, error) {
+	data, err := json.Marshal(s.stateLocked())
+	if err != nil {
+		return nil, err
 	}
+	return s.encodeSnapshot(data)
+}
 
-	state := persistentState{
-		UsersByID:         s.usersByID,
-		UsersByEmail:      s.usersByEmail,
-		UsersByUsername:   s.usersByUsername,
-		NovelsByID:        s.novelsByID,
-		ChaptersByID:      s.chaptersByID,
-		ChapterIDsByNovel: s.chapterIDsByNovel,
-		CommentsByID:      s.commentsByID,
-		CommentIDsByNovel: s.commentIDsByNovel,
-		Bookmarks:         s.bookmarks,
-		Sessions:          s.sessions,
-		NextUserID:        s.nextUserID,
-		NextNovelID:       s.nextNovelID,
-		NextChapterID:     s.nextChapterID,
-		NextCommentID:     s.nextCommentID,
-	}
-
-	data, err := json.MarshalIndent(state, "", "  ")
+// writeFileAtomic replaces path so that readers and crashes observe either
+// the old or the new contents, never a partial write.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
 	if err != nil {
 		return err
 	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
 
-	dir := filepath.Dir(s.dbPath)
-	if dir != "." {
-		if err := os.MkdirAll(dir, 0o755); err != nil {
-			return err
-		}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
 	}
+	return syncDir(dir)
+}
+
+// linkReplace makes dst a hard link to src's current contents, replacing dst
+// atomically.
+func linkReplace(src, dst string) error {
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
 
-	return os.WriteFile(s.dbPath, data, 0o600)
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.journal == nil {
+		return nil
+	}
+	err := s.journal.Close()
+	s.journal = nil
+	return err
 }
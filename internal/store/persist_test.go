@@ -0,0 +1,61 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecoverTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	s, err := NewWithDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	register := func(s *Store, name string) {
+		t.Helper()
+		if _, _, err := s.Register(name, name+"@example.com", "correct horse battery", Client{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compact := func(s *Store) {
+		t.Helper()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.compactLocked(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// reopen loses the current snapshot and loads the store again.
+	reopen := func(s *Store) *Store {
+		t.Helper()
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewWithDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	register(s, "ada")
+	compact(s)
+	register(s, "bo")
+	compact(s)
+	register(s, "cy")
+
+	s = reopen(s)
+	register(s, "di")
+	s = reopen(s)
+	defer s.Close()
+
+	for _, name := range []string{"ada", "bo", "cy", "di"} {
+		if _, ok := s.usersByUsername[name]; !ok {
+			t.Errorf("user %s is lost after the second recovery", name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"novella/internal/model"
+)
+
+// The authorization policy. Store methods resolve the requesting user to an
+// actor and ask it before reading or changing anything that is not the
+// user's own account, so both backends and every route apply the same rules.
+
+type permission uint
+
+const (
+	permPublish     permission = 1 << iota // create novels and edit one's own
+	permReadDrafts                         // read every draft
+	permModerate                           // delete any novel, chapter or comment, unpublish any novel or chapter
+	permEditAny                            // edit any novel or chapter
+	permManageUsers                        // look up, change and delete users
+)
+
+var rolePermissions = map[model.Role]permission{
+	model.RoleReader:    0,
+	model.RoleAuthor:    permPublish,
+	model.RoleModerator: permPublish | permReadDrafts | permModerate,
+	model.RoleAdmin:     permPublish | permReadDrafts | permModerate | permEditAny | permManageUsers,
+}
+
+// ErrLastAdmin keeps the only admin from giving up the role or deleting the
+// account, which would leave nobody able to manage users.
+var (
+	ErrLastAdmin   = errors.New("the last admin cannot be demoted or deleted")
+	errInvalidRole = errors.New("role must be reader, author, moderator or admin")
+	errDeleteSelf  = errors.New("delete your own account with DELETE /me")
+)
+
+// defaultRole is what new accounts get: anyone may write until an admin
+// demotes them to reader.
+const defaultRole = model.RoleAuthor
+
+// actor is the user a store method acts for. The zero actor is an anonymous
+// visitor, and a user without a known role has no permissions.
+type actor struct {
+	id   int64
+	role model.Role
+}
+
+func (a actor) can(p permission) bool {
+	return a.id != 0 && rolePermissions[a.role]&p == p
+}
+
+func (a actor) owns(userID int64) bool {
+	return a.id != 0 && a.id == userID
+}
+
+func (a actor) canReadNovel(n model.Novel) bool {
+	return n.Status == model.NovelPublished || a.owns(n.AuthorID) || a.can(permReadDrafts)
+}
+
+func (a actor) canCreateNovel() bool {
+	return a.can(permPublish)
+}
+
+// Authors edit their own novels only while they may publish.
+func (a actor) canEditNovel(n model.Novel) bool {
+	return (a.owns(n.AuthorID) && a.can(permPublish)) || a.can(permEditAny)
+}
+
+// canUpdateNovel also lets moderators take a novel down by setting it back to
+// draft, without letting them change what it says.
+func (a actor) canUpdateNovel(n model.Novel, takedown bool) bool {
+	return a.canEditNovel(n) || (takedown && a.can(permModerate))
+}
+
+// Authors can always delete their own work, even after being demoted.
+func (a actor) canDeleteNovel(n model.Novel) bool {
+	return a.owns(n.AuthorID) || a.can(permModerate)
+}
+
+// canDeleteChapter lets moderators remove a chapter as they can a novel.
+func (a actor) canDeleteChapter(n model.Novel) bool {
+	return a.canEditNovel(n) || a.can(permModerate)
+}
+
+// canReadUnreleased covers what readers of a novel do not see: chapters
+// that are not published and the history of every chapter, which can hold
+// text the author has since taken out.
+func (a actor) canReadUnreleased(n model.Novel) bool {
+	return a.owns(n.AuthorID) || a.can(permReadDrafts)
+}
+
+// canListChapter decides whether ch shows up among the chapters of n;
+// canReadChapter whether it can be opened at all, which unlisted chapters
+// can.
+func (a actor) canListChapter(n model.Novel, ch model.Chapter) bool {
+	return a.canReadNovel(n) && (ch.Status == model.ChapterPublished || a.canReadUnreleased(n))
+}
+
+func (a actor) canReadChapter(n model.Novel, ch model.Chapter) bool {
+	return a.canReadNovel(n) && (ch.Status != model.ChapterDraft || a.canReadUnreleased(n))
+}
+
+func (a actor) canDeleteComment(c model.Comment) bool {
+	return a.owns(c.UserID) || a.can(permModerate)
+}
+
+func (a actor) canManageUsers() bool {
+	return a.can(permManageUsers)
+}
+
+func isTakedown(title, description, genre string, status *model.NovelStatus, publishAt *time.Time) bool {
+	return title == "" && description == "" && genre == "" && status != nil && *status == model.NovelDraft && publishAt == nil
+}
+
+func isChapterTakedown(title, content string, format model.ContentFormat, position int, status *model.ChapterStatus, publishAt *time.Time) bool {
+	return title == "" && content == "" && format == "" && position == 0 && status != nil && *status == model.ChapterDraft && publishAt == nil
+}
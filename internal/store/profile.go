@@ -0,0 +1,118 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"novella/internal/model"
+)
+
+const (
+	maxDisplayName = 100
+	maxBio         = 2000
+	maxAvatarURL   = 2048
+)
+
+var errCurrentPassword = errors.New("current_password is required to change the email or password")
+
+// ProfileUpdate changes the fields that are not nil. Changing the email or
+// the password needs CurrentPassword; a new email address is unverified
+// until it is confirmed again.
+type ProfileUpdate struct {
+	Username        *string
+	Email           *string
+	DisplayName     *string
+	Bio             *string
+	AvatarURL       *string
+	Password        *string
+	CurrentPassword string
+}
+
+func (p ProfileUpdate) needsPassword(u model.User) bool {
+	return p.Password != nil || (p.Email != nil && normalize(*p.Email) != normalize(u.Email))
+}
+
+// checkPassword verifies the current password if p needs it and hashes the
+// new one, if any. Both are slow, so callers run it without holding locks.
+func (p ProfileUpdate) checkPassword(u model.User) (string, error) {
+	if !p.needsPassword(u) {
+		return "", nil
+	}
+	if p.CurrentPassword == "" {
+		return "", errCurrentPassword
+	}
+	if valid, _ := verifyPassword(u.PasswordSalt, u.PasswordHash, p.CurrentPassword); !valid {
+		return "", ErrUnauthorized
+	}
+	if p.Password == nil {
+		return "", nil
+	}
+	if *p.Password == "" {
+		return "", errors.New("password is required")
+	}
+	return hashPassword(*p.Password)
+}
+
+// apply validates p and writes it to u, with hash as the new password hash
+// if there is one.
+func (p ProfileUpdate) apply(u *model.User, hash string) error {
+	if p.Username != nil {
+		v := strings.TrimSpace(*p.Username)
+		if v == "" {
+			return errors.New("username is required")
+		}
+		u.Username = v
+	}
+	if p.Email != nil {
+		v := strings.TrimSpace(*p.Email)
+		if v == "" {
+			return errors.New("email is required")
+		}
+		if normalize(v) != normalize(u.Email) {
+			u.EmailVerifiedAt = nil
+		}
+		u.Email = v
+	}
+	if p.DisplayName != nil {
+		v := strings.TrimSpace(*p.DisplayName)
+		if utf8.RuneCountInString(v) > maxDisplayName {
+			return fmt.Errorf("display_name is longer than %d characters", maxDisplayName)
+		}
+		u.DisplayName = v
+	}
+	if p.Bio != nil {
+		v := strings.TrimSpace(*p.Bio)
+		if utf8.RuneCountInString(v) > maxBio {
+			return fmt.Errorf("bio is longer than %d characters", maxBio)
+		}
+		u.Bio = v
+	}
+	if p.AvatarURL != nil {
+		v := strings.TrimSpace(*p.AvatarURL)
+		if err := checkAvatarURL(v); err != nil {
+			return err
+		}
+		u.AvatarURL = v
+	}
+	if hash != "" {
+		u.PasswordSalt = ""
+		u.PasswordHash = hash
+	}
+	return nil
+}
+
+// An avatar is shown by clients as an image, so only absolute http(s) URLs
+// are accepted. The empty string removes it.
+func checkAvatarURL(v string) error {
+	if v == "" {
+		return nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(v) > maxAvatarURL {
+		return errors.New("avatar_url must be an http or https URL")
+	}
+	return nil
+}
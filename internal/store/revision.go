@@ -0,0 +1,42 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"novella/internal/model"
+)
+
+func countWords(content string) int {
+	return len(strings.Fields(content))
+}
+
+func newRevision(ch model.Chapter, number int, authorID int64, at time.Time) model.Revision {
+	return model.Revision{
+		ChapterID: ch.ID,
+		Number:    number,
+		AuthorID:  &authorID,
+		Content:   ch.Content,
+		Words:     countWords(ch.Content),
+		CreatedAt: at,
+	}
+}
+
+// baselineRevision stands in for the history of a chapter written before
+// revisions were kept: its current content, credited to the novel's author,
+// as revision 1. It is stored when the chapter next changes.
+func baselineRevision(ch model.Chapter, n model.Novel) model.Revision {
+	return newRevision(ch, 1, n.AuthorID, ch.UpdatedAt)
+}
+
+func revisionKey(chapterID int64, number int) string {
+	return fmt.Sprintf("%d:%d", chapterID, number)
+}
+
+func lessRevision(a, b model.Revision) bool {
+	if a.ChapterID != b.ChapterID {
+		return a.ChapterID < b.ChapterID
+	}
+	return a.Number < b.Number
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"novella/internal/model"
+)
+
+var (
+	errPublishAtPast    = errors.New("publish_at must be in the future")
+	errScheduledNovel   = errors.New("only draft novels can be scheduled")
+	errScheduledChapter = errors.New("only draft and unlisted chapters can be scheduled")
+	errChapterStatus    = errors.New("status must be draft, published or unlisted")
+)
+
+// reschedule applies a publish_at change to current: nil keeps it, the zero
+// time cancels it, and any other time must lie ahead of now.
+func reschedule(current, change *time.Time, now time.Time) (*time.Time, error) {
+	switch {
+	case change == nil:
+		return current, nil
+	case change.IsZero():
+		return nil, nil
+	case !change.After(now):
+		return nil, errPublishAtPast
+	}
+	t := change.UTC()
+	return &t, nil
+}
+
+// scheduleNovel applies status and publishAt to n. Publishing a scheduled
+// draft by hand cancels its schedule; a published novel cannot get one.
+func scheduleNovel(n *model.Novel, status *model.NovelStatus, publishAt *time.Time, now time.Time) error {
+	if status != nil {
+		if *status != model.NovelDraft && *status != model.NovelPublished {
+			return errors.New("invalid status")
+		}
+		n.Status = *status
+	}
+	var err error
+	if n.PublishAt, err = reschedule(n.PublishAt, publishAt, now); err != nil {
+		return err
+	}
+	if n.Status == model.NovelPublished && n.PublishAt != nil {
+		if publishAt != nil {
+			return errScheduledNovel
+		}
+		n.PublishAt = nil
+	}
+	return nil
+}
+
+// scheduleChapter does the same for chapters. A new chapter without a status
+// is published, or a draft if it is scheduled.
+func scheduleChapter(ch *model.Chapter, status *model.ChapterStatus, publishAt *time.Time, now time.Time) error {
+	switch {
+	case status != nil:
+		if !status.Valid() {
+			return errChapterStatus
+		}
+		ch.Status = *status
+	case ch.Status == "" && publishAt != nil && !publishAt.IsZero():
+		ch.Status = model.ChapterDraft
+	case ch.Status == "":
+		ch.Status = model.ChapterPublished
+	}
+	var err error
+	if ch.PublishAt, err = reschedule(ch.PublishAt, publishAt, now); err != nil {
+		return err
+	}
+	if ch.Status == model.ChapterPublished && ch.PublishAt != nil {
+		if publishAt != nil {
+			return errScheduledChapter
+		}
+		ch.PublishAt = nil
+	}
+	return nil
+}
+
+// sortEvents puts events in the order they were due, a novel ahead of its
+// chapters due at the same time.
+func sortEvents(events []model.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if !a.At.Equal(b.At) {
+			return a.At.Before(b.At)
+		}
+		if a.NovelID != b.NovelID {
+			return a.NovelID < b.NovelID
+		}
+		return a.ChapterID < b.ChapterID
+	})
+}
+
+func novelEvent(n model.Novel, at time.Time) model.Event {
+	return model.Event{Type: model.EventNovelPublished, NovelID: n.ID, Title: n.Title, At: at}
+}
+
+func chapterEvent(ch model.Chapter, at time.Time) model.Event {
+	return model.Event{Type: model.EventChapterPublished, NovelID: ch.NovelID, ChapterID: ch.ID, Title: ch.Title, At: at}
+}
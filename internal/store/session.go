@@ -0,0 +1,143 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"novella/internal/model"
+)
+
+// Client describes the device a session was opened from, so users can tell
+// their sessions apart when revoking one.
+type Client struct {
+	Device    string
+	UserAgent string
+}
+
+// touchInterval bounds how often a session's last-seen time, and with it the
+// sliding expiry, is written back; most requests only read the session.
+const touchInterval = time.Minute
+
+const maxClientField = 256
+
+// Tokens are the credentials handed to a client when a session opens or is
+// refreshed. Only their digests are stored.
+type Tokens struct {
+	Access          string
+	AccessExpiresAt time.Time
+	Refresh         string
+}
+
+var ErrRefreshReused = fmt.Errorf("refresh token reused: %w", ErrUnauthorized)
+
+func newSession(userID int64, client Client, ttl, accessTTL time.Duration) (model.Session, model.RefreshToken, Tokens, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return model.Session{}, model.RefreshToken{}, Tokens{}, err
+	}
+	now := time.Now().UTC()
+	sess := model.Session{
+		ID:        id,
+		UserID:    userID,
+		Device:    clip(client.Device, maxClientField),
+		UserAgent: clip(client.UserAgent, maxClientField),
+		CreatedAt: now,
+	}
+	rt, tokens, err := issueTokens(&sess, now, ttl, accessTTL)
+	return sess, rt, tokens, err
+}
+
+// issueTokens gives sess a fresh access token and returns the refresh token
+// that will replace it, extending the session as a use would.
+func issueTokens(sess *model.Session, now time.Time, ttl, accessTTL time.Duration) (model.RefreshToken, Tokens, error) {
+	access, err := randomHex(32)
+	if err != nil {
+		return model.RefreshToken{}, Tokens{}, err
+	}
+	refresh, err := randomHex(32)
+	if err != nil {
+		return model.RefreshToken{}, Tokens{}, err
+	}
+	sess.TokenHash = hashToken(access)
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(ttl)
+	sess.AccessExpiresAt = now.Add(min(accessTTL, ttl))
+	rt := model.RefreshToken{TokenHash: hashToken(refresh), SessionID: sess.ID, CreatedAt: now}
+	return rt, Tokens{Access: access, AccessExpiresAt: sess.AccessExpiresAt, Refresh: refresh}, nil
+}
+
+func sessionActive(sess model.Session, now time.Time) bool {
+	return now.Before(sess.AccessExpiresAt) && now.Before(sess.ExpiresAt)
+}
+
+func needsTouch(sess model.Session, now time.Time) bool {
+	return now.Sub(sess.LastSeenAt) >= touchInterval
+}
+
+func clip(v string, n int) string {
+	r := []rune(v)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return v
+}
+
+// legacySessionID derives a stable ID for sessions created before sessions
+// had one, so migrating the same journal twice yields the same IDs.
+func legacySessionID(tokenHash string) string {
+	return hashToken("session id:" + tokenHash)[:16]
+}
+
+const (
+	passwordResetTTL = time.Hour
+	verifyEmailTTL   = 48 * time.Hour
+)
+
+func newUserToken(user model.User, purpose model.TokenPurpose, ttl time.Duration) (model.UserToken, string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return model.UserToken{}, "", err
+	}
+	now := time.Now().UTC()
+	return model.UserToken{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     normalize(user.Email),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, token, nil
+}
+
+// userTokenValid reports whether t may still be redeemed by user for purpose.
+func userTokenValid(t model.UserToken, user model.User, purpose model.TokenPurpose, now time.Time) bool {
+	return t.Purpose == purpose && now.Before(t.ExpiresAt) && t.Email == normalize(user.Email)
+}
+
+// RecentSignIn is how long after signing in a user without a password may
+// confirm sensitive changes with the session alone.
+const RecentSignIn = 10 * time.Minute
+
+var ErrReauthRequired = fmt.Errorf("sign in again to confirm: %w", ErrUnauthorized)
+
+// Reauth confirms a sensitive change to an account: the password, or, for an
+// account without one, the ID of a session opened within RecentSignIn, as
+// after signing in again with an identity provider.
+type Reauth struct {
+	Password string
+	Session  string
+}
+
+// check verifies re for user; sess is the session re names, if it exists.
+func (re Reauth) check(user model.User, sess *model.Session, now time.Time) error {
+	if user.PasswordHash != "" {
+		if valid, _ := verifyPassword(user.PasswordSalt, user.PasswordHash, re.Password); !valid {
+			return ErrUnauthorized
+		}
+		return nil
+	}
+	if sess == nil || sess.UserID != user.ID || now.Sub(sess.CreatedAt) > RecentSignIn {
+		return ErrReauthRequired
+	}
+	return nil
+}
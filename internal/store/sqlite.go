@@ -0,0 +1,2950 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"novella/internal/model"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLStore is a Backend on an embedded SQLite database. Writes run in
+// IMMEDIATE transactions so concurrent requests queue on SQLite's write lock
+// instead of failing on lock upgrade, and reads proceed in parallel under WAL.
+type SQLStore struct {
+	db         *sql.DB
+	sessionTTL time.Duration
+	accessTTL  time.Duration
+}
+
+var _ Backend = (*SQLStore)(nil)
+
+func OpenSQLite(path string, opts ...Option) (*SQLStore, error) {
+	o, err := buildOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if o.key != nil {
+		return nil, ErrEncryptionUnsupported
+	}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("sqlite path is required")
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Set("_time_format", "sqlite")
+	q.Set("_txlock", "immediate")
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLStore{db: db, sessionTTL: o.sessionTTL, accessTTL: o.accessTTL}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+type sqlMigration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		name:    "initial schema",
+		up: execAll(
+			`CREATE TABLE users (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				username      TEXT NOT NULL,
+				username_norm TEXT NOT NULL UNIQUE,
+				email         TEXT NOT NULL,
+				email_norm    TEXT NOT NULL,
+				password_salt TEXT NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX users_email ON users (email_norm)`,
+			`CREATE TABLE sessions (
+				token   TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX sessions_user_id ON sessions (user_id)`,
+			`CREATE TABLE novels (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				author_id   INTEGER NOT NULL REFERENCES users (id),
+				title       TEXT NOT NULL,
+				description TEXT NOT NULL,
+				genre       TEXT NOT NULL,
+				status      TEXT NOT NULL,
+				created_at  TIMESTAMP NOT NULL,
+				updated_at  TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX novels_author_id ON novels (author_id)`,
+			`CREATE INDEX novels_updated_at ON novels (updated_at)`,
+			`CREATE TABLE chapters (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				title      TEXT NOT NULL,
+				content    TEXT NOT NULL,
+				position   INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX chapters_novel_id ON chapters (novel_id, position)`,
+			`CREATE TABLE comments (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id INTEGER,
+				user_id    INTEGER NOT NULL REFERENCES users (id),
+				body       TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX comments_novel_id ON comments (novel_id, created_at)`,
+			`CREATE TABLE bookmarks (
+				user_id     INTEGER NOT NULL REFERENCES users (id),
+				novel_id    INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id  INTEGER,
+				chapter_pos INTEGER,
+				updated_at  TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, novel_id)
+			)`,
+			`CREATE INDEX bookmarks_novel_id ON bookmarks (novel_id)`,
+		),
+	},
+	{
+		version: 2,
+		name:    "hash session tokens",
+		up:      sqlHashSessionTokens,
+	},
+	{
+		version: 3,
+		name:    "session records",
+		up:      sqlSessionRecords,
+	},
+	{
+		version: 4,
+		name:    "refresh tokens",
+		up: execAll(
+			`ALTER TABLE sessions ADD COLUMN access_expires_at TIMESTAMP NOT NULL DEFAULT ''`,
+			`UPDATE sessions SET access_expires_at = expires_at`,
+			`CREATE TABLE refresh_tokens (
+				token_hash TEXT PRIMARY KEY,
+				session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL,
+				used_at    TIMESTAMP
+			)`,
+			`CREATE INDEX refresh_tokens_session_id ON refresh_tokens (session_id)`,
+		),
+	},
+	{
+		version: 5,
+		name:    "account tokens and mail outbox",
+		up: execAll(
+			`ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP`,
+			`CREATE TABLE user_tokens (
+				token_hash TEXT PRIMARY KEY,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				purpose    TEXT NOT NULL,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX user_tokens_user_id ON user_tokens (user_id, purpose)`,
+			`CREATE TABLE outbox (
+				id              INTEGER PRIMARY KEY AUTOINCREMENT,
+				recipient       TEXT NOT NULL,
+				subject         TEXT NOT NULL,
+				body            TEXT NOT NULL,
+				status          TEXT NOT NULL,
+				attempts        INTEGER NOT NULL,
+				last_error      TEXT NOT NULL,
+				next_attempt_at TIMESTAMP NOT NULL,
+				created_at      TIMESTAMP NOT NULL,
+				sent_at         TIMESTAMP
+			)`,
+			`CREATE INDEX outbox_due ON outbox (status, next_attempt_at)`,
+		),
+	},
+	{
+		version: 6,
+		name:    "two-factor authentication",
+		up: execAll(
+			`ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE users ADD COLUMN totp_pending TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE users ADD COLUMN recovery_codes TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE user_tokens ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0`,
+		),
+	},
+	{
+		version: 7,
+		name:    "external identities",
+		up: execAll(
+			`CREATE TABLE identities (
+				provider   TEXT NOT NULL,
+				subject    TEXT NOT NULL,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (provider, subject)
+			)`,
+			`CREATE INDEX identities_user_id ON identities (user_id)`,
+		),
+	},
+	{
+		version: 8,
+		name:    "user roles",
+		up: execAll(
+			`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'author'`,
+		),
+	},
+	{
+		version: 9,
+		name:    "api keys",
+		up: execAll(
+			`CREATE TABLE api_keys (
+				id           TEXT PRIMARY KEY,
+				user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				name         TEXT NOT NULL,
+				prefix       TEXT NOT NULL,
+				token_hash   TEXT NOT NULL UNIQUE,
+				scopes       TEXT NOT NULL,
+				created_at   TIMESTAMP NOT NULL,
+				expires_at   TIMESTAMP,
+				last_used_at TIMESTAMP
+			)`,
+			`CREATE INDEX api_keys_user_id ON api_keys (user_id)`,
+		),
+	},
+	{
+		version: 10,
+		name:    "login lockout",
+		up: execAll(
+			`ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE users ADD COLUMN last_failed_login TIMESTAMP`,
+			`ALTER TABLE users ADD COLUMN locked_until TIMESTAMP`,
+		),
+	},
+	{
+		version: 11,
+		name:    "user profiles",
+		up: execAll(
+			`ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE users ADD COLUMN avatar_url TEXT NOT NULL DEFAULT ''`,
+		),
+	},
+	{
+		version: 12,
+		name:    "anonymous comments",
+		up:      sqlAnonymousComments,
+	},
+	{
+		// Chapters keep no history from before this version; their current
+		// content stands in as revision 1 until they next change.
+		version: 13,
+		name:    "chapter revisions",
+		up: execAll(
+			`CREATE TABLE chapter_revisions (
+				chapter_id    INTEGER NOT NULL REFERENCES chapters (id) ON DELETE CASCADE,
+				number        INTEGER NOT NULL,
+				author_id     INTEGER REFERENCES users (id) ON DELETE SET NULL,
+				content       TEXT NOT NULL,
+				words         INTEGER NOT NULL,
+				restored_from INTEGER,
+				created_at    TIMESTAMP NOT NULL,
+				PRIMARY KEY (chapter_id, number)
+			)`,
+			`CREATE INDEX chapter_revisions_author_id ON chapter_revisions (author_id)`,
+		),
+	},
+	{
+		version: 14,
+		name:    "scheduled publishing",
+		up: execAll(
+			`ALTER TABLE novels ADD COLUMN publish_at TIMESTAMP`,
+			`ALTER TABLE chapters ADD COLUMN publish_at TIMESTAMP`,
+			`CREATE INDEX novels_publish_at ON novels (publish_at) WHERE publish_at IS NOT NULL`,
+			`CREATE INDEX chapters_publish_at ON chapters (publish_at) WHERE publish_at IS NOT NULL`,
+		),
+	},
+	{
+		version: 15,
+		name:    "chapter status",
+		up: execAll(
+			`ALTER TABLE chapters ADD COLUMN status TEXT NOT NULL DEFAULT 'published'`,
+			`UPDATE chapters SET status = 'draft' WHERE publish_at IS NOT NULL`,
+		),
+	},
+	{
+		version: 16,
+		name:    "chapter formats",
+		up:      execAll(`ALTER TABLE chapters ADD COLUMN format TEXT NOT NULL DEFAULT 'plain'`),
+	},
+}
+
+func sqlHashSessionTokens(tx *sql.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE sessions RENAME COLUMN token TO token_hash`); err != nil {
+		return err
+	}
+	var tokens []string
+	err := queryAll(tx, `SELECT token_hash FROM sessions`, func(row scanner) error {
+		var token string
+		err := row.Scan(&token)
+		tokens = append(tokens, token)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if _, err := tx.Exec(`UPDATE sessions SET token_hash = ? WHERE token_hash = ?`, hashToken(token), token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlSessionRecords gives sessions an ID, client details and timestamps. As
+// in the JSON store, existing sessions count as created now.
+func sqlSessionRecords(tx *sql.Tx) error {
+	var legacy []sessionRecord
+	err := queryAll(tx, `SELECT token_hash, user_id FROM sessions`, func(row scanner) error {
+		var tokenHash string
+		var uid int64
+		if err := row.Scan(&tokenHash, &uid); err != nil {
+			return err
+		}
+		legacy = append(legacy, legacySessionRecord(tokenHash, uid))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = execAll(
+		`DROP TABLE sessions`,
+		`CREATE TABLE sessions (
+			id           TEXT PRIMARY KEY,
+			user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			token_hash   TEXT NOT NULL UNIQUE,
+			device       TEXT NOT NULL,
+			user_agent   TEXT NOT NULL,
+			created_at   TIMESTAMP NOT NULL,
+			last_seen_at TIMESTAMP NOT NULL,
+			expires_at   TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX sessions_user_id ON sessions (user_id)`,
+		`CREATE INDEX sessions_expires_at ON sessions (expires_at)`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+	for _, r := range legacy {
+		if _, err := tx.Exec(`INSERT INTO sessions (id, user_id, token_hash, device, user_agent, created_at, last_seen_at, expires_at)
+			VALUES (?, ?, ?, '', '', ?, ?, ?)`, r.ID, r.UserID, r.TokenHash, r.CreatedAt, r.LastSeenAt, r.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlAnonymousComments lets comments outlive their author: user_id becomes
+// NULL when the account is deleted. SQLite cannot relax a column in place, so
+// the table is rebuilt, keeping its ID sequence.
+func sqlAnonymousComments(tx *sql.Tx) error {
+	var seq int64
+	err := tx.QueryRow(`SELECT seq FROM sqlite_sequence WHERE name = 'comments'`).Scan(&seq)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	err = execAll(
+		`CREATE TABLE comments_new (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+			chapter_id INTEGER,
+			user_id    INTEGER REFERENCES users (id) ON DELETE SET NULL,
+			body       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)`,
+		`INSERT INTO comments_new (id, novel_id, chapter_id, user_id, body, created_at)
+			SELECT id, novel_id, chapter_id, user_id, body, created_at FROM comments`,
+		`DROP TABLE comments`,
+		`ALTER TABLE comments_new RENAME TO comments`,
+		`CREATE INDEX comments_novel_id ON comments (novel_id, created_at)`,
+		`CREATE INDEX comments_user_id ON comments (user_id)`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+	return bumpSequence(tx, "comments", seq)
+}
+
+func execAll(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// migrate brings the schema up to date, tracking the applied version in
+// PRAGMA user_version.
+func (s *SQLStore) migrate() error {
+	var current int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&current); err != nil {
+		return err
+	}
+	latest := sqlMigrations[len(sqlMigrations)-1].version
+	if current > latest {
+		return fmt.Errorf("schema version %d is not supported by this build (max %d)", current, latest)
+	}
+	applied := false
+	for _, m := range sqlMigrations {
+		if m.version <= current {
+			continue
+		}
+		err := s.tx(func(tx *sql.Tx) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.version))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		applied = true
+	}
+	if !applied || current == 0 {
+		return nil
+	}
+	// Rebuild the file and empty the WAL so that values a migration rewrote,
+	// such as raw session tokens, do not linger in free pages or old frames.
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+func (s *SQLStore) tx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+const userColumns = `id, username, email, role, display_name, bio, avatar_url, password_salt, password_hash, created_at, email_verified_at,
+	totp_secret, totp_pending, totp_last_step, recovery_codes, failed_logins, last_failed_login, locked_until`
+
+func scanUser(row scanner) (model.User, error) {
+	var u model.User
+	var recovery string
+	err := row.Scan(&u.ID, &u.Username, &u.Email, &u.Role, &u.DisplayName, &u.Bio, &u.AvatarURL, &u.PasswordSalt, &u.PasswordHash, &u.CreatedAt, &u.EmailVerifiedAt,
+		&u.TOTPSecret, &u.TOTPPending, &u.TOTPLastStep, &recovery, &u.FailedLogins, &u.LastFailedLogin, &u.LockedUntil)
+	setTwoFactor(&u, recovery)
+	return u, err
+}
+
+// Recovery code digests are kept space separated in one column, and two-factor
+// authentication is on exactly when a secret is set.
+func setTwoFactor(u *model.User, recovery string) {
+	u.TwoFactorEnabled = u.TOTPSecret != ""
+	u.RecoveryCodes = strings.Fields(recovery)
+}
+
+// prefixed qualifies each column in cols with the table alias t, for joins.
+func prefixed(t, cols string) string {
+	fields := strings.Split(cols, ",")
+	for i, f := range fields {
+		fields[i] = t + "." + strings.TrimSpace(f)
+	}
+	return strings.Join(fields, ", ")
+}
+
+func updateTwoFactor(tx *sql.Tx, u model.User) error {
+	_, err := tx.Exec(`UPDATE users SET totp_secret = ?, totp_pending = ?, totp_last_step = ?, recovery_codes = ? WHERE id = ?`,
+		u.TOTPSecret, u.TOTPPending, u.TOTPLastStep, strings.Join(u.RecoveryCodes, " "), u.ID)
+	return err
+}
+
+func updateLoginFailures(tx *sql.Tx, u model.User) error {
+	_, err := tx.Exec(`UPDATE users SET failed_logins = ?, last_failed_login = ?, locked_until = ? WHERE id = ?`,
+		u.FailedLogins, u.LastFailedLogin, u.LockedUntil, u.ID)
+	return err
+}
+
+func userByID(q queryer, id int64) (model.User, error) {
+	u, err := scanUser(q.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	return u, notFound(err)
+}
+
+const sessionColumns = `id, user_id, token_hash, device, user_agent, created_at, last_seen_at, access_expires_at, expires_at`
+
+func scanSession(row scanner) (model.Session, error) {
+	var sess model.Session
+	err := row.Scan(&sess.ID, &sess.UserID, &sess.TokenHash, &sess.Device, &sess.UserAgent, &sess.CreatedAt, &sess.LastSeenAt,
+		&sess.AccessExpiresAt, &sess.ExpiresAt)
+	return sess, err
+}
+
+func insertSession(tx *sql.Tx, sess model.Session) error {
+	_, err := tx.Exec(`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sess.ID, sess.UserID, sess.TokenHash, sess.Device, sess.UserAgent, sess.CreatedAt, sess.LastSeenAt,
+		sess.AccessExpiresAt, sess.ExpiresAt)
+	return err
+}
+
+const refreshColumns = `token_hash, session_id, created_at, used_at`
+
+func scanRefresh(row scanner) (model.RefreshToken, error) {
+	var rt model.RefreshToken
+	err := row.Scan(&rt.TokenHash, &rt.SessionID, &rt.CreatedAt, &rt.UsedAt)
+	return rt, err
+}
+
+func insertRefresh(tx *sql.Tx, rt model.RefreshToken) error {
+	_, err := tx.Exec(`INSERT INTO refresh_tokens (`+refreshColumns+`) VALUES (?, ?, ?, ?)`,
+		rt.TokenHash, rt.SessionID, rt.CreatedAt, rt.UsedAt)
+	return err
+}
+
+const userTokenColumns = `token_hash, user_id, purpose, email, attempts, created_at, expires_at`
+
+func scanUserToken(row scanner) (model.UserToken, error) {
+	var t model.UserToken
+	err := row.Scan(&t.TokenHash, &t.UserID, &t.Purpose, &t.Email, &t.Attempts, &t.CreatedAt, &t.ExpiresAt)
+	return t, err
+}
+
+func insertUserToken(tx *sql.Tx, t model.UserToken) error {
+	_, err := tx.Exec(`INSERT INTO user_tokens (`+userTokenColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.TokenHash, t.UserID, t.Purpose, t.Email, t.Attempts, t.CreatedAt, t.ExpiresAt)
+	return err
+}
+
+// replaceUserToken drops the user's earlier tokens for the same purpose.
+func replaceUserToken(tx *sql.Tx, t model.UserToken) error {
+	if _, err := tx.Exec(`DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?`, t.UserID, t.Purpose); err != nil {
+		return err
+	}
+	return insertUserToken(tx, t)
+}
+
+const identityColumns = `provider, subject, user_id, email, created_at`
+
+func scanIdentity(row scanner) (model.Identity, error) {
+	var id model.Identity
+	err := row.Scan(&id.Provider, &id.Subject, &id.UserID, &id.Email, &id.CreatedAt)
+	return id, err
+}
+
+func insertIdentity(tx *sql.Tx, id model.Identity) error {
+	_, err := tx.Exec(`INSERT INTO identities (`+identityColumns+`) VALUES (?, ?, ?, ?, ?)`,
+		id.Provider, id.Subject, id.UserID, id.Email, id.CreatedAt)
+	return err
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, token_hash, scopes, created_at, expires_at, last_used_at`
+
+func scanAPIKey(row scanner) (model.APIKey, error) {
+	var k model.APIKey
+	var scopes string
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.TokenHash, &scopes, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt)
+	for _, sc := range strings.Fields(scopes) {
+		k.Scopes = append(k.Scopes, model.Scope(sc))
+	}
+	return k, err
+}
+
+func insertAPIKey(tx *sql.Tx, k model.APIKey) error {
+	scopes := make([]string, len(k.Scopes))
+	for i, sc := range k.Scopes {
+		scopes[i] = string(sc)
+	}
+	_, err := tx.Exec(`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.ID, k.UserID, k.Name, k.Prefix, k.TokenHash, strings.Join(scopes, " "), k.CreatedAt, k.ExpiresAt, k.LastUsedAt)
+	return err
+}
+
+const mailColumns = `id, recipient, subject, body, status, attempts, last_error, next_attempt_at, created_at, sent_at`
+
+func scanMail(row scanner) (model.OutboxMessage, error) {
+	var m model.OutboxMessage
+	err := row.Scan(&m.ID, &m.To, &m.Subject, &m.Body, &m.Status, &m.Attempts, &m.LastError, &m.NextAttemptAt, &m.CreatedAt, &m.SentAt)
+	return m, err
+}
+
+const novelColumns = `id, author_id, title, description, genre, status, publish_at, created_at, updated_at`
+
+func scanNovel(row scanner) (model.Novel, error) {
+	var n model.Novel
+	err := row.Scan(&n.ID, &n.AuthorID, &n.Title, &n.Description, &n.Genre, &n.Status, &n.PublishAt, &n.CreatedAt, &n.UpdatedAt)
+	return n, err
+}
+
+const chapterColumns = `id, novel_id, title, content, format, position, status, publish_at, created_at, updated_at`
+
+func scanChapter(row scanner) (model.Chapter, error) {
+	var ch model.Chapter
+	err := row.Scan(&ch.ID, &ch.NovelID, &ch.Title, &ch.Content, &ch.Format, &ch.Position, &ch.Status, &ch.PublishAt, &ch.CreatedAt, &ch.UpdatedAt)
+	return ch, err
+}
+
+const revisionColumns = `chapter_id, number, author_id, content, words, restored_from, created_at`
+
+func scanRevision(row scanner) (model.Revision, error) {
+	var r model.Revision
+	err := row.Scan(&r.ChapterID, &r.Number, &r.AuthorID, &r.Content, &r.Words, &r.RestoredFrom, &r.CreatedAt)
+	return r, err
+}
+
+func insertRevision(tx *sql.Tx, r model.Revision) error {
+	_, err := tx.Exec(`INSERT INTO chapter_revisions (`+revisionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.ChapterID, r.Number, r.AuthorID, r.Content, r.Words, r.RestoredFrom, r.CreatedAt)
+	return err
+}
+
+const commentColumns = `id, novel_id, chapter_id, user_id, body, created_at`
+
+// The comments of deleted accounts have a NULL user_id, which is 0 in the
+// model.
+func scanComment(row scanner) (model.Comment, error) {
+	var c model.Comment
+	var userID sql.NullInt64
+	err := row.Scan(&c.ID, &c.NovelID, &c.ChapterID, &userID, &c.Body, &c.CreatedAt)
+	c.UserID = userID.Int64
+	return c, err
+}
+
+const bookmarkColumns = `user_id, novel_id, chapter_id, updated_at, chapter_pos`
+
+func scanBookmark(row scanner) (model.Bookmark, error) {
+	var b model.Bookmark
+	err := row.Scan(&b.UserID, &b.NovelID, &b.ChapterID, &b.UpdatedAt, &b.ChapterPos)
+	return b, err
+}
+
+func novelByID(q queryer, id int64) (model.Novel, error) {
+	n, err := scanNovel(q.QueryRow(`SELECT `+novelColumns+` FROM novels WHERE id = ?`, id))
+	return n, notFound(err)
+}
+
+// actorByID resolves a requester for the policy; unknown IDs, including 0
+// for anonymous requests, get the zero actor.
+func actorByID(q queryer, id int64) (actor, error) {
+	if id == 0 {
+		return actor{}, nil
+	}
+	var role model.Role
+	err := q.QueryRow(`SELECT role FROM users WHERE id = ?`, id).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return actor{}, nil
+	}
+	if err != nil {
+		return actor{}, err
+	}
+	return actor{id: id, role: role}, nil
+}
+
+// novelFor loads a novel and checks allowed against the requester.
+func novelFor(q queryer, id, requesterID int64, allowed func(actor, model.Novel) bool) (model.Novel, error) {
+	n, err := novelByID(q, id)
+	if err != nil {
+		return model.Novel{}, err
+	}
+	a, err := actorByID(q, requesterID)
+	if err != nil {
+		return model.Novel{}, err
+	}
+	if !allowed(a, n) {
+		return model.Novel{}, ErrUnauthorized
+	}
+	return n, nil
+}
+
+func visibleNovel(q queryer, id, requesterID int64) (model.Novel, error) {
+	return novelFor(q, id, requesterID, actor.canReadNovel)
+}
+
+func editableNovel(q queryer, id, requesterID int64) (model.Novel, error) {
+	return novelFor(q, id, requesterID, actor.canEditNovel)
+}
+
+func chapterInNovel(q queryer, novelID, chapterID int64) (model.Chapter, error) {
+	ch, err := scanChapter(q.QueryRow(`SELECT `+chapterColumns+` FROM chapters WHERE id = ? AND novel_id = ?`, chapterID, novelID))
+	return ch, notFound(err)
+}
+
+// readableNovel is visibleNovel that also returns the requester, for
+// checking the chapters.
+func readableNovel(q queryer, id, requesterID int64) (model.Novel, actor, error) {
+	n, err := visibleNovel(q, id, requesterID)
+	if err != nil {
+		return model.Novel{}, actor{}, err
+	}
+	a, err := actorByID(q, requesterID)
+	return n, a, err
+}
+
+// visibleChapter finds a chapter requesterID may read; a draft is not found
+// by readers.
+func visibleChapter(q queryer, novelID, chapterID, requesterID int64) (model.Chapter, error) {
+	n, a, err := readableNovel(q, novelID, requesterID)
+	if err != nil {
+		return model.Chapter{}, err
+	}
+	ch, err := chapterInNovel(q, novelID, chapterID)
+	if err != nil {
+		return model.Chapter{}, err
+	}
+	if !a.canReadChapter(n, ch) {
+		return model.Chapter{}, ErrNotFound
+	}
+	return ch, nil
+}
+
+// chapterAsSeen numbers ch the way a sees it, as actor.chapterAsSeen does.
+func chapterAsSeen(q queryer, a actor, n model.Novel, ch model.Chapter) (model.Chapter, error) {
+	if a.canReadUnreleased(n) {
+		return ch, nil
+	}
+	err := q.QueryRow(`SELECT COUNT(*) + 1 FROM chapters
+		WHERE novel_id = ? AND status = ? AND (position < ? OR position = ? AND id < ?)`,
+		ch.NovelID, model.ChapterPublished, ch.Position, ch.Position, ch.ID).Scan(&ch.Position)
+	return ch, err
+}
+
+// bookmarkAsSeen gives b the position of its chapter as its owner, a, sees
+// it.
+func bookmarkAsSeen(q queryer, a actor, b model.Bookmark) (model.Bookmark, error) {
+	if b.ChapterID == nil {
+		return b, nil
+	}
+	ch, err := chapterInNovel(q, b.NovelID, *b.ChapterID)
+	if err != nil {
+		return model.Bookmark{}, err
+	}
+	var n model.Novel
+	if n, err = scanNovel(q.QueryRow(`SELECT `+novelColumns+` FROM novels WHERE id = ?`, b.NovelID)); err != nil {
+		return model.Bookmark{}, err
+	}
+	if ch, err = chapterAsSeen(q, a, n, ch); err != nil {
+		return model.Bookmark{}, err
+	}
+	b.ChapterPos = &ch.Position
+	return b, nil
+}
+
+func (s *SQLStore) Register(username, email, password string, client Client) (model.User, Tokens, error) {
+	u := normalize(username)
+	e := normalize(email)
+	if u == "" || e == "" || password == "" {
+		return model.User{}, Tokens{}, fmt.Errorf("username, email, and password are required")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	user := model.User{
+		Username:     strings.TrimSpace(username),
+		Email:        strings.TrimSpace(email),
+		Role:         defaultRole,
+		PasswordHash: hash,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	var tokens Tokens
+	err = s.tx(func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE username_norm = ? OR email_norm = ?)`, u, e).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrConflict
+		}
+		res, err := tx.Exec(`INSERT INTO users (username, username_norm, email, email_norm, role, password_salt, password_hash, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, user.Username, u, user.Email, e, user.Role, user.PasswordSalt, user.PasswordHash, user.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if user.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		sess, rt, issued, err := newSession(user.ID, client, s.sessionTTL, s.accessTTL)
+		if err != nil {
+			return err
+		}
+		if err := insertSession(tx, sess); err != nil {
+			return err
+		}
+		tokens = issued
+		return insertRefresh(tx, rt)
+	})
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	return user, tokens, nil
+}
+
+func (s *SQLStore) Login(email, password string, client Client) (model.User, Tokens, error) {
+	user, err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email_norm = ?`, normalize(email)))
+	if errors.Is(err, sql.ErrNoRows) {
+		verifyPassword("", dummyHash, password)
+		return model.User{}, Tokens{}, ErrUnauthorized
+	}
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	now := time.Now().UTC()
+	if err := loginLocked(user, now); err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	valid, rehash := verifyPassword(user.PasswordSalt, user.PasswordHash, password)
+	if !valid {
+		return model.User{}, Tokens{}, s.loginFailed(user, now)
+	}
+	var hash string
+	if rehash {
+		if hash, err = hashPassword(password); err != nil {
+			return model.User{}, Tokens{}, err
+		}
+	}
+	sess, rt, tokens, err := newSession(user.ID, client, s.sessionTTL, s.accessTTL)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+
+	var current model.User
+	var challenge *Challenge
+	err = s.tx(func(tx *sql.Tx) error {
+		var err error
+		if current, err = userByID(tx, user.ID); err != nil {
+			return err
+		}
+		if current.PasswordHash != user.PasswordHash {
+			return ErrUnauthorized
+		}
+		if err := loginLocked(current, now); err != nil {
+			return err
+		}
+		if rehash {
+			if _, err := tx.Exec(`UPDATE users SET password_salt = '', password_hash = ? WHERE id = ?`, hash, current.ID); err != nil {
+				return err
+			}
+			current.PasswordSalt, current.PasswordHash = "", hash
+		}
+		// Failures are only cleared once the second factor is in too.
+		if current.TwoFactorEnabled {
+			t, token, err := newUserToken(current, model.TokenLoginChallenge, challengeTTL)
+			if err != nil {
+				return err
+			}
+			challenge = &Challenge{Token: token, ExpiresAt: t.ExpiresAt}
+			return replaceUserToken(tx, t)
+		}
+		if clearLoginFailures(&current) {
+			if err := updateLoginFailures(tx, current); err != nil {
+				return err
+			}
+		}
+		if err := insertSession(tx, sess); err != nil {
+			return err
+		}
+		return insertRefresh(tx, rt)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return model.User{}, Tokens{}, ErrUnauthorized
+	}
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	if challenge != nil {
+		return model.User{}, Tokens{}, challenge
+	}
+	return current, tokens, nil
+}
+
+func (s *SQLStore) loginFailed(user model.User, now time.Time) error {
+	var current model.User
+	err := s.tx(func(tx *sql.Tx) error {
+		var err error
+		if current, err = userByID(tx, user.ID); err != nil {
+			return err
+		}
+		if current.PasswordHash != user.PasswordHash {
+			return ErrUnauthorized
+		}
+		if err := loginLocked(current, now); err != nil {
+			return err
+		}
+		countLoginFailure(&current, now)
+		return updateLoginFailures(tx, current)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrUnauthorized
+	}
+	if err != nil {
+		return err
+	}
+	return failedLogin(current, now)
+}
+
+func (s *SQLStore) CompleteLogin(challenge, code string, client Client) (model.User, Tokens, error) {
+	sess, rt, tokens, err := newSession(0, client, s.sessionTTL, s.accessTTL)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	var user model.User
+	failed := false
+	now := time.Now().UTC()
+	err = s.tx(func(tx *sql.Tx) error {
+		u, t, err := redeemUserToken(tx, challenge, model.TokenLoginChallenge, now)
+		if err != nil {
+			return err
+		}
+		if err := loginLocked(u, now); err != nil {
+			return err
+		}
+		if !checkSecondFactor(&u, code, now) {
+			failed = true
+			if t.Attempts+1 >= maxChallengeAttempts {
+				_, err = tx.Exec(`DELETE FROM user_tokens WHERE token_hash = ?`, t.TokenHash)
+			} else {
+				_, err = tx.Exec(`UPDATE user_tokens SET attempts = attempts + 1 WHERE token_hash = ?`, t.TokenHash)
+			}
+			if err != nil {
+				return err
+			}
+			countLoginFailure(&u, now)
+			user = u
+			return updateLoginFailures(tx, u)
+		}
+		if _, err := tx.Exec(`DELETE FROM user_tokens WHERE token_hash = ?`, t.TokenHash); err != nil {
+			return err
+		}
+		if err := updateTwoFactor(tx, u); err != nil {
+			return err
+		}
+		if clearLoginFailures(&u) {
+			if err := updateLoginFailures(tx, u); err != nil {
+				return err
+			}
+		}
+		user = u
+		sess.UserID = u.ID
+		if err := insertSession(tx, sess); err != nil {
+			return err
+		}
+		return insertRefresh(tx, rt)
+	})
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	if failed {
+		return model.User{}, Tokens{}, failedLogin(user, now)
+	}
+	return user, tokens, nil
+}
+
+func (s *SQLStore) LoginWithIdentity(acct ExternalAccount, client Client) (model.User, Tokens, error) {
+	sess, rt, tokens, err := newSession(0, client, s.sessionTTL, s.accessTTL)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	var user model.User
+	var challenge *Challenge
+	err = s.tx(func(tx *sql.Tx) error {
+		var err error
+		user, err = scanUser(tx.QueryRow(`SELECT `+prefixed("u", userColumns)+` FROM identities i JOIN users u ON u.id = i.user_id
+			WHERE i.provider = ? AND i.subject = ?`, acct.Provider, acct.Subject))
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if user, err = registerExternal(tx, acct); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+
+		if user.TwoFactorEnabled {
+			t, token, err := newUserToken(user, model.TokenLoginChallenge, challengeTTL)
+			if err != nil {
+				return err
+			}
+			challenge = &Challenge{Token: token, ExpiresAt: t.ExpiresAt}
+			return replaceUserToken(tx, t)
+		}
+		sess.UserID = user.ID
+		if err := insertSession(tx, sess); err != nil {
+			return err
+		}
+		return insertRefresh(tx, rt)
+	})
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	if challenge != nil {
+		return model.User{}, Tokens{}, challenge
+	}
+	return user, tokens, nil
+}
+
+func registerExternal(tx *sql.Tx, acct ExternalAccount) (model.User, error) {
+	if err := checkExternalEmail(acct); err != nil {
+		return model.User{}, err
+	}
+	e := normalize(acct.Email)
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE email_norm = ?)`, e).Scan(&exists); err != nil {
+		return model.User{}, err
+	}
+	if exists {
+		return model.User{}, ErrConflict
+	}
+	name, err := pickUsername(acct.Email, func(norm string) (bool, error) {
+		var taken bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE username_norm = ?)`, norm).Scan(&taken)
+		return taken, err
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	user := newExternalUser(acct, name)
+	res, err := tx.Exec(`INSERT INTO users (username, username_norm, email, email_norm, role, password_salt, password_hash, created_at, email_verified_at)
+		VALUES (?, ?, ?, ?, ?, '', '', ?, ?)`, user.Username, normalize(user.Username), user.Email, e, user.Role, user.CreatedAt, user.EmailVerifiedAt)
+	if err != nil {
+		return model.User{}, err
+	}
+	if user.ID, err = res.LastInsertId(); err != nil {
+		return model.User{}, err
+	}
+	return user, insertIdentity(tx, newIdentity(user.ID, acct))
+}
+
+func (s *SQLStore) LinkIdentity(userID int64, acct ExternalAccount) (model.Identity, error) {
+	var id model.Identity
+	err := s.tx(func(tx *sql.Tx) error {
+		if _, err := userByID(tx, userID); err != nil {
+			return err
+		}
+		existing, err := scanIdentity(tx.QueryRow(`SELECT `+identityColumns+` FROM identities WHERE provider = ? AND subject = ?`,
+			acct.Provider, acct.Subject))
+		switch {
+		case err == nil && existing.UserID != userID:
+			return ErrConflict
+		case err == nil:
+			id = existing
+			return nil
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		var linked bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM identities WHERE user_id = ? AND provider = ?)`,
+			userID, acct.Provider).Scan(&linked); err != nil {
+			return err
+		}
+		if linked {
+			return ErrConflict
+		}
+		id = newIdentity(userID, acct)
+		return insertIdentity(tx, id)
+	})
+	if err != nil {
+		return model.Identity{}, err
+	}
+	return id, nil
+}
+
+func (s *SQLStore) ListIdentities(userID int64) ([]model.Identity, error) {
+	res := make([]model.Identity, 0)
+	err := queryAll(s.db, `SELECT `+identityColumns+` FROM identities WHERE user_id = ? ORDER BY provider`, func(row scanner) error {
+		id, err := scanIdentity(row)
+		res = append(res, id)
+		return err
+	}, userID)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *SQLStore) UnlinkIdentity(userID int64, provider string) error {
+	return s.tx(func(tx *sql.Tx) error {
+		user, err := userByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		var others int
+		if err := tx.QueryRow(`SELECT count(*) FROM identities WHERE user_id = ? AND provider != ?`, userID, provider).Scan(&others); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`DELETE FROM identities WHERE user_id = ? AND provider = ?`, userID, provider)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		if others == 0 && user.PasswordHash == "" {
+			return ErrConflict
+		}
+		return nil
+	})
+}
+
+// reauthenticate checks re outside any transaction, since the KDF is slow.
+// Writers must recheck that the password hash is unchanged.
+func (s *SQLStore) reauthenticate(userID int64, re Reauth) (model.User, error) {
+	user, err := userByID(s.db, userID)
+	if err != nil {
+		return model.User{}, err
+	}
+	var current *model.Session
+	sess, err := scanSession(s.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, re.Session))
+	switch {
+	case err == nil:
+		current = &sess
+	case !errors.Is(err, sql.ErrNoRows):
+		return model.User{}, err
+	}
+	if err := re.check(user, current, time.Now().UTC()); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// updateWithReauth applies fn to the user inside a transaction after checking
+// re, and stores the resulting two-factor settings.
+func (s *SQLStore) updateWithReauth(userID int64, re Reauth, fn func(tx *sql.Tx, u *model.User) error) error {
+	user, err := s.reauthenticate(userID, re)
+	if err != nil {
+		return err
+	}
+	return s.tx(func(tx *sql.Tx) error {
+		current, err := userByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		if current.PasswordHash != user.PasswordHash {
+			return ErrUnauthorized
+		}
+		if err := fn(tx, &current); err != nil {
+			return err
+		}
+		return updateTwoFactor(tx, current)
+	})
+}
+
+func (s *SQLStore) BeginTwoFactor(userID int64, re Reauth) (TwoFactorSetup, error) {
+	var setup TwoFactorSetup
+	err := s.updateWithReauth(userID, re, func(_ *sql.Tx, u *model.User) error {
+		if u.TwoFactorEnabled {
+			return ErrConflict
+		}
+		var err error
+		if setup, err = newTwoFactorSetup(*u); err != nil {
+			return err
+		}
+		u.TOTPPending = setup.Secret
+		return nil
+	})
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+	return setup, nil
+}
+
+func (s *SQLStore) EnableTwoFactor(userID int64, re Reauth, code string) ([]string, error) {
+	var codes []string
+	err := s.updateWithReauth(userID, re, func(_ *sql.Tx, u *model.User) error {
+		var err error
+		codes, err = enableTwoFactor(u, code, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *SQLStore) DisableTwoFactor(userID int64, re Reauth) error {
+	return s.updateWithReauth(userID, re, func(tx *sql.Tx, u *model.User) error {
+		disableTwoFactor(u)
+		_, err := tx.Exec(`DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?`, u.ID, model.TokenLoginChallenge)
+		return err
+	})
+}
+
+func (s *SQLStore) UpdateProfile(userID int64, keepSession string, p ProfileUpdate) (model.User, error) {
+	user, err := userByID(s.db, userID)
+	if err != nil {
+		return model.User{}, err
+	}
+	hash, err := p.checkPassword(user)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	var current model.User
+	err = s.tx(func(tx *sql.Tx) error {
+		var err error
+		if current, err = userByID(tx, userID); err != nil {
+			return err
+		}
+		if current.PasswordHash != user.PasswordHash {
+			return ErrUnauthorized
+		}
+		if err := p.apply(&current, hash); err != nil {
+			return err
+		}
+		var taken bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE (username_norm = ? OR email_norm = ?) AND id != ?)`,
+			normalize(current.Username), normalize(current.Email), userID).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			return ErrConflict
+		}
+		if _, err := tx.Exec(`UPDATE users SET username = ?, username_norm = ?, email = ?, email_norm = ?, email_verified_at = ?,
+			display_name = ?, bio = ?, avatar_url = ?, password_salt = ?, password_hash = ? WHERE id = ?`,
+			current.Username, normalize(current.Username), current.Email, normalize(current.Email), current.EmailVerifiedAt,
+			current.DisplayName, current.Bio, current.AvatarURL, current.PasswordSalt, current.PasswordHash, userID); err != nil {
+			return err
+		}
+		if hash == "" {
+			return nil
+		}
+		if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ? AND id != ?`, userID, keepSession); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM api_keys WHERE user_id = ?`, userID)
+		return err
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return current, nil
+}
+
+func (s *SQLStore) Profile(userID int64) (model.Profile, error) {
+	u, err := userByID(s.db, userID)
+	if err != nil {
+		return model.Profile{}, err
+	}
+	return u.Profile(), nil
+}
+
+func (s *SQLStore) DeleteAccount(userID int64, d AccountDeletion) error {
+	user, err := s.reauthenticate(userID, d.Reauth)
+	if err != nil {
+		return err
+	}
+	return s.tx(func(tx *sql.Tx) error {
+		current, err := userByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		if current.PasswordHash != user.PasswordHash {
+			return ErrUnauthorized
+		}
+		return deleteUser(tx, current, d)
+	})
+}
+
+// deleteUser removes current and what belongs to it once the caller has
+// decided it may; d.Reauth is not looked at.
+func deleteUser(tx *sql.Tx, current model.User, d AccountDeletion) error {
+	userID := current.ID
+	if current.Role == model.RoleAdmin {
+		var admins int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, model.RoleAdmin).Scan(&admins); err != nil {
+			return err
+		}
+		if admins == 1 {
+			return ErrLastAdmin
+		}
+	}
+	var hasNovels bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM novels WHERE author_id = ?)`, userID).Scan(&hasNovels); err != nil {
+		return err
+	}
+	target, err := actorByID(tx, d.TransferTo)
+	if err != nil {
+		return err
+	}
+	if err := d.check(userID, hasNovels, target); err != nil {
+		return err
+	}
+	if d.Novels == NovelsTransfer {
+		_, err = tx.Exec(`UPDATE novels SET author_id = ? WHERE author_id = ?`, d.TransferTo, userID)
+	} else {
+		_, err = tx.Exec(`DELETE FROM novels WHERE author_id = ?`, userID)
+	}
+	if err != nil {
+		return err
+	}
+	mail, err := mailTo(tx, current.Email)
+	if err != nil {
+		return err
+	}
+	for _, m := range mail {
+		if _, err := tx.Exec(`DELETE FROM outbox WHERE id = ?`, m.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM bookmarks WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	// Sessions, tokens, identities and API keys cascade, and comments
+	// and revisions lose their author.
+	_, err = tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	return err
+}
+
+func (s *SQLStore) ExportAccount(userID int64) (AccountExport, error) {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return AccountExport{}, err
+	}
+	defer tx.Rollback()
+
+	u, err := userByID(tx, userID)
+	if err != nil {
+		return AccountExport{}, err
+	}
+	e := newAccountExport(u)
+	if e.Mail, err = mailTo(tx, u.Email); err != nil {
+		return AccountExport{}, err
+	}
+	for _, q := range []struct {
+		stmt string
+		scan func(row scanner) error
+	}{
+		{`SELECT ` + sessionColumns + ` FROM sessions WHERE user_id = ?`, func(row scanner) error {
+			sess, err := scanSession(row)
+			e.Sessions = append(e.Sessions, sess)
+			return err
+		}},
+		{`SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = ?`, func(row scanner) error {
+			k, err := scanAPIKey(row)
+			e.APIKeys = append(e.APIKeys, k)
+			return err
+		}},
+		{`SELECT ` + identityColumns + ` FROM identities WHERE user_id = ?`, func(row scanner) error {
+			id, err := scanIdentity(row)
+			e.Identities = append(e.Identities, id)
+			return err
+		}},
+		{`SELECT ` + userTokenColumns + ` FROM user_tokens WHERE user_id = ?`, func(row scanner) error {
+			t, err := scanUserToken(row)
+			e.Tokens = append(e.Tokens, t)
+			return err
+		}},
+		{`SELECT ` + novelColumns + ` FROM novels WHERE author_id = ?`, func(row scanner) error {
+			n, err := scanNovel(row)
+			e.Novels = append(e.Novels, n)
+			return err
+		}},
+		{`SELECT ` + chapterColumns + ` FROM chapters WHERE novel_id IN (SELECT id FROM novels WHERE author_id = ?)`, func(row scanner) error {
+			ch, err := scanChapter(row)
+			e.Chapters = append(e.Chapters, ch)
+			return err
+		}},
+		{`SELECT ` + revisionColumns + ` FROM chapter_revisions WHERE author_id = ?`, func(row scanner) error {
+			r, err := scanRevision(row)
+			e.Revisions = append(e.Revisions, r)
+			return err
+		}},
+		{`SELECT ` + commentColumns + ` FROM comments WHERE user_id = ?`, func(row scanner) error {
+			c, err := scanComment(row)
+			e.Comments = append(e.Comments, c)
+			return err
+		}},
+		{`SELECT ` + bookmarkColumns + ` FROM bookmarks WHERE user_id = ?`, func(row scanner) error {
+			b, err := scanBookmark(row)
+			e.Bookmarks = append(e.Bookmarks, b)
+			return err
+		}},
+	} {
+		if err := queryAll(tx, q.stmt, q.scan, userID); err != nil {
+			return AccountExport{}, err
+		}
+	}
+	e.tidy()
+	return e, nil
+}
+
+// mailTo finds the messages sent to email. Recipients are stored as given,
+// so they are compared the way user emails are.
+func mailTo(q queryer, email string) ([]model.OutboxMessage, error) {
+	res := make([]model.OutboxMessage, 0)
+	err := queryAll(q, `SELECT `+mailColumns+` FROM outbox ORDER BY id`, func(row scanner) error {
+		m, err := scanMail(row)
+		if err == nil && normalize(m.To) == normalize(email) {
+			res = append(res, m)
+		}
+		return err
+	})
+	return res, err
+}
+
+func (s *SQLStore) Authenticate(token string) (model.User, model.Session, error) {
+	var user model.User
+	var sess model.Session
+	var recovery string
+	err := s.db.QueryRow(`SELECT u.id, u.username, u.email, u.role, u.display_name, u.bio, u.avatar_url, u.password_salt, u.password_hash, u.created_at, u.email_verified_at,
+			u.totp_secret, u.totp_pending, u.totp_last_step, u.recovery_codes, u.failed_logins, u.last_failed_login, u.locked_until,
+			s.id, s.user_id, s.token_hash, s.device, s.user_agent, s.created_at, s.last_seen_at, s.access_expires_at, s.expires_at
+		FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.token_hash = ?`, hashToken(token)).Scan(
+		&user.ID, &user.Username, &user.Email, &user.Role, &user.DisplayName, &user.Bio, &user.AvatarURL, &user.PasswordSalt, &user.PasswordHash, &user.CreatedAt, &user.EmailVerifiedAt,
+		&user.TOTPSecret, &user.TOTPPending, &user.TOTPLastStep, &recovery, &user.FailedLogins, &user.LastFailedLogin, &user.LockedUntil,
+		&sess.ID, &sess.UserID, &sess.TokenHash, &sess.Device, &sess.UserAgent, &sess.CreatedAt, &sess.LastSeenAt,
+		&sess.AccessExpiresAt, &sess.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, model.Session{}, ErrUnauthorized
+	}
+	if err != nil {
+		return model.User{}, model.Session{}, err
+	}
+	setTwoFactor(&user, recovery)
+	now := time.Now().UTC()
+	if !sessionActive(sess, now) {
+		return model.User{}, model.Session{}, ErrUnauthorized
+	}
+	if !needsTouch(sess, now) {
+		return user, sess, nil
+	}
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(s.sessionTTL)
+	if _, err := s.db.Exec(`UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?`, sess.LastSeenAt, sess.ExpiresAt, sess.ID); err != nil {
+		return model.User{}, model.Session{}, err
+	}
+	return user, sess, nil
+}
+
+func (s *SQLStore) Refresh(refreshToken string) (Tokens, error) {
+	var tokens Tokens
+	reused := false
+	err := s.tx(func(tx *sql.Tx) error {
+		rt, err := scanRefresh(tx.QueryRow(`SELECT `+refreshColumns+` FROM refresh_tokens WHERE token_hash = ?`, hashToken(refreshToken)))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUnauthorized
+		}
+		if err != nil {
+			return err
+		}
+		if rt.UsedAt != nil {
+			reused = true
+			_, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, rt.SessionID)
+			return err
+		}
+		sess, err := scanSession(tx.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, rt.SessionID))
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if !now.Before(sess.ExpiresAt) {
+			return ErrUnauthorized
+		}
+		next, issued, err := issueTokens(&sess, now, s.sessionTTL, s.accessTTL)
+		if err != nil {
+			return err
+		}
+		// Only the token just used is kept to detect reuse.
+		if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE session_id = ? AND used_at IS NOT NULL`, sess.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ?`, now, rt.TokenHash); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE sessions SET token_hash = ?, last_seen_at = ?, access_expires_at = ?, expires_at = ? WHERE id = ?`,
+			sess.TokenHash, sess.LastSeenAt, sess.AccessExpiresAt, sess.ExpiresAt, sess.ID); err != nil {
+			return err
+		}
+		tokens = issued
+		return insertRefresh(tx, next)
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+	if reused {
+		return Tokens{}, ErrRefreshReused
+	}
+	return tokens, nil
+}
+
+func (s *SQLStore) ListSessions(userID int64) ([]model.Session, error) {
+	res := make([]model.Session, 0)
+	err := queryAll(s.db, `SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND expires_at > ? ORDER BY last_seen_at DESC`,
+		func(row scanner) error {
+			sess, err := scanSession(row)
+			res = append(res, sess)
+			return err
+		}, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *SQLStore) RevokeSession(userID int64, sessionID string) error {
+	res, err := s.db.Exec(`DELETE FROM sessions WHERE id = ? AND user_id = ?`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateAPIKey(userID int64, name string, scopes []model.Scope, expiresAt *time.Time) (model.APIKey, string, error) {
+	var key model.APIKey
+	var token string
+	err := s.tx(func(tx *sql.Tx) error {
+		if _, err := userByID(tx, userID); err != nil {
+			return err
+		}
+		var n int
+		if err := tx.QueryRow(`SELECT count(*) FROM api_keys WHERE user_id = ?`, userID).Scan(&n); err != nil {
+			return err
+		}
+		if n >= maxAPIKeys {
+			return ErrTooManyAPIKeys
+		}
+		var err error
+		key, token, err = newAPIKey(userID, name, scopes, expiresAt, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		return insertAPIKey(tx, key)
+	})
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	return key, token, nil
+}
+
+func (s *SQLStore) ListAPIKeys(userID int64) ([]model.APIKey, error) {
+	res := make([]model.APIKey, 0)
+	err := queryAll(s.db, `SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? ORDER BY created_at DESC`, func(row scanner) error {
+		k, err := scanAPIKey(row)
+		res = append(res, k)
+		return err
+	}, userID)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *SQLStore) RevokeAPIKey(userID int64, id string) error {
+	res, err := s.db.Exec(`DELETE FROM api_keys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) AuthenticateAPIKey(token string) (model.User, model.APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE token_hash = ?`, hashToken(token)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, model.APIKey{}, ErrUnauthorized
+	}
+	if err != nil {
+		return model.User{}, model.APIKey{}, err
+	}
+	now := time.Now().UTC()
+	if !apiKeyActive(key, now) {
+		return model.User{}, model.APIKey{}, ErrUnauthorized
+	}
+	user, err := userByID(s.db, key.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return model.User{}, model.APIKey{}, ErrUnauthorized
+	}
+	if err != nil {
+		return model.User{}, model.APIKey{}, err
+	}
+	if !apiKeyNeedsTouch(key, now) {
+		return user, key, nil
+	}
+	key.LastUsedAt = &now
+	if _, err := s.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now, key.ID); err != nil {
+		return model.User{}, model.APIKey{}, err
+	}
+	return user, key, nil
+}
+
+func (s *SQLStore) SweepSessions(now time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLStore) CreatePasswordReset(email string) (model.User, string, error) {
+	user, err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email_norm = ?`, normalize(email)))
+	if err != nil {
+		return model.User{}, "", notFound(err)
+	}
+	return s.issueUserToken(user, model.TokenPasswordReset, passwordResetTTL)
+}
+
+func (s *SQLStore) CreateEmailVerification(userID int64) (model.User, string, error) {
+	user, err := userByID(s.db, userID)
+	if err != nil {
+		return model.User{}, "", err
+	}
+	if user.EmailVerifiedAt != nil {
+		return model.User{}, "", ErrConflict
+	}
+	return s.issueUserToken(user, model.TokenVerifyEmail, verifyEmailTTL)
+}
+
+func (s *SQLStore) issueUserToken(user model.User, purpose model.TokenPurpose, ttl time.Duration) (model.User, string, error) {
+	t, token, err := newUserToken(user, purpose, ttl)
+	if err != nil {
+		return model.User{}, "", err
+	}
+	err = s.tx(func(tx *sql.Tx) error {
+		return replaceUserToken(tx, t)
+	})
+	if err != nil {
+		return model.User{}, "", err
+	}
+	return user, token, nil
+}
+
+func (s *SQLStore) ResetPassword(token, password string) (model.User, error) {
+	if password == "" {
+		return model.User{}, fmt.Errorf("password is required")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	var user model.User
+	err = s.tx(func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		var t model.UserToken
+		if user, t, err = redeemUserToken(tx, token, model.TokenPasswordReset, now); err != nil {
+			return err
+		}
+		user.PasswordSalt = ""
+		user.PasswordHash = hash
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &now
+		}
+		if _, err := tx.Exec(`UPDATE users SET password_salt = '', password_hash = ?, email_verified_at = ? WHERE id = ?`,
+			user.PasswordHash, user.EmailVerifiedAt, user.ID); err != nil {
+			return err
+		}
+		if clearLoginFailures(&user) {
+			if err := updateLoginFailures(tx, user); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM user_tokens WHERE token_hash = ?`, t.TokenHash); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, user.ID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM api_keys WHERE user_id = ?`, user.ID)
+		return err
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func (s *SQLStore) VerifyEmail(token string) (model.User, error) {
+	var user model.User
+	err := s.tx(func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		u, t, err := redeemUserToken(tx, token, model.TokenVerifyEmail, now)
+		if err != nil {
+			return err
+		}
+		if u.EmailVerifiedAt == nil {
+			u.EmailVerifiedAt = &now
+		}
+		if _, err := tx.Exec(`UPDATE users SET email_verified_at = ? WHERE id = ?`, u.EmailVerifiedAt, u.ID); err != nil {
+			return err
+		}
+		user = u
+		_, err = tx.Exec(`DELETE FROM user_tokens WHERE token_hash = ?`, t.TokenHash)
+		return err
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func redeemUserToken(tx *sql.Tx, token string, purpose model.TokenPurpose, now time.Time) (model.User, model.UserToken, error) {
+	t, err := scanUserToken(tx.QueryRow(`SELECT `+userTokenColumns+` FROM user_tokens WHERE token_hash = ?`, hashToken(token)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, model.UserToken{}, ErrUnauthorized
+	}
+	if err != nil {
+		return model.User{}, model.UserToken{}, err
+	}
+	user, err := userByID(tx, t.UserID)
+	if err != nil {
+		return model.User{}, model.UserToken{}, err
+	}
+	if !userTokenValid(t, user, purpose, now) {
+		return model.User{}, model.UserToken{}, ErrUnauthorized
+	}
+	return user, t, nil
+}
+
+func (s *SQLStore) EnqueueMail(to, subject, body string) (model.OutboxMessage, error) {
+	now := time.Now().UTC()
+	m := model.OutboxMessage{
+		To:            to,
+		Subject:       subject,
+		Body:          body,
+		Status:        model.MailPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	res, err := s.db.Exec(`INSERT INTO outbox (recipient, subject, body, status, attempts, last_error, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, 0, '', ?, ?)`, m.To, m.Subject, m.Body, m.Status, m.NextAttemptAt, m.CreatedAt)
+	if err != nil {
+		return model.OutboxMessage{}, err
+	}
+	if m.ID, err = res.LastInsertId(); err != nil {
+		return model.OutboxMessage{}, err
+	}
+	return m, nil
+}
+
+func (s *SQLStore) DueMail(now time.Time, limit int) ([]model.OutboxMessage, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	res := make([]model.OutboxMessage, 0)
+	err := queryAll(s.db, `SELECT `+mailColumns+` FROM outbox WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT ?`,
+		func(row scanner) error {
+			m, err := scanMail(row)
+			res = append(res, m)
+			return err
+		}, model.MailPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *SQLStore) MarkMailSent(id int64, at time.Time) error {
+	return s.updateMail(`UPDATE outbox SET status = ?, attempts = attempts + 1, body = '', last_error = '', sent_at = ? WHERE id = ?`,
+		model.MailSent, at.UTC(), id)
+}
+
+func (s *SQLStore) MarkMailFailed(id int64, reason string, retryAt *time.Time) error {
+	if retryAt != nil {
+		return s.updateMail(`UPDATE outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?`,
+			reason, retryAt.UTC(), id)
+	}
+	return s.updateMail(`UPDATE outbox SET status = ?, attempts = attempts + 1, last_error = ?, body = '' WHERE id = ?`,
+		model.MailFailed, reason, id)
+}
+
+func (s *SQLStore) updateMail(stmt string, args ...any) error {
+	res, err := s.db.Exec(stmt, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) PruneMail(before time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM outbox WHERE status != ? AND created_at < ?`, model.MailPending, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// requireManager fails unless actorID may manage users.
+func requireManager(q queryer, actorID int64) error {
+	a, err := actorByID(q, actorID)
+	if err != nil {
+		return err
+	}
+	if !a.canManageUsers() {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func (s *SQLStore) ListUsers(actorID int64, query string, role model.Role, limit, offset int) ([]model.User, error) {
+	if err := requireManager(s.db, actorID); err != nil {
+		return nil, err
+	}
+	var where []string
+	var args []any
+	if role != "" {
+		where = append(where, `role = ?`)
+		args = append(args, role)
+	}
+	if q := normalize(query); q != "" {
+		where = append(where, `instr(username_norm || ' ' || email_norm, ?) > 0`)
+		args = append(args, q)
+	}
+	stmt := `SELECT ` + userColumns + ` FROM users`
+	if len(where) > 0 {
+		stmt += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	args = append(args, limit, max(offset, 0))
+
+	res := make([]model.User, 0)
+	err := queryAll(s.db, stmt+` ORDER BY id LIMIT ? OFFSET ?`, func(row scanner) error {
+		u, err := scanUser(row)
+		res = append(res, u)
+		return err
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *SQLStore) UserByID(actorID, userID int64) (model.User, error) {
+	if err := requireManager(s.db, actorID); err != nil {
+		return model.User{}, err
+	}
+	return userByID(s.db, userID)
+}
+
+func (s *SQLStore) SetRole(actorID, userID int64, role model.Role) (model.User, error) {
+	var u model.User
+	err := s.tx(func(tx *sql.Tx) error {
+		if err := requireManager(tx, actorID); err != nil {
+			return err
+		}
+		var err error
+		if u, err = userByID(tx, userID); err != nil {
+			return err
+		}
+		return setRole(tx, &u, role)
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+func (s *SQLStore) UnlockUser(actorID, userID int64) (model.User, error) {
+	var u model.User
+	err := s.tx(func(tx *sql.Tx) error {
+		if err := requireManager(tx, actorID); err != nil {
+			return err
+		}
+		var err error
+		if u, err = userByID(tx, userID); err != nil {
+			return err
+		}
+		if !clearLoginFailures(&u) {
+			return nil
+		}
+		return updateLoginFailures(tx, u)
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+func (s *SQLStore) DeleteUser(actorID, userID int64, novels NovelDisposition, transferTo int64) error {
+	return s.tx(func(tx *sql.Tx) error {
+		if err := requireManager(tx, actorID); err != nil {
+			return err
+		}
+		if actorID == userID {
+			return errDeleteSelf
+		}
+		u, err := userByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		return deleteUser(tx, u, AccountDeletion{Novels: novels, TransferTo: transferTo})
+	})
+}
+
+// AssignRole changes a user's role without an authorization check. It is
+// meant for operators, e.g. to appoint the first admin.
+func (s *SQLStore) AssignRole(email string, role model.Role) (model.User, error) {
+	var u model.User
+	err := s.tx(func(tx *sql.Tx) error {
+		var err error
+		u, err = scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE email_norm = ?`, normalize(email)))
+		if err != nil {
+			return notFound(err)
+		}
+		return setRole(tx, &u, role)
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+func setRole(tx *sql.Tx, u *model.User, role model.Role) error {
+	if !role.Valid() {
+		return errInvalidRole
+	}
+	if u.Role == role {
+		return nil
+	}
+	if u.Role == model.RoleAdmin {
+		var admins int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, model.RoleAdmin).Scan(&admins); err != nil {
+			return err
+		}
+		if admins == 1 {
+			return ErrLastAdmin
+		}
+	}
+	u.Role = role
+	_, err := tx.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, u.ID)
+	return err
+}
+
+func (s *SQLStore) RevokeUserSessions(actorID, userID int64) (int, error) {
+	var n int64
+	err := s.tx(func(tx *sql.Tx) error {
+		if err := requireManager(tx, actorID); err != nil {
+			return err
+		}
+		if _, err := userByID(tx, userID); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return int(n), err
+}
+
+func (s *SQLStore) CreateNovel(authorID int64, title, description, genre string, status model.NovelStatus, publishAt *time.Time) (model.Novel, error) {
+	a, err := actorByID(s.db, authorID)
+	if err != nil {
+		return model.Novel{}, err
+	}
+	if !a.canCreateNovel() {
+		return model.Novel{}, ErrUnauthorized
+	}
+	if status == "" {
+		status = model.NovelDraft
+	}
+	if strings.TrimSpace(title) == "" {
+		return model.Novel{}, fmt.Errorf("title is required")
+	}
+	now := time.Now().UTC()
+	n := model.Novel{
+		AuthorID:    authorID,
+		Title:       strings.TrimSpace(title),
+		Description: strings.TrimSpace(description),
+		Genre:       strings.TrimSpace(genre),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := scheduleNovel(&n, &status, publishAt, now); err != nil {
+		return model.Novel{}, err
+	}
+	res, err := s.db.Exec(`INSERT INTO novels (author_id, title, description, genre, status, publish_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, n.AuthorID, n.Title, n.Description, n.Genre, n.Status, n.PublishAt, n.CreatedAt, n.UpdatedAt)
+	if err != nil {
+		return model.Novel{}, err
+	}
+	if n.ID, err = res.LastInsertId(); err != nil {
+		return model.Novel{}, err
+	}
+	return n, nil
+}
+
+func (s *SQLStore) ListNovels(query string, authorID int64, includeDrafts bool, requesterID int64, limit, offset int) ([]model.Novel, error) {
+	var where []string
+	var args []any
+	if authorID > 0 {
+		where = append(where, `author_id = ?`)
+		args = append(args, authorID)
+	}
+	a, err := actorByID(s.db, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if !includeDrafts || !a.can(permReadDrafts) {
+		where = append(where, `(status = ? OR author_id = ?)`)
+		args = append(args, model.NovelPublished, a.id)
+	}
+	if q := normalize(query); q != "" {
+		where = append(where, `instr(lower(title || ' ' || description || ' ' || genre), ?) > 0`)
+		args = append(args, q)
+	}
+
+	stmt := `SELECT ` + novelColumns + ` FROM novels`
+	if len(where) > 0 {
+		stmt += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	stmt += ` ORDER BY updated_at DESC, id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, max(offset, 0))
+
+	rows, err := s.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]model.Novel, 0)
+	for rows.Next() {
+		n, err := scanNovel(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLStore) NovelByID(id int64, requesterID int64) (model.Novel, error) {
+	return visibleNovel(s.db, id, requesterID)
+}
+
+func (s *SQLStore) UpdateNovel(id, requesterID int64, title, description, genre string, status *model.NovelStatus, publishAt *time.Time) (model.Novel, error) {
+	var n model.Novel
+	err := s.tx(func(tx *sql.Tx) error {
+		var err error
+		takedown := isTakedown(title, description, genre, status, publishAt)
+		n, err = novelFor(tx, id, requesterID, func(a actor, n model.Novel) bool { return a.canUpdateNovel(n, takedown) })
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(title) != "" {
+			n.Title = strings.TrimSpace(title)
+		}
+		if description != "" {
+			n.Description = strings.TrimSpace(description)
+		}
+		if genre != "" {
+			n.Genre = strings.TrimSpace(genre)
+		}
+		n.UpdatedAt = time.Now().UTC()
+		if err := scheduleNovel(&n, status, publishAt, n.UpdatedAt); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE novels SET title = ?, description = ?, genre = ?, status = ?, publish_at = ?, updated_at = ? WHERE id = ?`,
+			n.Title, n.Description, n.Genre, n.Status, n.PublishAt, n.UpdatedAt, n.ID)
+		return err
+	})
+	if err != nil {
+		return model.Novel{}, err
+	}
+	return n, nil
+}
+
+func (s *SQLStore) DeleteNovel(id, requesterID int64) error {
+	return s.tx(func(tx *sql.Tx) error {
+		if _, err := novelFor(tx, id, requesterID, actor.canDeleteNovel); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM novels WHERE id = ?`, id)
+		return err
+	})
+}
+
+func (s *SQLStore) ReleaseDue(now time.Time) ([]model.Event, error) {
+	now = now.UTC()
+	var events []model.Event
+	err := s.tx(func(tx *sql.Tx) error {
+		events = nil
+		err := queryAll(tx, `SELECT `+novelColumns+` FROM novels WHERE status = ? AND publish_at <= ?`, func(row scanner) error {
+			n, err := scanNovel(row)
+			if err == nil {
+				events = append(events, novelEvent(n, *n.PublishAt))
+			}
+			return err
+		}, model.NovelDraft, now)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE novels SET status = ?, publish_at = NULL, updated_at = ? WHERE status = ? AND publish_at <= ?`,
+			model.NovelPublished, now, model.NovelDraft, now); err != nil {
+			return err
+		}
+		err = queryAll(tx, `SELECT `+prefixed("c", chapterColumns)+` FROM chapters c JOIN novels n ON n.id = c.novel_id
+			WHERE c.publish_at <= ? AND n.status = ?`, func(row scanner) error {
+			ch, err := scanChapter(row)
+			if err == nil {
+				events = append(events, chapterEvent(ch, *ch.PublishAt))
+			}
+			return err
+		}, now, model.NovelPublished)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE novels SET updated_at = ? WHERE status = ? AND id IN (SELECT novel_id FROM chapters WHERE publish_at <= ?)`,
+			now, model.NovelPublished, now); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE chapters SET status = ?, publish_at = NULL WHERE publish_at <= ? AND novel_id IN (SELECT id FROM novels WHERE status = ?)`,
+			model.ChapterPublished, now, model.NovelPublished)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+func (s *SQLStore) CreateChapter(novelID, requesterID int64, title, content string, format model.ContentFormat, position int, status *model.ChapterStatus, publishAt *time.Time) (model.Chapter, error) {
+	var ch model.Chapter
+	err := s.tx(func(tx *sql.Tx) error {
+		if _, err := editableNovel(tx, novelID, requesterID); err != nil {
+			return err
+		}
+		if strings.TrimSpace(title) == "" {
+			return fmt.Errorf("title is required")
+		}
+		now := time.Now().UTC()
+		ch = model.Chapter{
+			NovelID:   novelID,
+			Title:     strings.TrimSpace(title),
+			Content:   content,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := setFormat(&ch, format); err != nil {
+			return err
+		}
+		if err := scheduleChapter(&ch, status, publishAt, now); err != nil {
+			return err
+		}
+		chs, err := novelChapters(tx, novelID)
+		if err != nil {
+			return err
+		}
+		chs = placeChapter(chs, &ch, position)
+		if err := savePositions(tx, novelID, chs); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`INSERT INTO chapters (novel_id, title, content, format, position, status, publish_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, ch.NovelID, ch.Title, ch.Content, ch.Format, ch.Position, ch.Status, ch.PublishAt, ch.CreatedAt, ch.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if ch.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if err := insertRevision(tx, newRevision(ch, 1, requesterID, now)); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE novels SET updated_at = ? WHERE id = ?`, now, novelID)
+		return err
+	})
+	if err != nil {
+		return model.Chapter{}, err
+	}
+	return ch, nil
+}
+
+func (s *SQLStore) ListChapters(novelID, requesterID int64) ([]model.Chapter, error) {
+	n, a, err := readableNovel(s.db, novelID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	chs, err := novelChapters(s.db, novelID)
+	if err != nil {
+		return nil, err
+	}
+	return a.listChapters(n, chs), nil
+}
+
+func (s *SQLStore) ChapterByID(novelID, chapterID, requesterID int64) (model.Chapter, error) {
+	n, a, err := readableNovel(s.db, novelID, requesterID)
+	if err != nil {
+		return model.Chapter{}, err
+	}
+	ch, err := chapterInNovel(s.db, novelID, chapterID)
+	if err != nil {
+		return model.Chapter{}, err
+	}
+	if !a.canReadChapter(n, ch) {
+		return model.Chapter{}, ErrNotFound
+	}
+	return chapterAsSeen(s.db, a, n, ch)
+}
+
+func (s *SQLStore) UpdateChapter(novelID, chapterID, requesterID int64, title, content string, format model.ContentFormat, position int, status *model.ChapterStatus, publishAt *time.Time) (model.Chapter, error) {
+	var ch model.Chapter
+	err := s.tx(func(tx *sql.Tx) error {
+		takedown := isChapterTakedown(title, content, format, position, status, publishAt)
+		n, err := novelFor(tx, novelID, requesterID, func(a actor, n model.Novel) bool {
+			return a.canUpdateNovel(n, takedown)
+		})
+		if err != nil {
+			return err
+		}
+		if ch, err = chapterInNovel(tx, novelID, chapterID); err != nil {
+			return err
+		}
+		old := ch
+		if strings.TrimSpace(title) != "" {
+			ch.Title = strings.TrimSpace(title)
+		}
+		if content != "" {
+			ch.Content = content
+		}
+		if err := setFormat(&ch, format); err != nil {
+			return err
+		}
+		ch.UpdatedAt = time.Now().UTC()
+		if err := scheduleChapter(&ch, status, publishAt, ch.UpdatedAt); err != nil {
+			return err
+		}
+		if position > 0 {
+			chs, err := novelChapters(tx, novelID)
+			if err != nil {
+				return err
+			}
+			if err := savePositions(tx, novelID, placeChapter(chs, &ch, position)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`UPDATE chapters SET title = ?, content = ?, format = ?, position = ?, status = ?, publish_at = ?, updated_at = ? WHERE id = ?`,
+			ch.Title, ch.Content, ch.Format, ch.Position, ch.Status, ch.PublishAt, ch.UpdatedAt, ch.ID); err != nil {
+			return err
+		}
+		if ch.Content != old.Content {
+			if err := addRevision(tx, old, ch, n, requesterID, nil); err != nil {
+				return err
+			}
+		}
+		if old.Status != model.ChapterDraft && ch.Status == model.ChapterDraft {
+			if err := unpublishBookmarks(tx, n, ch); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`UPDATE novels SET updated_at = ? WHERE id = ?`, ch.UpdatedAt, novelID)
+		return err
+	})
+	if err != nil {
+		return model.Chapter{}, err
+	}
+	return ch, nil
+}
+
+func (s *SQLStore) DeleteChapter(novelID, chapterID, requesterID int64) error {
+	return s.tx(func(tx *sql.Tx) error {
+		if _, err := novelFor(tx, novelID, requesterID, actor.canDeleteChapter); err != nil {
+			return err
+		}
+		ch, err := chapterInNovel(tx, novelID, chapterID)
+		if err != nil {
+			return err
+		}
+		chs, err := novelChapters(tx, novelID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM chapters WHERE id = ?`, chapterID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE bookmarks SET chapter_id = NULL, chapter_pos = NULL WHERE novel_id = ? AND chapter_id = ?`, novelID, chapterID); err != nil {
+			return err
+		}
+		return savePositions(tx, novelID, removeChapter(chs, ch))
+	})
+}
+
+func (s *SQLStore) ReorderChapters(novelID, requesterID int64, chapterIDs []int64) ([]model.Chapter, error) {
+	var res []model.Chapter
+	err := s.tx(func(tx *sql.Tx) error {
+		n, err := editableNovel(tx, novelID, requesterID)
+		if err != nil {
+			return err
+		}
+		a, err := actorByID(tx, requesterID)
+		if err != nil {
+			return err
+		}
+		chs, err := novelChapters(tx, novelID)
+		if err != nil {
+			return err
+		}
+		if chs, err = reorderChapters(chs, chapterIDs); err != nil {
+			return err
+		}
+		if err := savePositions(tx, novelID, chs); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE novels SET updated_at = ? WHERE id = ?`, time.Now().UTC(), novelID); err != nil {
+			return err
+		}
+		res = a.listChapters(n, chs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// novelChapters returns the chapters of a novel in no particular order.
+func novelChapters(q queryer, novelID int64) ([]model.Chapter, error) {
+	var chs []model.Chapter
+	err := queryAll(q, `SELECT `+chapterColumns+` FROM chapters WHERE novel_id = ?`, func(row scanner) error {
+		ch, err := scanChapter(row)
+		chs = append(chs, ch)
+		return err
+	}, novelID)
+	return chs, err
+}
+
+// savePositions saves the positions of chs, the chapters of a novel
+// numbered afresh, and the positions kept in bookmarks on them.
+func savePositions(tx *sql.Tx, novelID int64, chs []model.Chapter) error {
+	for _, ch := range chs {
+		if _, err := tx.Exec(`UPDATE chapters SET position = ? WHERE id = ? AND position != ?`, ch.Position, ch.ID, ch.Position); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`UPDATE bookmarks SET chapter_pos = (SELECT position FROM chapters WHERE chapters.id = bookmarks.chapter_id)
+		WHERE novel_id = ? AND chapter_id IS NOT NULL`, novelID)
+	return err
+}
+
+// unpublishBookmarks moves the bookmarks on ch, just made a draft, that their
+// owners can no longer open back to the last published chapter before it.
+func unpublishBookmarks(tx *sql.Tx, n model.Novel, ch model.Chapter) error {
+	var toID, toPos sql.NullInt64
+	err := tx.QueryRow(`SELECT id, position FROM chapters
+		WHERE novel_id = ? AND status = ? AND (position < ? OR position = ? AND id < ?)
+		ORDER BY position DESC, id DESC LIMIT 1`,
+		n.ID, model.ChapterPublished, ch.Position, ch.Position, ch.ID).Scan(&toID, &toPos)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	var userIDs []int64
+	err = queryAll(tx, `SELECT user_id FROM bookmarks WHERE novel_id = ? AND chapter_id = ?`, func(row scanner) error {
+		var id int64
+		err := row.Scan(&id)
+		userIDs = append(userIDs, id)
+		return err
+	}, n.ID, ch.ID)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		a, err := actorByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		if a.canReadChapter(n, ch) {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE bookmarks SET chapter_id = ?, chapter_pos = ? WHERE user_id = ? AND novel_id = ?`,
+			toID, toPos, userID, n.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revisions returns the history of ch, oldest first.
+func revisions(q queryer, ch model.Chapter, n model.Novel) ([]model.Revision, error) {
+	var revs []model.Revision
+	err := queryAll(q, `SELECT `+revisionColumns+` FROM chapter_revisions WHERE chapter_id = ? ORDER BY number`, func(row scanner) error {
+		r, err := scanRevision(row)
+		revs = append(revs, r)
+		return err
+	}, ch.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(revs) == 0 {
+		revs = append(revs, baselineRevision(ch, n))
+	}
+	return revs, nil
+}
+
+// addRevision records the content of ch, changed from old by authorID, as its
+// next revision.
+func addRevision(tx *sql.Tx, old, ch model.Chapter, n model.Novel, authorID int64, restoredFrom *int) error {
+	var last int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(number), 0) FROM chapter_revisions WHERE chapter_id = ?`, ch.ID).Scan(&last); err != nil {
+		return err
+	}
+	if last == 0 {
+		if err := insertRevision(tx, baselineRevision(old, n)); err != nil {
+			return err
+		}
+		last = 1
+	}
+	r := newRevision(ch, last+1, authorID, ch.UpdatedAt)
+	r.RestoredFrom = restoredFrom
+	return insertRevision(tx, r)
+}
+
+func revisionChapter(q queryer, novelID, chapterID, requesterID int64) (model.Chapter, model.Novel, error) {
+	n, err := novelFor(q, novelID, requesterID, actor.canReadUnreleased)
+	if err != nil {
+		return model.Chapter{}, model.Novel{}, err
+	}
+	ch, err := chapterInNovel(q, novelID, chapterID)
+	return ch, n, err
+}
+
+func (s *SQLStore) ListRevisions(novelID, chapterID, requesterID int64) ([]model.Revision, error) {
+	ch, n, err := revisionChapter(s.db, novelID, chapterID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	revs, err := revisions(s.db, ch, n)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]model.Revision, 0, len(revs))
+	for i := len(revs) - 1; i >= 0; i-- {
+		r := revs[i]
+		r.Content = ""
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func (s *SQLStore) RevisionByNumber(novelID, chapterID, requesterID int64, number int) (model.Revision, error) {
+	ch, n, err := revisionChapter(s.db, novelID, chapterID, requesterID)
+	if err != nil {
+		return model.Revision{}, err
+	}
+	revs, err := revisions(s.db, ch, n)
+	if err != nil {
+		return model.Revision{}, err
+	}
+	for _, r := range revs {
+		if r.Number == number {
+			return r, nil
+		}
+	}
+	return model.Revision{}, ErrNotFound
+}
+
+func (s *SQLStore) RestoreRevision(novelID, chapterID, requesterID int64, number int) (model.Chapter, error) {
+	var ch model.Chapter
+	err := s.tx(func(tx *sql.Tx) error {
+		n, err := editableNovel(tx, novelID, requesterID)
+		if err != nil {
+			return err
+		}
+		if ch, err = chapterInNovel(tx, novelID, chapterID); err != nil {
+			return err
+		}
+		revs, err := revisions(tx, ch, n)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(revs, func(r model.Revision) bool { return r.Number == number })
+		if i < 0 {
+			return ErrNotFound
+		}
+		old := ch
+		ch.Content = revs[i].Content
+		ch.UpdatedAt = time.Now().UTC()
+		if _, err := tx.Exec(`UPDATE chapters SET content = ?, updated_at = ? WHERE id = ?`, ch.Content, ch.UpdatedAt, ch.ID); err != nil {
+			return err
+		}
+		if err := addRevision(tx, old, ch, n, requesterID, &number); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE novels SET updated_at = ? WHERE id = ?`, ch.UpdatedAt, novelID)
+		return err
+	})
+	if err != nil {
+		return model.Chapter{}, err
+	}
+	return ch, nil
+}
+
+func (s *SQLStore) CreateComment(novelID int64, chapterID *int64, userID int64, body string) (model.Comment, error) {
+	if strings.TrimSpace(body) == "" {
+		return model.Comment{}, fmt.Errorf("body is required")
+	}
+	var cm model.Comment
+	err := s.tx(func(tx *sql.Tx) error {
+		if _, err := visibleNovel(tx, novelID, userID); err != nil {
+			return err
+		}
+		if chapterID != nil {
+			if _, err := visibleChapter(tx, novelID, *chapterID, userID); err != nil {
+				return err
+			}
+		}
+		cm = model.Comment{
+			NovelID:   novelID,
+			ChapterID: chapterID,
+			UserID:    userID,
+			Body:      strings.TrimSpace(body),
+			CreatedAt: time.Now().UTC(),
+		}
+		res, err := tx.Exec(`INSERT INTO comments (novel_id, chapter_id, user_id, body, created_at) VALUES (?, ?, ?, ?, ?)`,
+			cm.NovelID, cm.ChapterID, cm.UserID, cm.Body, cm.CreatedAt)
+		if err != nil {
+			return err
+		}
+		cm.ID, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return model.Comment{}, err
+	}
+	return cm, nil
+}
+
+func (s *SQLStore) ListComments(novelID, requesterID int64, chapterID *int64) ([]model.Comment, error) {
+	n, a, err := readableNovel(s.db, novelID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	stmt := `SELECT ` + commentColumns + ` FROM comments WHERE novel_id = ?`
+	args := []any{novelID}
+	if chapterID != nil {
+		stmt += ` AND chapter_id = ?`
+		args = append(args, *chapterID)
+	}
+	if !a.canReadUnreleased(n) {
+		stmt += ` AND (chapter_id IS NULL OR chapter_id NOT IN (SELECT id FROM chapters WHERE novel_id = ? AND status = ?))`
+		args = append(args, novelID, model.ChapterDraft)
+	}
+	rows, err := s.db.Query(stmt+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]model.Comment, 0)
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLStore) DeleteComment(novelID, commentID, requesterID int64) error {
+	return s.tx(func(tx *sql.Tx) error {
+		c, err := scanComment(tx.QueryRow(`SELECT `+commentColumns+` FROM comments WHERE id = ? AND novel_id = ?`, commentID, novelID))
+		if err != nil {
+			return notFound(err)
+		}
+		a, err := actorByID(tx, requesterID)
+		if err != nil {
+			return err
+		}
+		if !a.canDeleteComment(c) {
+			return ErrUnauthorized
+		}
+		_, err = tx.Exec(`DELETE FROM comments WHERE id = ?`, commentID)
+		return err
+	})
+}
+
+func (s *SQLStore) UpsertBookmark(userID, novelID int64, chapterID *int64) (model.Bookmark, error) {
+	var b model.Bookmark
+	err := s.tx(func(tx *sql.Tx) error {
+		if _, err := visibleNovel(tx, novelID, userID); err != nil {
+			return err
+		}
+		var pos *int
+		if chapterID != nil {
+			ch, err := visibleChapter(tx, novelID, *chapterID, userID)
+			if err != nil {
+				return err
+			}
+			pos = &ch.Position
+		}
+		b = model.Bookmark{
+			UserID:     userID,
+			NovelID:    novelID,
+			ChapterID:  chapterID,
+			UpdatedAt:  time.Now().UTC(),
+			ChapterPos: pos,
+		}
+		_, err := tx.Exec(`INSERT INTO bookmarks (`+bookmarkColumns+`) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, novel_id) DO UPDATE SET
+				chapter_id = excluded.chapter_id, updated_at = excluded.updated_at, chapter_pos = excluded.chapter_pos`,
+			b.UserID, b.NovelID, b.ChapterID, b.UpdatedAt, b.ChapterPos)
+		if err != nil {
+			return err
+		}
+		a, err := actorByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		b, err = bookmarkAsSeen(tx, a, b)
+		return err
+	})
+	if err != nil {
+		return model.Bookmark{}, err
+	}
+	return b, nil
+}
+
+func (s *SQLStore) MyBookmarks(userID int64) ([]model.Bookmark, error) {
+	res := make([]model.Bookmark, 0)
+	err := queryAll(s.db, `SELECT `+bookmarkColumns+` FROM bookmarks WHERE user_id = ? ORDER BY updated_at DESC`, func(row scanner) error {
+		b, err := scanBookmark(row)
+		res = append(res, b)
+		return err
+	}, userID)
+	if err != nil {
+		return nil, err
+	}
+	a, err := actorByID(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i, b := range res {
+		if res[i], err = bookmarkAsSeen(s.db, a, b); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Import loads d into an empty database in one transaction. It fails with
+// ErrConflict when the database already holds users or novels, so it is safe
+// to run on every start.
+func (s *SQLStore) Import(d Dataset) error {
+	return s.tx(func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM novels)`).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%w: database is not empty", ErrConflict)
+		}
+
+		for _, u := range d.Users {
+			if _, err := tx.Exec(`INSERT INTO users (id, username, username_norm, email, email_norm, role, display_name, bio, avatar_url,
+				password_salt, password_hash, created_at, email_verified_at, totp_secret, totp_pending, totp_last_step, recovery_codes,
+				failed_logins, last_failed_login, locked_until)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, u.ID, u.Username, normalize(u.Username), u.Email, normalize(u.Email),
+				cmp.Or(u.Role, defaultRole), u.DisplayName, u.Bio, u.AvatarURL, u.PasswordSalt, u.PasswordHash, u.CreatedAt, u.EmailVerifiedAt, u.TOTPSecret, u.TOTPPending, u.TOTPLastStep,
+				strings.Join(u.RecoveryCodes, " "), u.FailedLogins, u.LastFailedLogin, u.LockedUntil); err != nil {
+				return fmt.Errorf("import user %d: %w", u.ID, err)
+			}
+		}
+		for _, sess := range d.Sessions {
+			if err := insertSession(tx, sess); err != nil {
+				return fmt.Errorf("import session %s: %w", sess.ID, err)
+			}
+		}
+		for _, rt := range d.Refresh {
+			if err := insertRefresh(tx, rt); err != nil {
+				return fmt.Errorf("import refresh token: %w", err)
+			}
+		}
+		for _, t := range d.UserTokens {
+			if err := insertUserToken(tx, t); err != nil {
+				return fmt.Errorf("import user token: %w", err)
+			}
+		}
+		for _, id := range d.Identities {
+			if err := insertIdentity(tx, id); err != nil {
+				return fmt.Errorf("import identity %s: %w", id.Provider, err)
+			}
+		}
+		for _, k := range d.APIKeys {
+			if err := insertAPIKey(tx, k); err != nil {
+				return fmt.Errorf("import api key %s: %w", k.ID, err)
+			}
+		}
+		for _, m := range d.Outbox {
+			if _, err := tx.Exec(`INSERT INTO outbox (`+mailColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				m.ID, m.To, m.Subject, m.Body, m.Status, m.Attempts, m.LastError, m.NextAttemptAt, m.CreatedAt, m.SentAt); err != nil {
+				return fmt.Errorf("import mail %d: %w", m.ID, err)
+			}
+		}
+		for _, n := range d.Novels {
+			if _, err := tx.Exec(`INSERT INTO novels (`+novelColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				n.ID, n.AuthorID, n.Title, n.Description, n.Genre, n.Status, n.PublishAt, n.CreatedAt, n.UpdatedAt); err != nil {
+				return fmt.Errorf("import novel %d: %w", n.ID, err)
+			}
+		}
+		for _, ch := range d.Chapters {
+			if _, err := tx.Exec(`INSERT INTO chapters (`+chapterColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				ch.ID, ch.NovelID, ch.Title, ch.Content, cmp.Or(ch.Format, model.FormatPlain), ch.Position, ch.Status, ch.PublishAt, ch.CreatedAt, ch.UpdatedAt); err != nil {
+				return fmt.Errorf("import chapter %d: %w", ch.ID, err)
+			}
+		}
+		for _, r := range d.Revisions {
+			if err := insertRevision(tx, r); err != nil {
+				return fmt.Errorf("import revision %d:%d: %w", r.ChapterID, r.Number, err)
+			}
+		}
+		for _, c := range d.Comments {
+			if _, err := tx.Exec(`INSERT INTO comments (`+commentColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+				c.ID, c.NovelID, c.ChapterID, sql.NullInt64{Int64: c.UserID, Valid: c.UserID != 0}, c.Body, c.CreatedAt); err != nil {
+				return fmt.Errorf("import comment %d: %w", c.ID, err)
+			}
+		}
+		for _, b := range d.Bookmarks {
+			if _, err := tx.Exec(`INSERT INTO bookmarks (`+bookmarkColumns+`) VALUES (?, ?, ?, ?, ?)`,
+				b.UserID, b.NovelID, b.ChapterID, b.UpdatedAt, b.ChapterPos); err != nil {
+				return fmt.Errorf("import bookmark %d:%d: %w", b.UserID, b.NovelID, err)
+			}
+		}
+
+		for table, next := range map[string]int64{
+			"users":    d.NextUserID,
+			"novels":   d.NextNovelID,
+			"chapters": d.NextChapterID,
+			"comments": d.NextCommentID,
+			"outbox":   d.NextMailID,
+		} {
+			if err := bumpSequence(tx, table, next); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Dataset reads every table inside one read transaction, so the copy is
+// consistent even while the server keeps writing.
+func (s *SQLStore) Dataset() (Dataset, error) {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer tx.Rollback()
+
+	var d Dataset
+	if err := queryAll(tx, `SELECT `+userColumns+` FROM users ORDER BY id`, func(row scanner) error {
+		u, err := scanUser(row)
+		d.Users = append(d.Users, u)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+sessionColumns+` FROM sessions ORDER BY id`, func(row scanner) error {
+		sess, err := scanSession(row)
+		d.Sessions = append(d.Sessions, sess)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+refreshColumns+` FROM refresh_tokens ORDER BY token_hash`, func(row scanner) error {
+		rt, err := scanRefresh(row)
+		d.Refresh = append(d.Refresh, rt)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+userTokenColumns+` FROM user_tokens ORDER BY token_hash`, func(row scanner) error {
+		t, err := scanUserToken(row)
+		d.UserTokens = append(d.UserTokens, t)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+identityColumns+` FROM identities ORDER BY provider, subject`, func(row scanner) error {
+		id, err := scanIdentity(row)
+		d.Identities = append(d.Identities, id)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`, func(row scanner) error {
+		k, err := scanAPIKey(row)
+		d.APIKeys = append(d.APIKeys, k)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+mailColumns+` FROM outbox ORDER BY id`, func(row scanner) error {
+		m, err := scanMail(row)
+		d.Outbox = append(d.Outbox, m)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+novelColumns+` FROM novels ORDER BY id`, func(row scanner) error {
+		n, err := scanNovel(row)
+		d.Novels = append(d.Novels, n)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+chapterColumns+` FROM chapters ORDER BY id`, func(row scanner) error {
+		ch, err := scanChapter(row)
+		d.Chapters = append(d.Chapters, ch)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+revisionColumns+` FROM chapter_revisions ORDER BY chapter_id, number`, func(row scanner) error {
+		r, err := scanRevision(row)
+		d.Revisions = append(d.Revisions, r)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+commentColumns+` FROM comments ORDER BY id`, func(row scanner) error {
+		c, err := scanComment(row)
+		d.Comments = append(d.Comments, c)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT `+bookmarkColumns+` FROM bookmarks ORDER BY user_id, novel_id`, func(row scanner) error {
+		b, err := scanBookmark(row)
+		d.Bookmarks = append(d.Bookmarks, b)
+		return err
+	}); err != nil {
+		return Dataset{}, err
+	}
+	if err := queryAll(tx, `SELECT name, seq FROM sqlite_sequence`, func(row scanner) error {
+		var name string
+		var seq int64
+		if err := row.Scan(&name, &seq); err != nil {
+			return err
+		}
+		switch name {
+		case "users":
+			d.NextUserID = seq
+		case "novels":
+			d.NextNovelID = seq
+		case "chapters":
+			d.NextChapterID = seq
+		case "comments":
+			d.NextCommentID = seq
+		case "outbox":
+			d.NextMailID = seq
+		}
+		return nil
+	}); err != nil {
+		return Dataset{}, err
+	}
+	return d, nil
+}
+
+func queryAll(q queryer, stmt string, fn func(row scanner) error, args ...any) error {
+	rows, err := q.Query(stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// bumpSequence keeps IDs freed by deletions in the source from being reused.
+func bumpSequence(tx *sql.Tx, table string, next int64) error {
+	res, err := tx.Exec(`UPDATE sqlite_sequence SET seq = max(seq, ?) WHERE name = ?`, next, table)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 || next == 0 {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO sqlite_sequence (name, seq) VALUES (?, ?)`, table, next)
+	return err
+}
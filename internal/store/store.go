@@ -6,6 +6,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -32,17 +34,42 @@ type Store struct {
 
 	chaptersByID      map[int64]model.Chapter
 	chapterIDsByNovel map[int64][]int64
+	revisions         map[int64][]model.Revision
 
 	commentsByID      map[int64]model.Comment
 	commentIDsByNovel map[int64][]int64
 
 	bookmarks map[string]model.Bookmark
-	sessions  map[string]int64
+
+	sessionsByID    map[string]model.Session
+	sessionsByToken map[string]string
+	sessionTTL      time.Duration
+	accessTTL       time.Duration
+
+	refreshTokens    map[string]model.RefreshToken
+	refreshBySession map[string][]string
+
+	userTokens map[string]model.UserToken
+	outbox     map[int64]model.OutboxMessage
+	identities map[string]model.Identity
+
+	apiKeys        map[string]model.APIKey
+	apiKeysByToken map[string]string
 
 	nextUserID    int64
 	nextNovelID   int64
 	nextChapterID int64
 	nextCommentID int64
+	nextMailID    int64
+
+	journal      *os.File
+	journalSize  int64
+	snapshotSize int64
+	seq          uint64
+	migrated     bool
+
+	box         *sealer
+	unencrypted bool
 }
 
 func New() *Store {
@@ -50,7 +77,75 @@ func New() *Store {
 	return s
 }
 
-func NewWithDB(dbPath string) (*Store, error) {
+func NewWithDB(dbPath string, opts ...Option) (*Store, error) {
+	s, err := newStore(dbPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if s.dbPath == "" {
+		return s, nil
+	}
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load reads the JSON database at dbPath into a detached in-memory store.
+// No file is created, truncated or compacted, so it is safe to call while a
+// server owns the database; mutations on the result are not persisted.
+func Load(dbPath string, opts ...Option) (*Store, error) {
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		var s *Store
+		if s, err = newStore(dbPath, opts); err != nil {
+			return nil, err
+		}
+		if _, err = s.readLocked(); err == nil {
+			s.dbPath = ""
+			return s, nil
+		}
+		// A compaction rotated the journal between reading the snapshot and
+		// the journal segments; the next pass sees the new generation.
+		if !errors.Is(err, errJournalGap) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// RotateKey re-encrypts the JSON database at dbPath, including the previous
+// generation kept for recovery, from oldKey to newKey. Either key may be nil
+// for plaintext. The server must be stopped.
+func RotateKey(dbPath string, oldKey, newKey []byte) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return err
+	}
+	s, err := NewWithDB(dbPath, WithEncryptionKey(oldKey))
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	box, err := newSealer(newKey)
+	if err != nil {
+		return err
+	}
+	s.box = box
+	return s.rewriteGenerationsLocked()
+}
+
+func newStore(dbPath string, opts []Option) (*Store, error) {
+	o, err := buildOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	box, err := newSealer(o.key)
+	if err != nil {
+		return nil, err
+	}
 	s := &Store{
 		dbPath:            strings.TrimSpace(dbPath),
 		usersByID:         make(map[int64]model.User),
@@ -59,162 +154,1284 @@ func NewWithDB(dbPath string) (*Store, error) {
 		novelsByID:        make(map[int64]model.Novel),
 		chaptersByID:      make(map[int64]model.Chapter),
 		chapterIDsByNovel: make(map[int64][]int64),
+		revisions:         make(map[int64][]model.Revision),
 		commentsByID:      make(map[int64]model.Comment),
 		commentIDsByNovel: make(map[int64][]int64),
 		bookmarks:         make(map[string]model.Bookmark),
-		sessions:          make(map[string]int64),
+		sessionsByID:      make(map[string]model.Session),
+		sessionsByToken:   make(map[string]string),
+		sessionTTL:        o.sessionTTL,
+		accessTTL:         o.accessTTL,
+		refreshTokens:     make(map[string]model.RefreshToken),
+		refreshBySession:  make(map[string][]string),
+		userTokens:        make(map[string]model.UserToken),
+		outbox:            make(map[int64]model.OutboxMessage),
+		identities:        make(map[string]model.Identity),
+		apiKeys:           make(map[string]model.APIKey),
+		apiKeysByToken:    make(map[string]string),
+		box:               box,
 	}
-	if s.dbPath == "" {
-		return s, nil
+	return s, nil
+}
+
+func normalize(input string) string {
+	return strings.TrimSpace(strings.ToLower(input))
+}
+
+// hashToken is the form a session token is stored and looked up in, so the
+// database never holds a usable bearer token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	if err := s.loadLocked(); err != nil {
+	return hex.EncodeToString(b), nil
+}
+
+func (s *Store) Register(username, email, password string, client Client) (model.User, Tokens, error) {
+	u := normalize(username)
+	e := normalize(email)
+	if u == "" || e == "" || password == "" {
+		return model.User{}, Tokens{}, fmt.Errorf("username, email, and password are required")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.usersByUsername[u]; exists {
+		return model.User{}, Tokens{}, ErrConflict
+	}
+	if _, exists := s.usersByEmail[e]; exists {
+		return model.User{}, Tokens{}, ErrConflict
+	}
+
+	s.nextUserID++
+	user := model.User{
+		ID:           s.nextUserID,
+		Username:     strings.TrimSpace(username),
+		Email:        strings.TrimSpace(email),
+		Role:         defaultRole,
+		PasswordHash: hash,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	sess, rt, tokens, err := newSession(user.ID, client, s.sessionTTL, s.accessTTL)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	if err := s.commitLocked(putUser(user), putSession(sess), putRefresh(rt)); err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	return user, tokens, nil
+}
+
+// Login verifies the password without holding the store lock, since the KDF
+// is deliberately slow, and upgrades the stored hash when verifyPassword asks
+// for it.
+func (s *Store) Login(email, password string, client Client) (model.User, Tokens, error) {
+	s.mu.RLock()
+	uid, ok := s.usersByEmail[normalize(email)]
+	user := s.usersByID[uid]
+	s.mu.RUnlock()
+
+	if !ok {
+		verifyPassword("", dummyHash, password)
+		return model.User{}, Tokens{}, ErrUnauthorized
+	}
+	now := time.Now().UTC()
+	if err := loginLocked(user, now); err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	valid, rehash := verifyPassword(user.PasswordSalt, user.PasswordHash, password)
+	if !valid {
+		return model.User{}, Tokens{}, s.loginFailed(user, now)
+	}
+	var hash string
+	if rehash {
+		var err error
+		if hash, err = hashPassword(password); err != nil {
+			return model.User{}, Tokens{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.usersByID[user.ID]
+	if !ok || current.PasswordHash != user.PasswordHash {
+		return model.User{}, Tokens{}, ErrUnauthorized
+	}
+	if err := loginLocked(current, now); err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	var ops []walOp
+	if rehash {
+		current.PasswordSalt = ""
+		current.PasswordHash = hash
+	}
+	// Failures are only cleared once the second factor is in too, or the
+	// password alone would buy unlimited guesses at the code.
+	if current.TwoFactorEnabled {
+		if rehash {
+			ops = append(ops, putUser(current))
+		}
+		t, token, err := s.issueUserTokenLocked(current, model.TokenLoginChallenge, challengeTTL, ops...)
+		if err != nil {
+			return model.User{}, Tokens{}, err
+		}
+		return model.User{}, Tokens{}, &Challenge{Token: token, ExpiresAt: t.ExpiresAt}
+	}
+	if clearLoginFailures(&current) || rehash {
+		ops = append(ops, putUser(current))
+	}
+	sess, rt, tokens, err := newSession(user.ID, client, s.sessionTTL, s.accessTTL)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	if err := s.commitLocked(append(ops, putSession(sess), putRefresh(rt))...); err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	return current, tokens, nil
+}
+
+func (s *Store) loginFailed(user model.User, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.usersByID[user.ID]
+	if !ok || current.PasswordHash != user.PasswordHash {
+		return ErrUnauthorized
+	}
+	if err := loginLocked(current, now); err != nil {
+		return err
+	}
+	countLoginFailure(&current, now)
+	if err := s.commitLocked(putUser(current)); err != nil {
+		return err
+	}
+	return failedLogin(current, now)
+}
+
+// CompleteLogin redeems a login challenge with a TOTP or recovery code. A
+// challenge is dropped after maxChallengeAttempts wrong codes, and every wrong
+// code counts toward the account lockout like a wrong password.
+func (s *Store) CompleteLogin(challenge, code string, client Client) (model.User, Tokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	user, t, err := s.redeemLocked(challenge, model.TokenLoginChallenge, now)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	if err := loginLocked(user, now); err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	if !checkSecondFactor(&user, code, now) {
+		t.Attempts++
+		op := putUserToken(t)
+		if t.Attempts >= maxChallengeAttempts {
+			op = delUserToken(t.TokenHash)
+		}
+		countLoginFailure(&user, now)
+		if err := s.commitLocked(op, putUser(user)); err != nil {
+			return model.User{}, Tokens{}, err
+		}
+		return model.User{}, Tokens{}, failedLogin(user, now)
+	}
+	clearLoginFailures(&user)
+	sess, rt, tokens, err := newSession(user.ID, client, s.sessionTTL, s.accessTTL)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	if err := s.commitLocked(delUserToken(t.TokenHash), putUser(user), putSession(sess), putRefresh(rt)); err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	return user, tokens, nil
+}
+
+func (s *Store) LoginWithIdentity(acct ExternalAccount, client Client) (model.User, Tokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ops []walOp
+	var user model.User
+	if id, ok := s.identities[identityKey(acct.Provider, acct.Subject)]; ok {
+		if user, ok = s.usersByID[id.UserID]; !ok {
+			return model.User{}, Tokens{}, ErrNotFound
+		}
+	} else {
+		if err := checkExternalEmail(acct); err != nil {
+			return model.User{}, Tokens{}, err
+		}
+		if _, exists := s.usersByEmail[normalize(acct.Email)]; exists {
+			return model.User{}, Tokens{}, ErrConflict
+		}
+		name, err := pickUsername(acct.Email, func(norm string) (bool, error) {
+			_, exists := s.usersByUsername[norm]
+			return exists, nil
+		})
+		if err != nil {
+			return model.User{}, Tokens{}, err
+		}
+		s.nextUserID++
+		user = newExternalUser(acct, name)
+		user.ID = s.nextUserID
+		ops = append(ops, putUser(user), putIdentity(newIdentity(user.ID, acct)))
+	}
+
+	if user.TwoFactorEnabled {
+		t, token, err := s.issueUserTokenLocked(user, model.TokenLoginChallenge, challengeTTL, ops...)
+		if err != nil {
+			return model.User{}, Tokens{}, err
+		}
+		return model.User{}, Tokens{}, &Challenge{Token: token, ExpiresAt: t.ExpiresAt}
+	}
+	sess, rt, tokens, err := newSession(user.ID, client, s.sessionTTL, s.accessTTL)
+	if err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	if err := s.commitLocked(append(ops, putSession(sess), putRefresh(rt))...); err != nil {
+		return model.User{}, Tokens{}, err
+	}
+	return user, tokens, nil
+}
+
+func (s *Store) LinkIdentity(userID int64, acct ExternalAccount) (model.Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.usersByID[userID]; !ok {
+		return model.Identity{}, ErrNotFound
+	}
+	if id, ok := s.identities[identityKey(acct.Provider, acct.Subject)]; ok {
+		if id.UserID != userID {
+			return model.Identity{}, ErrConflict
+		}
+		return id, nil
+	}
+	for _, id := range s.identities {
+		if id.UserID == userID && id.Provider == acct.Provider {
+			return model.Identity{}, ErrConflict
+		}
+	}
+	id := newIdentity(userID, acct)
+	if err := s.commitLocked(putIdentity(id)); err != nil {
+		return model.Identity{}, err
+	}
+	return id, nil
+}
+
+func (s *Store) ListIdentities(userID int64) ([]model.Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]model.Identity, 0)
+	for _, id := range s.identities {
+		if id.UserID == userID {
+			res = append(res, id)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Provider < res[j].Provider })
+	return res, nil
+}
+
+// UnlinkIdentity refuses to remove the only way a user without a password
+// can sign in.
+func (s *Store) UnlinkIdentity(userID int64, provider string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var target *model.Identity
+	others := 0
+	for _, id := range s.identities {
+		if id.UserID != userID {
+			continue
+		}
+		if id.Provider == provider {
+			target = &id
+		} else {
+			others++
+		}
+	}
+	if target == nil {
+		return ErrNotFound
+	}
+	if others == 0 && s.usersByID[userID].PasswordHash == "" {
+		return ErrConflict
+	}
+	return s.commitLocked(delIdentity(target.Provider, target.Subject))
+}
+
+// reauthenticate checks re against the user without holding the lock, since
+// the KDF is slow. Writers must recheck under the lock that the password hash
+// is unchanged.
+func (s *Store) reauthenticate(userID int64, re Reauth) (model.User, error) {
+	s.mu.RLock()
+	user, ok := s.usersByID[userID]
+	sess, found := s.sessionsByID[re.Session]
+	s.mu.RUnlock()
+	if !ok {
+		return model.User{}, ErrNotFound
+	}
+	var current *model.Session
+	if found {
+		current = &sess
+	}
+	if err := re.check(user, current, time.Now().UTC()); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func (s *Store) BeginTwoFactor(userID int64, re Reauth) (TwoFactorSetup, error) {
+	user, err := s.reauthenticate(userID, re)
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.usersByID[userID]
+	if !ok || current.PasswordHash != user.PasswordHash {
+		return TwoFactorSetup{}, ErrUnauthorized
+	}
+	if current.TwoFactorEnabled {
+		return TwoFactorSetup{}, ErrConflict
+	}
+	setup, err := newTwoFactorSetup(current)
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+	current.TOTPPending = setup.Secret
+	if err := s.commitLocked(putUser(current)); err != nil {
+		return TwoFactorSetup{}, err
+	}
+	return setup, nil
+}
+
+func (s *Store) EnableTwoFactor(userID int64, re Reauth, code string) ([]string, error) {
+	user, err := s.reauthenticate(userID, re)
+	if err != nil {
 		return nil, err
 	}
-	return s, nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.usersByID[userID]
+	if !ok || current.PasswordHash != user.PasswordHash {
+		return nil, ErrUnauthorized
+	}
+	codes, err := enableTwoFactor(&current, code, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.commitLocked(putUser(current)); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *Store) DisableTwoFactor(userID int64, re Reauth) error {
+	user, err := s.reauthenticate(userID, re)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.usersByID[userID]
+	if !ok || current.PasswordHash != user.PasswordHash {
+		return ErrUnauthorized
+	}
+	disableTwoFactor(&current)
+	ops := []walOp{putUser(current)}
+	for hash, t := range s.userTokens {
+		if t.UserID == userID && t.Purpose == model.TokenLoginChallenge {
+			ops = append(ops, delUserToken(hash))
+		}
+	}
+	return s.commitLocked(ops...)
+}
+
+func (s *Store) UpdateProfile(userID int64, keepSession string, p ProfileUpdate) (model.User, error) {
+	s.mu.RLock()
+	user, ok := s.usersByID[userID]
+	s.mu.RUnlock()
+	if !ok {
+		return model.User{}, ErrNotFound
+	}
+	hash, err := p.checkPassword(user)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.usersByID[userID]
+	if !ok || current.PasswordHash != user.PasswordHash {
+		return model.User{}, ErrUnauthorized
+	}
+	if err := p.apply(&current, hash); err != nil {
+		return model.User{}, err
+	}
+	if id, ok := s.usersByUsername[normalize(current.Username)]; ok && id != userID {
+		return model.User{}, ErrConflict
+	}
+	if id, ok := s.usersByEmail[normalize(current.Email)]; ok && id != userID {
+		return model.User{}, ErrConflict
+	}
+	ops := []walOp{putUser(current)}
+	if hash != "" {
+		for id, sess := range s.sessionsByID {
+			if sess.UserID == userID && id != keepSession {
+				ops = append(ops, delSession(id))
+			}
+		}
+		ops = append(ops, s.apiKeyOpsLocked(userID)...)
+	}
+	if err := s.commitLocked(ops...); err != nil {
+		return model.User{}, err
+	}
+	return current, nil
 }
 
-func normalize(input string) string {
-	return strings.TrimSpace(strings.ToLower(input))
+func (s *Store) Profile(userID int64) (model.Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.usersByID[userID]
+	if !ok {
+		return model.Profile{}, ErrNotFound
+	}
+	return u.Profile(), nil
+}
+
+func (s *Store) DeleteAccount(userID int64, d AccountDeletion) error {
+	user, err := s.reauthenticate(userID, d.Reauth)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.usersByID[userID]
+	if !ok || current.PasswordHash != user.PasswordHash {
+		return ErrUnauthorized
+	}
+	return s.deleteUserLocked(current, d)
+}
+
+// deleteUserLocked removes current and what belongs to it once the caller
+// has decided it may; d.Reauth is not looked at.
+func (s *Store) deleteUserLocked(current model.User, d AccountDeletion) error {
+	userID := current.ID
+	if current.Role == model.RoleAdmin && s.adminCountLocked() == 1 {
+		return ErrLastAdmin
+	}
+	var novels []model.Novel
+	for _, n := range s.novelsByID {
+		if n.AuthorID == userID {
+			novels = append(novels, n)
+		}
+	}
+	if err := d.check(userID, len(novels) > 0, s.actorLocked(d.TransferTo)); err != nil {
+		return err
+	}
+
+	var ops []walOp
+	deleted := make(map[int64]bool)
+	for _, n := range novels {
+		if d.Novels == NovelsTransfer {
+			n.AuthorID = d.TransferTo
+			ops = append(ops, putNovel(n))
+			continue
+		}
+		deleted[n.ID] = true
+		ops = append(ops, s.deleteNovelOpsLocked(n.ID)...)
+	}
+	for _, c := range s.commentsByID {
+		if c.UserID == userID && !deleted[c.NovelID] {
+			c.UserID = 0
+			ops = append(ops, putComment(c))
+		}
+	}
+	for k, b := range s.bookmarks {
+		if b.UserID == userID && !deleted[b.NovelID] {
+			ops = append(ops, delBookmark(k))
+		}
+	}
+	for chapterID, revs := range s.revisions {
+		if deleted[s.chaptersByID[chapterID].NovelID] {
+			continue
+		}
+		for _, r := range revs {
+			if r.AuthorID != nil && *r.AuthorID == userID {
+				r.AuthorID = nil
+				ops = append(ops, putRevision(r))
+			}
+		}
+	}
+	for id, sess := range s.sessionsByID {
+		if sess.UserID == userID {
+			ops = append(ops, delSession(id))
+		}
+	}
+	for id, k := range s.apiKeys {
+		if k.UserID == userID {
+			ops = append(ops, delAPIKey(id))
+		}
+	}
+	for _, id := range s.identities {
+		if id.UserID == userID {
+			ops = append(ops, delIdentity(id.Provider, id.Subject))
+		}
+	}
+	for hash, t := range s.userTokens {
+		if t.UserID == userID {
+			ops = append(ops, delUserToken(hash))
+		}
+	}
+	for id, m := range s.outbox {
+		if normalize(m.To) == normalize(current.Email) {
+			ops = append(ops, delMail(id))
+		}
+	}
+	return s.commitLocked(append(ops, delUser(userID))...)
+}
+
+func (s *Store) ExportAccount(userID int64) (AccountExport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.usersByID[userID]
+	if !ok {
+		return AccountExport{}, ErrNotFound
+	}
+	e := newAccountExport(u)
+	for _, sess := range s.sessionsByID {
+		if sess.UserID == userID {
+			e.Sessions = append(e.Sessions, sess)
+		}
+	}
+	for _, k := range s.apiKeys {
+		if k.UserID == userID {
+			e.APIKeys = append(e.APIKeys, k)
+		}
+	}
+	for _, id := range s.identities {
+		if id.UserID == userID {
+			e.Identities = append(e.Identities, id)
+		}
+	}
+	for _, t := range s.userTokens {
+		if t.UserID == userID {
+			e.Tokens = append(e.Tokens, t)
+		}
+	}
+	for _, m := range s.outbox {
+		if normalize(m.To) == normalize(u.Email) {
+			e.Mail = append(e.Mail, m)
+		}
+	}
+	for _, n := range s.novelsByID {
+		if n.AuthorID != userID {
+			continue
+		}
+		e.Novels = append(e.Novels, n)
+		for _, id := range s.chapterIDsByNovel[n.ID] {
+			e.Chapters = append(e.Chapters, s.chaptersByID[id])
+		}
+	}
+	for _, revs := range s.revisions {
+		for _, r := range revs {
+			if r.AuthorID != nil && *r.AuthorID == userID {
+				e.Revisions = append(e.Revisions, r)
+			}
+		}
+	}
+	for _, c := range s.commentsByID {
+		if c.UserID == userID {
+			e.Comments = append(e.Comments, c)
+		}
+	}
+	for _, b := range s.bookmarks {
+		if b.UserID == userID {
+			e.Bookmarks = append(e.Bookmarks, b)
+		}
+	}
+	e.tidy()
+	return e, nil
+}
+
+func (s *Store) Authenticate(token string) (model.User, model.Session, error) {
+	now := time.Now().UTC()
+	s.mu.RLock()
+	user, sess, err := s.authenticateLocked(token, now)
+	s.mu.RUnlock()
+	if err != nil || !needsTouch(sess, now) {
+		return user, sess, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, sess, err = s.authenticateLocked(token, now)
+	if err != nil || !needsTouch(sess, now) {
+		return user, sess, err
+	}
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(s.sessionTTL)
+	if err := s.commitLocked(putSession(sess)); err != nil {
+		return model.User{}, model.Session{}, err
+	}
+	return user, sess, nil
+}
+
+func (s *Store) authenticateLocked(token string, now time.Time) (model.User, model.Session, error) {
+	id, ok := s.sessionsByToken[hashToken(token)]
+	if !ok {
+		return model.User{}, model.Session{}, ErrUnauthorized
+	}
+	sess := s.sessionsByID[id]
+	if !sessionActive(sess, now) {
+		return model.User{}, model.Session{}, ErrUnauthorized
+	}
+	user, ok := s.usersByID[sess.UserID]
+	if !ok {
+		return model.User{}, model.Session{}, ErrUnauthorized
+	}
+	return user, sess, nil
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+// A refresh token that was already exchanged means it leaked, so the whole
+// session is revoked and ErrRefreshReused returned.
+func (s *Store) Refresh(refreshToken string) (Tokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[hashToken(refreshToken)]
+	if !ok {
+		return Tokens{}, ErrUnauthorized
+	}
+	sess, ok := s.sessionsByID[rt.SessionID]
+	if !ok {
+		return Tokens{}, ErrUnauthorized
+	}
+	if rt.UsedAt != nil {
+		if err := s.commitLocked(delSession(sess.ID)); err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{}, ErrRefreshReused
+	}
+	now := time.Now().UTC()
+	if !now.Before(sess.ExpiresAt) {
+		return Tokens{}, ErrUnauthorized
+	}
+	next, tokens, err := issueTokens(&sess, now, s.sessionTTL, s.accessTTL)
+	if err != nil {
+		return Tokens{}, err
+	}
+	// Only the token just used is kept to detect reuse; older links of the
+	// chain would otherwise pile up for as long as the session lives.
+	var ops []walOp
+	for _, hash := range s.refreshBySession[sess.ID] {
+		if old := s.refreshTokens[hash]; old.UsedAt != nil {
+			ops = append(ops, delRefresh(hash))
+		}
+	}
+	rt.UsedAt = &now
+	if err := s.commitLocked(append(ops, putRefresh(rt), putSession(sess), putRefresh(next))...); err != nil {
+		return Tokens{}, err
+	}
+	return tokens, nil
+}
+
+func (s *Store) CreatePasswordReset(email string) (model.User, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uid, ok := s.usersByEmail[normalize(email)]
+	if !ok {
+		return model.User{}, "", ErrNotFound
+	}
+	user := s.usersByID[uid]
+	_, token, err := s.issueUserTokenLocked(user, model.TokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return model.User{}, "", err
+	}
+	return user, token, nil
+}
+
+func (s *Store) CreateEmailVerification(userID int64) (model.User, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.usersByID[userID]
+	if !ok {
+		return model.User{}, "", ErrNotFound
+	}
+	if user.EmailVerifiedAt != nil {
+		return model.User{}, "", ErrConflict
+	}
+	_, token, err := s.issueUserTokenLocked(user, model.TokenVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return model.User{}, "", err
+	}
+	return user, token, nil
+}
+
+// issueUserTokenLocked replaces the user's tokens for purpose with a new one,
+// committing it together with ops.
+func (s *Store) issueUserTokenLocked(user model.User, purpose model.TokenPurpose, ttl time.Duration, ops ...walOp) (model.UserToken, string, error) {
+	t, token, err := newUserToken(user, purpose, ttl)
+	if err != nil {
+		return model.UserToken{}, "", err
+	}
+	for hash, old := range s.userTokens {
+		if old.UserID == user.ID && old.Purpose == purpose {
+			ops = append(ops, delUserToken(hash))
+		}
+	}
+	if err := s.commitLocked(append(ops, putUserToken(t))...); err != nil {
+		return model.UserToken{}, "", err
+	}
+	return t, token, nil
+}
+
+// ResetPassword sets a new password, which also proves the user owns the
+// email address, and signs out every session.
+func (s *Store) ResetPassword(token, password string) (model.User, error) {
+	if password == "" {
+		return model.User{}, fmt.Errorf("password is required")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	user, t, err := s.redeemLocked(token, model.TokenPasswordReset, now)
+	if err != nil {
+		return model.User{}, err
+	}
+	user.PasswordSalt = ""
+	user.PasswordHash = hash
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	clearLoginFailures(&user)
+	ops := []walOp{delUserToken(t.TokenHash), putUser(user)}
+	for id, sess := range s.sessionsByID {
+		if sess.UserID == user.ID {
+			ops = append(ops, delSession(id))
+		}
+	}
+	ops = append(ops, s.apiKeyOpsLocked(user.ID)...)
+	if err := s.commitLocked(ops...); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// apiKeyOpsLocked revokes every API key of a user. A new password does this
+// so that a key minted by whoever had taken over the account stops working.
+func (s *Store) apiKeyOpsLocked(userID int64) []walOp {
+	var ops []walOp
+	for id, k := range s.apiKeys {
+		if k.UserID == userID {
+			ops = append(ops, delAPIKey(id))
+		}
+	}
+	return ops
+}
+
+func (s *Store) VerifyEmail(token string) (model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	user, t, err := s.redeemLocked(token, model.TokenVerifyEmail, now)
+	if err != nil {
+		return model.User{}, err
+	}
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.commitLocked(delUserToken(t.TokenHash), putUser(user)); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func (s *Store) redeemLocked(token string, purpose model.TokenPurpose, now time.Time) (model.User, model.UserToken, error) {
+	t, ok := s.userTokens[hashToken(token)]
+	if !ok {
+		return model.User{}, model.UserToken{}, ErrUnauthorized
+	}
+	user, ok := s.usersByID[t.UserID]
+	if !ok || !userTokenValid(t, user, purpose, now) {
+		return model.User{}, model.UserToken{}, ErrUnauthorized
+	}
+	return user, t, nil
+}
+
+func (s *Store) EnqueueMail(to, subject, body string) (model.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	m := model.OutboxMessage{
+		ID:            s.nextMailID + 1,
+		To:            to,
+		Subject:       subject,
+		Body:          body,
+		Status:        model.MailPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if err := s.commitLocked(putMail(m)); err != nil {
+		return model.OutboxMessage{}, err
+	}
+	return m, nil
+}
+
+func (s *Store) DueMail(now time.Time, limit int) ([]model.OutboxMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]model.OutboxMessage, 0)
+	for _, m := range s.outbox {
+		if m.Status == model.MailPending && !m.NextAttemptAt.After(now) {
+			res = append(res, m)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (s *Store) MarkMailSent(id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.outbox[id]
+	if !ok {
+		return ErrNotFound
+	}
+	at = at.UTC()
+	m.Status = model.MailSent
+	m.Attempts++
+	m.Body = ""
+	m.LastError = ""
+	m.SentAt = &at
+	return s.commitLocked(putMail(m))
+}
+
+func (s *Store) MarkMailFailed(id int64, reason string, retryAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.outbox[id]
+	if !ok {
+		return ErrNotFound
+	}
+	m.Attempts++
+	m.LastError = reason
+	if retryAt != nil {
+		m.NextAttemptAt = retryAt.UTC()
+	} else {
+		m.Status = model.MailFailed
+		m.Body = ""
+	}
+	return s.commitLocked(putMail(m))
+}
+
+func (s *Store) PruneMail(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ops []walOp
+	for id, m := range s.outbox {
+		if m.Status != model.MailPending && m.CreatedAt.Before(before) {
+			ops = append(ops, delMail(id))
+		}
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+	if err := s.commitLocked(ops...); err != nil {
+		return 0, err
+	}
+	return len(ops), nil
+}
+
+func (s *Store) ListSessions(userID int64) ([]model.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	res := make([]model.Session, 0)
+	for _, sess := range s.sessionsByID {
+		if sess.UserID == userID && now.Before(sess.ExpiresAt) {
+			res = append(res, sess)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LastSeenAt.After(res[j].LastSeenAt) })
+	return res, nil
+}
+
+func (s *Store) RevokeSession(userID int64, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessionsByID[sessionID]
+	if !ok || sess.UserID != userID {
+		return ErrNotFound
+	}
+	return s.commitLocked(delSession(sessionID))
+}
+
+func (s *Store) CreateAPIKey(userID int64, name string, scopes []model.Scope, expiresAt *time.Time) (model.APIKey, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.usersByID[userID]; !ok {
+		return model.APIKey{}, "", ErrNotFound
+	}
+	n := 0
+	for _, k := range s.apiKeys {
+		if k.UserID == userID {
+			n++
+		}
+	}
+	if n >= maxAPIKeys {
+		return model.APIKey{}, "", ErrTooManyAPIKeys
+	}
+	key, token, err := newAPIKey(userID, name, scopes, expiresAt, time.Now().UTC())
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	if err := s.commitLocked(putAPIKey(key)); err != nil {
+		return model.APIKey{}, "", err
+	}
+	return key, token, nil
+}
+
+func (s *Store) ListAPIKeys(userID int64) ([]model.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]model.APIKey, 0)
+	for _, k := range s.apiKeys {
+		if k.UserID == userID {
+			res = append(res, k)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.After(res[j].CreatedAt) })
+	return res, nil
+}
+
+func (s *Store) RevokeAPIKey(userID int64, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok || k.UserID != userID {
+		return ErrNotFound
+	}
+	return s.commitLocked(delAPIKey(id))
+}
+
+func (s *Store) AuthenticateAPIKey(token string) (model.User, model.APIKey, error) {
+	now := time.Now().UTC()
+	s.mu.RLock()
+	user, key, err := s.authenticateAPIKeyLocked(token, now)
+	s.mu.RUnlock()
+	if err != nil || !apiKeyNeedsTouch(key, now) {
+		return user, key, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, key, err = s.authenticateAPIKeyLocked(token, now)
+	if err != nil || !apiKeyNeedsTouch(key, now) {
+		return user, key, err
+	}
+	key.LastUsedAt = &now
+	if err := s.commitLocked(putAPIKey(key)); err != nil {
+		return model.User{}, model.APIKey{}, err
+	}
+	return user, key, nil
+}
+
+func (s *Store) authenticateAPIKeyLocked(token string, now time.Time) (model.User, model.APIKey, error) {
+	id, ok := s.apiKeysByToken[hashToken(token)]
+	if !ok {
+		return model.User{}, model.APIKey{}, ErrUnauthorized
+	}
+	key := s.apiKeys[id]
+	if !apiKeyActive(key, now) {
+		return model.User{}, model.APIKey{}, ErrUnauthorized
+	}
+	user, ok := s.usersByID[key.UserID]
+	if !ok {
+		return model.User{}, model.APIKey{}, ErrUnauthorized
+	}
+	return user, key, nil
+}
+
+func (s *Store) SweepSessions(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ops []walOp
+	for id, sess := range s.sessionsByID {
+		if !now.Before(sess.ExpiresAt) {
+			ops = append(ops, delSession(id))
+		}
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+	if err := s.commitLocked(ops...); err != nil {
+		return 0, err
+	}
+	return len(ops), nil
+}
+
+func (s *Store) actorLocked(userID int64) actor {
+	u, ok := s.usersByID[userID]
+	if !ok {
+		return actor{}
+	}
+	return actor{id: u.ID, role: u.Role}
+}
+
+func (s *Store) ListUsers(actorID int64, query string, role model.Role, limit, offset int) ([]model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.actorLocked(actorID).canManageUsers() {
+		return nil, ErrUnauthorized
+	}
+	q := normalize(query)
+	res := make([]model.User, 0)
+	for _, u := range s.usersByID {
+		if role != "" && u.Role != role {
+			continue
+		}
+		if q != "" && !strings.Contains(normalize(u.Username+" "+u.Email), q) {
+			continue
+		}
+		res = append(res, u)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	if offset > len(res) {
+		return []model.User{}, nil
+	}
+	res = res[max(offset, 0):]
+	if limit > 0 && limit < len(res) {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (s *Store) UserByID(actorID, userID int64) (model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.actorLocked(actorID).canManageUsers() {
+		return model.User{}, ErrUnauthorized
+	}
+	u, ok := s.usersByID[userID]
+	if !ok {
+		return model.User{}, ErrNotFound
+	}
+	return u, nil
 }
 
-func hashPassword(salt, password string) string {
-	sum := sha256.Sum256([]byte(salt + ":" + password))
-	return hex.EncodeToString(sum[:])
-}
+func (s *Store) SetRole(actorID, userID int64, role model.Role) (model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-func randomHex(n int) (string, error) {
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+	if !s.actorLocked(actorID).canManageUsers() {
+		return model.User{}, ErrUnauthorized
 	}
-	return hex.EncodeToString(b), nil
+	u, ok := s.usersByID[userID]
+	if !ok {
+		return model.User{}, ErrNotFound
+	}
+	return s.setRoleLocked(u, role)
 }
 
-func (s *Store) Register(username, email, password string) (model.User, string, error) {
+// UnlockUser lifts a login lockout and forgets the failures that led to it.
+func (s *Store) UnlockUser(actorID, userID int64) (model.User, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	u := normalize(username)
-	e := normalize(email)
-	if u == "" || e == "" || password == "" {
-		return model.User{}, "", fmt.Errorf("username, email, and password are required")
-	}
-	if _, exists := s.usersByUsername[u]; exists {
-		return model.User{}, "", ErrConflict
+	if !s.actorLocked(actorID).canManageUsers() {
+		return model.User{}, ErrUnauthorized
 	}
-	if _, exists := s.usersByEmail[e]; exists {
-		return model.User{}, "", ErrConflict
+	u, ok := s.usersByID[userID]
+	if !ok {
+		return model.User{}, ErrNotFound
 	}
-
-	s.nextUserID++
-	salt, err := randomHex(16)
-	if err != nil {
-		return model.User{}, "", err
+	if !clearLoginFailures(&u) {
+		return u, nil
 	}
-	user := model.User{
-		ID:           s.nextUserID,
-		Username:     strings.TrimSpace(username),
-		Email:        strings.TrimSpace(email),
-		PasswordSalt: salt,
-		PasswordHash: hashPassword(salt, password),
-		CreatedAt:    time.Now().UTC(),
+	if err := s.commitLocked(putUser(u)); err != nil {
+		return model.User{}, err
 	}
-	s.usersByID[user.ID] = user
-	s.usersByEmail[e] = user.ID
-	s.usersByUsername[u] = user.ID
+	return u, nil
+}
 
-	token, err := randomHex(32)
-	if err != nil {
-		return model.User{}, "", err
+func (s *Store) DeleteUser(actorID, userID int64, novels NovelDisposition, transferTo int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.actorLocked(actorID).canManageUsers() {
+		return ErrUnauthorized
 	}
-	s.sessions[token] = user.ID
-	if err := s.persistLocked(); err != nil {
-		return model.User{}, "", err
+	if actorID == userID {
+		return errDeleteSelf
 	}
-	return user, token, nil
+	u, ok := s.usersByID[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	return s.deleteUserLocked(u, AccountDeletion{Novels: novels, TransferTo: transferTo})
 }
 
-func (s *Store) Login(email, password string) (model.User, string, error) {
+// AssignRole changes a user's role without an authorization check. It is
+// meant for operators, e.g. to appoint the first admin.
+func (s *Store) AssignRole(email string, role model.Role) (model.User, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	uid, ok := s.usersByEmail[normalize(email)]
 	if !ok {
-		return model.User{}, "", ErrUnauthorized
+		return model.User{}, ErrNotFound
 	}
-	user := s.usersByID[uid]
-	if user.PasswordHash != hashPassword(user.PasswordSalt, password) {
-		return model.User{}, "", ErrUnauthorized
+	return s.setRoleLocked(s.usersByID[uid], role)
+}
+
+func (s *Store) setRoleLocked(u model.User, role model.Role) (model.User, error) {
+	if !role.Valid() {
+		return model.User{}, errInvalidRole
 	}
-	token, err := randomHex(32)
-	if err != nil {
-		return model.User{}, "", err
+	if u.Role == role {
+		return u, nil
 	}
-	s.sessions[token] = user.ID
-	if err := s.persistLocked(); err != nil {
-		return model.User{}, "", err
+	if u.Role == model.RoleAdmin && s.adminCountLocked() == 1 {
+		return model.User{}, ErrLastAdmin
 	}
-	return user, token, nil
+	u.Role = role
+	if err := s.commitLocked(putUser(u)); err != nil {
+		return model.User{}, err
+	}
+	return u, nil
 }
 
-func (s *Store) UserByToken(token string) (model.User, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *Store) adminCountLocked() int {
+	admins := 0
+	for _, u := range s.usersByID {
+		if u.Role == model.RoleAdmin {
+			admins++
+		}
+	}
+	return admins
+}
 
-	uid, ok := s.sessions[token]
-	if !ok {
-		return model.User{}, ErrUnauthorized
+func (s *Store) RevokeUserSessions(actorID, userID int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.actorLocked(actorID).canManageUsers() {
+		return 0, ErrUnauthorized
 	}
-	user, ok := s.usersByID[uid]
-	if !ok {
-		return model.User{}, ErrUnauthorized
+	if _, ok := s.usersByID[userID]; !ok {
+		return 0, ErrNotFound
 	}
-	return user, nil
+	var ops []walOp
+	for id, sess := range s.sessionsByID {
+		if sess.UserID == userID {
+			ops = append(ops, delSession(id))
+		}
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+	if err := s.commitLocked(ops...); err != nil {
+		return 0, err
+	}
+	return len(ops), nil
 }
 
-func (s *Store) CreateNovel(authorID int64, title, description, genre string, status model.NovelStatus) (model.Novel, error) {
+func (s *Store) CreateNovel(authorID int64, title, description, genre string, status model.NovelStatus, publishAt *time.Time) (model.Novel, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if !s.actorLocked(authorID).canCreateNovel() {
+		return model.Novel{}, ErrUnauthorized
+	}
 	if status == "" {
 		status = model.NovelDraft
 	}
-	if status != model.NovelDraft && status != model.NovelPublished {
-		return model.Novel{}, fmt.Errorf("invalid status")
-	}
 	if strings.TrimSpace(title) == "" {
 		return model.Novel{}, fmt.Errorf("title is required")
 	}
-	s.nextNovelID++
 	now := time.Now().UTC()
 	n := model.Novel{
-		ID:          s.nextNovelID,
 		AuthorID:    authorID,
 		Title:       strings.TrimSpace(title),
 		Description: strings.TrimSpace(description),
 		Genre:       strings.TrimSpace(genre),
-		Status:      status,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
-	s.novelsByID[n.ID] = n
-	if err := s.persistLocked(); err != nil {
+	if err := scheduleNovel(&n, &status, publishAt, now); err != nil {
+		return model.Novel{}, err
+	}
+	s.nextNovelID++
+	n.ID = s.nextNovelID
+	if err := s.commitLocked(putNovel(n)); err != nil {
 		return model.Novel{}, err
 	}
 	return n, nil
 }
 
-func (s *Store) ListNovels(query string, authorID int64, includeDrafts bool, requesterID int64, limit, offset int) []model.Novel {
+func (s *Store) ListNovels(query string, authorID int64, includeDrafts bool, requesterID int64, limit, offset int) ([]model.Novel, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	a := s.actorLocked(requesterID)
 	q := normalize(query)
 	result := make([]model.Novel, 0, len(s.novelsByID))
 	for _, n := range s.novelsByID {
 		if authorID > 0 && n.AuthorID != authorID {
 			continue
 		}
-		if !includeDrafts && n.Status != model.NovelPublished && n.AuthorID != requesterID {
+		if n.Status != model.NovelPublished && !a.owns(n.AuthorID) && !(includeDrafts && a.canReadNovel(n)) {
 			continue
 		}
 		if q != "" {
@@ -228,13 +1445,13 @@ func (s *Store) ListNovels(query string, authorID int64, includeDrafts bool, req
 	sort.Slice(result, func(i, j int) bool { return result[i].UpdatedAt.After(result[j].UpdatedAt) })
 
 	if offset > len(result) {
-		return []model.Novel{}
+		return []model.Novel{}, nil
 	}
 	result = result[offset:]
 	if limit > 0 && limit < len(result) {
 		result = result[:limit]
 	}
-	return result
+	return result, nil
 }
 
 func (s *Store) NovelByID(id int64, requesterID int64) (model.Novel, error) {
@@ -245,13 +1462,13 @@ func (s *Store) NovelByID(id int64, requesterID int64) (model.Novel, error) {
 	if !ok {
 		return model.Novel{}, ErrNotFound
 	}
-	if n.Status != model.NovelPublished && n.AuthorID != requesterID {
+	if !s.actorLocked(requesterID).canReadNovel(n) {
 		return model.Novel{}, ErrUnauthorized
 	}
 	return n, nil
 }
 
-func (s *Store) UpdateNovel(id, requesterID int64, title, description, genre string, status *model.NovelStatus) (model.Novel, error) {
+func (s *Store) UpdateNovel(id, requesterID int64, title, description, genre string, status *model.NovelStatus, publishAt *time.Time) (model.Novel, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -259,7 +1476,7 @@ func (s *Store) UpdateNovel(id, requesterID int64, title, description, genre str
 	if !ok {
 		return model.Novel{}, ErrNotFound
 	}
-	if n.AuthorID != requesterID {
+	if !s.actorLocked(requesterID).canUpdateNovel(n, isTakedown(title, description, genre, status, publishAt)) {
 		return model.Novel{}, ErrUnauthorized
 	}
 	if strings.TrimSpace(title) != "" {
@@ -271,15 +1488,11 @@ func (s *Store) UpdateNovel(id, requesterID int64, title, description, genre str
 	if genre != "" {
 		n.Genre = strings.TrimSpace(genre)
 	}
-	if status != nil {
-		if *status != model.NovelDraft && *status != model.NovelPublished {
-			return model.Novel{}, fmt.Errorf("invalid status")
-		}
-		n.Status = *status
-	}
 	n.UpdatedAt = time.Now().UTC()
-	s.novelsByID[id] = n
-	if err := s.persistLocked(); err != nil {
+	if err := scheduleNovel(&n, status, publishAt, n.UpdatedAt); err != nil {
+		return model.Novel{}, err
+	}
+	if err := s.commitLocked(putNovel(n)); err != nil {
 		return model.Novel{}, err
 	}
 	return n, nil
@@ -293,30 +1506,79 @@ func (s *Store) DeleteNovel(id, requesterID int64) error {
 	if !ok {
 		return ErrNotFound
 	}
-	if n.AuthorID != requesterID {
+	if !s.actorLocked(requesterID).canDeleteNovel(n) {
 		return ErrUnauthorized
 	}
-	delete(s.novelsByID, id)
+	if err := s.commitLocked(s.deleteNovelOpsLocked(id)...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// deleteNovelOpsLocked deletes a novel with its chapters, comments and the
+// bookmarks readers keep in it.
+func (s *Store) deleteNovelOpsLocked(id int64) []walOp {
+	ops := []walOp{delNovel(id)}
 	for _, cid := range s.chapterIDsByNovel[id] {
-		delete(s.chaptersByID, cid)
+		ops = append(ops, delChapter(cid))
 	}
-	delete(s.chapterIDsByNovel, id)
 	for _, cmid := range s.commentIDsByNovel[id] {
-		delete(s.commentsByID, cmid)
+		ops = append(ops, delComment(cmid))
 	}
-	delete(s.commentIDsByNovel, id)
 	for k, b := range s.bookmarks {
 		if b.NovelID == id {
-			delete(s.bookmarks, k)
+			ops = append(ops, delBookmark(k))
 		}
 	}
-	if err := s.persistLocked(); err != nil {
-		return err
+	return ops
+}
+
+func (s *Store) ReleaseDue(now time.Time) ([]model.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now = now.UTC()
+	var events []model.Event
+	released := make(map[int64]model.Novel)
+	for _, n := range s.novelsByID {
+		if n.Status == model.NovelDraft && n.PublishAt != nil && !n.PublishAt.After(now) {
+			events = append(events, novelEvent(n, *n.PublishAt))
+			n.Status, n.PublishAt, n.UpdatedAt = model.NovelPublished, nil, now
+			released[n.ID] = n
+		}
 	}
-	return nil
+	var ops []walOp
+	for _, ch := range s.chaptersByID {
+		if ch.PublishAt == nil || ch.PublishAt.After(now) {
+			continue
+		}
+		n, ok := released[ch.NovelID]
+		if !ok {
+			n = s.novelsByID[ch.NovelID]
+		}
+		if n.Status != model.NovelPublished {
+			continue
+		}
+		events = append(events, chapterEvent(ch, *ch.PublishAt))
+		n.UpdatedAt = now
+		released[n.ID] = n
+		ch.Status, ch.PublishAt = model.ChapterPublished, nil
+		ops = append(ops, putChapter(ch))
+	}
+	for _, n := range released {
+		ops = append(ops, putNovel(n))
+	}
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	if err := s.commitLocked(ops...); err != nil {
+		return nil, err
+	}
+	sortEvents(events)
+	return events, nil
 }
 
-func (s *Store) CreateChapter(novelID, requesterID int64, title, content string, position int) (model.Chapter, error) {
+func (s *Store) CreateChapter(novelID, requesterID int64, title, content string, format model.ContentFormat, position int, status *model.ChapterStatus, publishAt *time.Time) (model.Chapter, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -324,31 +1586,32 @@ func (s *Store) CreateChapter(novelID, requesterID int64, title, content string,
 	if !ok {
 		return model.Chapter{}, ErrNotFound
 	}
-	if n.AuthorID != requesterID {
+	if !s.actorLocked(requesterID).canEditNovel(n) {
 		return model.Chapter{}, ErrUnauthorized
 	}
 	if strings.TrimSpace(title) == "" {
 		return model.Chapter{}, fmt.Errorf("title is required")
 	}
-	s.nextChapterID++
 	now := time.Now().UTC()
-	if position <= 0 {
-		position = len(s.chapterIDsByNovel[novelID]) + 1
-	}
 	ch := model.Chapter{
-		ID:        s.nextChapterID,
 		NovelID:   novelID,
 		Title:     strings.TrimSpace(title),
 		Content:   content,
-		Position:  position,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
-	s.chaptersByID[ch.ID] = ch
-	s.chapterIDsByNovel[novelID] = append(s.chapterIDsByNovel[novelID], ch.ID)
+	if err := setFormat(&ch, format); err != nil {
+		return model.Chapter{}, err
+	}
+	if err := scheduleChapter(&ch, status, publishAt, now); err != nil {
+		return model.Chapter{}, err
+	}
+	s.nextChapterID++
+	ch.ID = s.nextChapterID
+	chs := placeChapter(s.chaptersLocked(novelID), &ch, position)
 	n.UpdatedAt = now
-	s.novelsByID[novelID] = n
-	if err := s.persistLocked(); err != nil {
+	ops := append([]walOp{putChapter(ch), putRevision(newRevision(ch, 1, requesterID, now)), putNovel(n)}, s.positionOpsLocked(novelID, chs, ch.ID)...)
+	if err := s.commitLocked(ops...); err != nil {
 		return model.Chapter{}, err
 	}
 	return ch, nil
@@ -362,31 +1625,42 @@ func (s *Store) ListChapters(novelID, requesterID int64) ([]model.Chapter, error
 	if !ok {
 		return nil, ErrNotFound
 	}
-	if n.Status != model.NovelPublished && n.AuthorID != requesterID {
+	a := s.actorLocked(requesterID)
+	if !a.canReadNovel(n) {
 		return nil, ErrUnauthorized
 	}
-	res := make([]model.Chapter, 0, len(s.chapterIDsByNovel[novelID]))
-	for _, id := range s.chapterIDsByNovel[novelID] {
-		res = append(res, s.chaptersByID[id])
-	}
-	sort.Slice(res, func(i, j int) bool { return res[i].Position < res[j].Position })
-	return res, nil
+	return a.listChapters(n, s.chaptersLocked(novelID)), nil
 }
 
 func (s *Store) ChapterByID(novelID, chapterID, requesterID int64) (model.Chapter, error) {
-	chapters, err := s.ListChapters(novelID, requesterID)
-	if err != nil {
-		return model.Chapter{}, err
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.novelsByID[novelID]
+	if !ok {
+		return model.Chapter{}, ErrNotFound
 	}
-	for _, ch := range chapters {
-		if ch.ID == chapterID {
-			return ch, nil
-		}
+	a := s.actorLocked(requesterID)
+	if !a.canReadNovel(n) {
+		return model.Chapter{}, ErrUnauthorized
+	}
+	ch, ok := s.chaptersByID[chapterID]
+	if !ok || ch.NovelID != novelID || !a.canReadChapter(n, ch) {
+		return model.Chapter{}, ErrNotFound
+	}
+	return a.chapterAsSeen(n, s.chaptersLocked(novelID), ch), nil
+}
+
+// chaptersLocked returns the chapters of a novel in no particular order.
+func (s *Store) chaptersLocked(novelID int64) []model.Chapter {
+	chs := make([]model.Chapter, 0, len(s.chapterIDsByNovel[novelID]))
+	for _, id := range s.chapterIDsByNovel[novelID] {
+		chs = append(chs, s.chaptersByID[id])
 	}
-	return model.Chapter{}, ErrNotFound
+	return chs
 }
 
-func (s *Store) UpdateChapter(novelID, chapterID, requesterID int64, title, content string, position int) (model.Chapter, error) {
+func (s *Store) UpdateChapter(novelID, chapterID, requesterID int64, title, content string, format model.ContentFormat, position int, status *model.ChapterStatus, publishAt *time.Time) (model.Chapter, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -394,27 +1668,43 @@ func (s *Store) UpdateChapter(novelID, chapterID, requesterID int64, title, cont
 	if !ok {
 		return model.Chapter{}, ErrNotFound
 	}
-	if n.AuthorID != requesterID {
+	if !s.actorLocked(requesterID).canUpdateNovel(n, isChapterTakedown(title, content, format, position, status, publishAt)) {
 		return model.Chapter{}, ErrUnauthorized
 	}
 	ch, ok := s.chaptersByID[chapterID]
 	if !ok || ch.NovelID != novelID {
 		return model.Chapter{}, ErrNotFound
 	}
+	old := ch
 	if strings.TrimSpace(title) != "" {
 		ch.Title = strings.TrimSpace(title)
 	}
 	if content != "" {
 		ch.Content = content
 	}
-	if position > 0 {
-		ch.Position = position
+	if err := setFormat(&ch, format); err != nil {
+		return model.Chapter{}, err
 	}
 	ch.UpdatedAt = time.Now().UTC()
-	s.chaptersByID[chapterID] = ch
+	if err := scheduleChapter(&ch, status, publishAt, ch.UpdatedAt); err != nil {
+		return model.Chapter{}, err
+	}
+	chs := s.chaptersLocked(novelID)
+	if position > 0 {
+		chs = placeChapter(chs, &ch, position)
+	}
 	n.UpdatedAt = ch.UpdatedAt
-	s.novelsByID[novelID] = n
-	if err := s.persistLocked(); err != nil {
+	ops := []walOp{putChapter(ch), putNovel(n)}
+	if ch.Content != old.Content {
+		ops = append(ops, s.revisionOpsLocked(old, ch, n, requesterID, nil)...)
+	}
+	if position > 0 {
+		ops = append(ops, s.positionOpsLocked(novelID, chs, ch.ID)...)
+	}
+	if old.Status != model.ChapterDraft && ch.Status == model.ChapterDraft {
+		ops = append(ops, s.unpublishOpsLocked(n, chs, ch)...)
+	}
+	if err := s.commitLocked(ops...); err != nil {
 		return model.Chapter{}, err
 	}
 	return ch, nil
@@ -428,34 +1718,200 @@ func (s *Store) DeleteChapter(novelID, chapterID, requesterID int64) error {
 	if !ok {
 		return ErrNotFound
 	}
-	if n.AuthorID != requesterID {
+	if !s.actorLocked(requesterID).canDeleteChapter(n) {
 		return ErrUnauthorized
 	}
 	ch, ok := s.chaptersByID[chapterID]
 	if !ok || ch.NovelID != novelID {
 		return ErrNotFound
 	}
-	delete(s.chaptersByID, chapterID)
-	ids := s.chapterIDsByNovel[novelID]
-	for i := range ids {
-		if ids[i] == chapterID {
-			s.chapterIDsByNovel[novelID] = append(ids[:i], ids[i+1:]...)
-			break
-		}
-	}
-	for k, b := range s.bookmarks {
+	ops := []walOp{delChapter(chapterID)}
+	for _, b := range s.bookmarks {
 		if b.NovelID == novelID && b.ChapterID != nil && *b.ChapterID == chapterID {
 			b.ChapterID = nil
 			b.ChapterPos = nil
-			s.bookmarks[k] = b
+			ops = append(ops, putBookmark(b))
 		}
 	}
-	if err := s.persistLocked(); err != nil {
+	ops = append(ops, s.positionOpsLocked(novelID, removeChapter(s.chaptersLocked(novelID), ch), 0)...)
+	if err := s.commitLocked(ops...); err != nil {
 		return err
 	}
 	return nil
 }
 
+func (s *Store) ReorderChapters(novelID, requesterID int64, chapterIDs []int64) ([]model.Chapter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.novelsByID[novelID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	a := s.actorLocked(requesterID)
+	if !a.canEditNovel(n) {
+		return nil, ErrUnauthorized
+	}
+	chs, err := reorderChapters(s.chaptersLocked(novelID), chapterIDs)
+	if err != nil {
+		return nil, err
+	}
+	n.UpdatedAt = time.Now().UTC()
+	ops := append([]walOp{putNovel(n)}, s.positionOpsLocked(novelID, chs, 0)...)
+	if err := s.commitLocked(ops...); err != nil {
+		return nil, err
+	}
+	return a.listChapters(n, chs), nil
+}
+
+// positionOpsLocked saves the positions of chs, the chapters of a novel
+// numbered afresh, where they changed, and the positions kept in bookmarks on
+// them. The chapter with ID except is saved by the caller.
+func (s *Store) positionOpsLocked(novelID int64, chs []model.Chapter, except int64) []walOp {
+	var ops []walOp
+	positions := make(map[int64]int, len(chs))
+	for _, ch := range chs {
+		positions[ch.ID] = ch.Position
+		if old := s.chaptersByID[ch.ID]; ch.ID != except && old.Position != ch.Position {
+			old.Position = ch.Position
+			ops = append(ops, putChapter(old))
+		}
+	}
+	for _, b := range s.bookmarks {
+		if b.NovelID != novelID || b.ChapterID == nil {
+			continue
+		}
+		if pos, ok := positions[*b.ChapterID]; ok && (b.ChapterPos == nil || *b.ChapterPos != pos) {
+			b.ChapterPos = &pos
+			ops = append(ops, putBookmark(b))
+		}
+	}
+	return ops
+}
+
+// unpublishOpsLocked moves the bookmarks on ch, just made a draft, that their
+// owners can no longer open back to the last published chapter before it
+// among chs.
+func (s *Store) unpublishOpsLocked(n model.Novel, chs []model.Chapter, ch model.Chapter) []walOp {
+	to := fallbackChapter(chs, ch)
+	var ops []walOp
+	for _, b := range s.bookmarks {
+		if b.NovelID != n.ID || b.ChapterID == nil || *b.ChapterID != ch.ID || s.actorLocked(b.UserID).canReadChapter(n, ch) {
+			continue
+		}
+		b.ChapterID, b.ChapterPos = nil, nil
+		if to != nil {
+			id, pos := to.ID, to.Position
+			b.ChapterID, b.ChapterPos = &id, &pos
+		}
+		ops = append(ops, putBookmark(b))
+	}
+	return ops
+}
+
+// revisionsLocked returns the history of ch, oldest first.
+func (s *Store) revisionsLocked(ch model.Chapter, n model.Novel) []model.Revision {
+	if revs := s.revisions[ch.ID]; len(revs) > 0 {
+		return revs
+	}
+	return []model.Revision{baselineRevision(ch, n)}
+}
+
+// revisionOpsLocked records the content of ch, changed from old by authorID,
+// as its next revision.
+func (s *Store) revisionOpsLocked(old, ch model.Chapter, n model.Novel, authorID int64, restoredFrom *int) []walOp {
+	var ops []walOp
+	revs := s.revisions[ch.ID]
+	if len(revs) == 0 {
+		revs = []model.Revision{baselineRevision(old, n)}
+		ops = append(ops, putRevision(revs[0]))
+	}
+	r := newRevision(ch, revs[len(revs)-1].Number+1, authorID, ch.UpdatedAt)
+	r.RestoredFrom = restoredFrom
+	return append(ops, putRevision(r))
+}
+
+// revisionChapterLocked finds a chapter whose history requesterID may read.
+func (s *Store) revisionChapterLocked(novelID, chapterID, requesterID int64) (model.Chapter, model.Novel, error) {
+	n, ok := s.novelsByID[novelID]
+	if !ok {
+		return model.Chapter{}, model.Novel{}, ErrNotFound
+	}
+	if !s.actorLocked(requesterID).canReadUnreleased(n) {
+		return model.Chapter{}, model.Novel{}, ErrUnauthorized
+	}
+	ch, ok := s.chaptersByID[chapterID]
+	if !ok || ch.NovelID != novelID {
+		return model.Chapter{}, model.Novel{}, ErrNotFound
+	}
+	return ch, n, nil
+}
+
+func (s *Store) ListRevisions(novelID, chapterID, requesterID int64) ([]model.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ch, n, err := s.revisionChapterLocked(novelID, chapterID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	revs := s.revisionsLocked(ch, n)
+	res := make([]model.Revision, 0, len(revs))
+	for i := len(revs) - 1; i >= 0; i-- {
+		r := revs[i]
+		r.Content = ""
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func (s *Store) RevisionByNumber(novelID, chapterID, requesterID int64, number int) (model.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ch, n, err := s.revisionChapterLocked(novelID, chapterID, requesterID)
+	if err != nil {
+		return model.Revision{}, err
+	}
+	for _, r := range s.revisionsLocked(ch, n) {
+		if r.Number == number {
+			return r, nil
+		}
+	}
+	return model.Revision{}, ErrNotFound
+}
+
+func (s *Store) RestoreRevision(novelID, chapterID, requesterID int64, number int) (model.Chapter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.novelsByID[novelID]
+	if !ok {
+		return model.Chapter{}, ErrNotFound
+	}
+	if !s.actorLocked(requesterID).canEditNovel(n) {
+		return model.Chapter{}, ErrUnauthorized
+	}
+	ch, ok := s.chaptersByID[chapterID]
+	if !ok || ch.NovelID != novelID {
+		return model.Chapter{}, ErrNotFound
+	}
+	revs := s.revisionsLocked(ch, n)
+	i := slices.IndexFunc(revs, func(r model.Revision) bool { return r.Number == number })
+	if i < 0 {
+		return model.Chapter{}, ErrNotFound
+	}
+	old := ch
+	ch.Content = revs[i].Content
+	ch.UpdatedAt = time.Now().UTC()
+	n.UpdatedAt = ch.UpdatedAt
+	ops := append([]walOp{putChapter(ch), putNovel(n)}, s.revisionOpsLocked(old, ch, n, requesterID, &number)...)
+	if err := s.commitLocked(ops...); err != nil {
+		return model.Chapter{}, err
+	}
+	return ch, nil
+}
+
 func (s *Store) CreateComment(novelID int64, chapterID *int64, userID int64, body string) (model.Comment, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -467,12 +1923,13 @@ func (s *Store) CreateComment(novelID int64, chapterID *int64, userID int64, bod
 	if !ok {
 		return model.Comment{}, ErrNotFound
 	}
-	if n.Status != model.NovelPublished && n.AuthorID != userID {
+	a := s.actorLocked(userID)
+	if !a.canReadNovel(n) {
 		return model.Comment{}, ErrUnauthorized
 	}
 	if chapterID != nil {
 		ch, ok := s.chaptersByID[*chapterID]
-		if !ok || ch.NovelID != novelID {
+		if !ok || ch.NovelID != novelID || !a.canReadChapter(n, ch) {
 			return model.Comment{}, ErrNotFound
 		}
 	}
@@ -485,9 +1942,7 @@ func (s *Store) CreateComment(novelID int64, chapterID *int64, userID int64, bod
 		Body:      strings.TrimSpace(body),
 		CreatedAt: time.Now().UTC(),
 	}
-	s.commentsByID[cm.ID] = cm
-	s.commentIDsByNovel[novelID] = append(s.commentIDsByNovel[novelID], cm.ID)
-	if err := s.persistLocked(); err != nil {
+	if err := s.commitLocked(putComment(cm)); err != nil {
 		return model.Comment{}, err
 	}
 	return cm, nil
@@ -501,7 +1956,8 @@ func (s *Store) ListComments(novelID, requesterID int64, chapterID *int64) ([]mo
 	if !ok {
 		return nil, ErrNotFound
 	}
-	if n.Status != model.NovelPublished && n.AuthorID != requesterID {
+	a := s.actorLocked(requesterID)
+	if !a.canReadNovel(n) {
 		return nil, ErrUnauthorized
 	}
 	res := make([]model.Comment, 0, len(s.commentIDsByNovel[novelID]))
@@ -512,12 +1968,29 @@ func (s *Store) ListComments(novelID, requesterID int64, chapterID *int64) ([]mo
 				continue
 			}
 		}
+		if c.ChapterID != nil && !a.canReadChapter(n, s.chaptersByID[*c.ChapterID]) {
+			continue
+		}
 		res = append(res, c)
 	}
 	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.Before(res[j].CreatedAt) })
 	return res, nil
 }
 
+func (s *Store) DeleteComment(novelID, commentID, requesterID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.commentsByID[commentID]
+	if !ok || c.NovelID != novelID {
+		return ErrNotFound
+	}
+	if !s.actorLocked(requesterID).canDeleteComment(c) {
+		return ErrUnauthorized
+	}
+	return s.commitLocked(delComment(commentID))
+}
+
 func bookmarkKey(userID, novelID int64) string {
 	return fmt.Sprintf("%d:%d", userID, novelID)
 }
@@ -530,13 +2003,14 @@ func (s *Store) UpsertBookmark(userID, novelID int64, chapterID *int64) (model.B
 	if !ok {
 		return model.Bookmark{}, ErrNotFound
 	}
-	if n.Status != model.NovelPublished && n.AuthorID != userID {
+	a := s.actorLocked(userID)
+	if !a.canReadNovel(n) {
 		return model.Bookmark{}, ErrUnauthorized
 	}
 	var pos *int
 	if chapterID != nil {
 		ch, ok := s.chaptersByID[*chapterID]
-		if !ok || ch.NovelID != novelID {
+		if !ok || ch.NovelID != novelID || !a.canReadChapter(n, ch) {
 			return model.Bookmark{}, ErrNotFound
 		}
 		cp := ch.Position
@@ -549,23 +2023,38 @@ func (s *Store) UpsertBookmark(userID, novelID int64, chapterID *int64) (model.B
 		UpdatedAt:  time.Now().UTC(),
 		ChapterPos: pos,
 	}
-	s.bookmarks[bookmarkKey(userID, novelID)] = b
-	if err := s.persistLocked(); err != nil {
+	if err := s.commitLocked(putBookmark(b)); err != nil {
 		return model.Bookmark{}, err
 	}
-	return b, nil
+	return s.bookmarkAsSeenLocked(a, b), nil
 }
 
-func (s *Store) MyBookmarks(userID int64) []model.Bookmark {
+func (s *Store) MyBookmarks(userID int64) ([]model.Bookmark, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	a := s.actorLocked(userID)
 	res := make([]model.Bookmark, 0)
 	for _, b := range s.bookmarks {
 		if b.UserID == userID {
-			res = append(res, b)
+			res = append(res, s.bookmarkAsSeenLocked(a, b))
 		}
 	}
 	sort.Slice(res, func(i, j int) bool { return res[i].UpdatedAt.After(res[j].UpdatedAt) })
-	return res
+	return res, nil
+}
+
+// bookmarkAsSeenLocked gives b the position of its chapter as its owner, a,
+// sees it.
+func (s *Store) bookmarkAsSeenLocked(a actor, b model.Bookmark) model.Bookmark {
+	if b.ChapterID == nil {
+		return b
+	}
+	ch, ok := s.chaptersByID[*b.ChapterID]
+	if !ok {
+		return b
+	}
+	ch = a.chapterAsSeen(s.novelsByID[b.NovelID], s.chaptersLocked(b.NovelID), ch)
+	b.ChapterPos = &ch.Position
+	return b
 }
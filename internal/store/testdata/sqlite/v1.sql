@@ -0,0 +1,74 @@
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE users (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				username      TEXT NOT NULL,
+				username_norm TEXT NOT NULL UNIQUE,
+				email         TEXT NOT NULL,
+				email_norm    TEXT NOT NULL,
+				password_salt TEXT NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL
+			);
+INSERT INTO users VALUES(1,'ada','ada','ada@example.com','ada@example.com','8d7a642aa68ea8344fa2895808db862b','5eae63253075368e355ddf1c80980e0f568838192cb7faaa280eca4bd2dc5bbb','2026-10-16 15:41:59.209894101+00:00');
+INSERT INTO users VALUES(2,'bo','bo','bo@example.com','bo@example.com','37a7e412562717489b93f0f995954678','088e85c017ac9a486500de68dadd937c4978b26b3c4486df78682e81e5e2a90c','2026-10-16 15:41:59.212122884+00:00');
+CREATE TABLE sessions (
+				token   TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE
+			);
+INSERT INTO sessions VALUES('e020481f39d6000d82ad596fece4d980f205a78801ea7828d8ebbafa69f56d9c',1);
+INSERT INTO sessions VALUES('d5621702fe6eaae86793d2669fe2024505cc714da0001295a9f1cb4edf829874',2);
+CREATE TABLE novels (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				author_id   INTEGER NOT NULL REFERENCES users (id),
+				title       TEXT NOT NULL,
+				description TEXT NOT NULL,
+				genre       TEXT NOT NULL,
+				status      TEXT NOT NULL,
+				created_at  TIMESTAMP NOT NULL,
+				updated_at  TIMESTAMP NOT NULL
+			);
+INSERT INTO novels VALUES(1,1,'Novel','About it','drama','published','2026-10-16 15:41:59.210681087+00:00','2026-10-16 15:41:59.213149126+00:00');
+CREATE TABLE chapters (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				title      TEXT NOT NULL,
+				content    TEXT NOT NULL,
+				position   INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			);
+INSERT INTO chapters VALUES(1,1,'One','First chapter, revised.',1,'2026-10-16 15:41:59.211288626+00:00','2026-10-16 15:41:59.213149126+00:00');
+INSERT INTO chapters VALUES(2,1,'Two','Second chapter.',2,'2026-10-16 15:41:59.212662088+00:00','2026-10-16 15:41:59.212662088+00:00');
+CREATE TABLE comments (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id INTEGER,
+				user_id    INTEGER NOT NULL REFERENCES users (id),
+				body       TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);
+INSERT INTO comments VALUES(1,1,1,1,'First!','2026-10-16 15:41:59.211851212+00:00');
+INSERT INTO comments VALUES(2,1,NULL,2,'Hello','2026-10-16 15:41:59.213493675+00:00');
+CREATE TABLE bookmarks (
+				user_id     INTEGER NOT NULL REFERENCES users (id),
+				novel_id    INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id  INTEGER,
+				chapter_pos INTEGER,
+				updated_at  TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, novel_id)
+			);
+INSERT INTO bookmarks VALUES(2,1,1,1,'2026-10-16 15:41:59.213914697+00:00');
+INSERT INTO sqlite_sequence VALUES('users',2);
+INSERT INTO sqlite_sequence VALUES('novels',1);
+INSERT INTO sqlite_sequence VALUES('chapters',2);
+INSERT INTO sqlite_sequence VALUES('comments',2);
+CREATE UNIQUE INDEX users_email ON users (email_norm);
+CREATE INDEX sessions_user_id ON sessions (user_id);
+CREATE INDEX novels_author_id ON novels (author_id);
+CREATE INDEX novels_updated_at ON novels (updated_at);
+CREATE INDEX chapters_novel_id ON chapters (novel_id, position);
+CREATE INDEX comments_novel_id ON comments (novel_id, created_at);
+CREATE INDEX bookmarks_novel_id ON bookmarks (novel_id);
+COMMIT;
+PRAGMA user_version = 1;
@@ -0,0 +1,133 @@
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE users (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				username      TEXT NOT NULL,
+				username_norm TEXT NOT NULL UNIQUE,
+				email         TEXT NOT NULL,
+				email_norm    TEXT NOT NULL,
+				password_salt TEXT NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL
+			, email_verified_at TIMESTAMP, totp_secret TEXT NOT NULL DEFAULT '', totp_pending TEXT NOT NULL DEFAULT '', totp_last_step INTEGER NOT NULL DEFAULT 0, recovery_codes TEXT NOT NULL DEFAULT '', role TEXT NOT NULL DEFAULT 'author', failed_logins INTEGER NOT NULL DEFAULT 0, last_failed_login TIMESTAMP, locked_until TIMESTAMP);
+INSERT INTO users VALUES(1,'ada','ada','ada@example.com','ada@example.com','','$argon2id$v=19$m=65536,t=3,p=2$/4Rn80fE8MiLC596T3TFXg$kiOpPsucDeUyXywwD4OO+JsWH8B02edPAMYgOAxkKUM','2026-10-16 15:42:16.616109194+00:00',NULL,'','',0,'','author',0,NULL,NULL);
+INSERT INTO users VALUES(2,'bo','bo','bo@example.com','bo@example.com','','$argon2id$v=19$m=65536,t=3,p=2$ReBYYK936SiZx+6NUrSCpQ$iOYcXA33bWIAC0GBhw7WPpMxZ46VxQPSTcVWOMJG7dM','2026-10-16 15:42:16.759763228+00:00',NULL,'','',0,'','author',0,NULL,NULL);
+CREATE TABLE novels (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				author_id   INTEGER NOT NULL REFERENCES users (id),
+				title       TEXT NOT NULL,
+				description TEXT NOT NULL,
+				genre       TEXT NOT NULL,
+				status      TEXT NOT NULL,
+				created_at  TIMESTAMP NOT NULL,
+				updated_at  TIMESTAMP NOT NULL
+			);
+INSERT INTO novels VALUES(1,1,'Novel','About it','drama','published','2026-10-16 15:42:16.617046265+00:00','2026-10-16 15:42:16.761025476+00:00');
+CREATE TABLE chapters (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				title      TEXT NOT NULL,
+				content    TEXT NOT NULL,
+				position   INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			);
+INSERT INTO chapters VALUES(1,1,'One','First chapter, revised.',1,'2026-10-16 15:42:16.617374967+00:00','2026-10-16 15:42:16.761025476+00:00');
+INSERT INTO chapters VALUES(2,1,'Two','Second chapter.',2,'2026-10-16 15:42:16.760682728+00:00','2026-10-16 15:42:16.760682728+00:00');
+CREATE TABLE comments (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id INTEGER,
+				user_id    INTEGER NOT NULL REFERENCES users (id),
+				body       TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);
+INSERT INTO comments VALUES(1,1,1,1,'First!','2026-10-16 15:42:16.617726163+00:00');
+INSERT INTO comments VALUES(2,1,NULL,2,'Hello','2026-10-16 15:42:16.761346604+00:00');
+CREATE TABLE bookmarks (
+				user_id     INTEGER NOT NULL REFERENCES users (id),
+				novel_id    INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id  INTEGER,
+				chapter_pos INTEGER,
+				updated_at  TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, novel_id)
+			);
+INSERT INTO bookmarks VALUES(2,1,1,1,'2026-10-16 15:42:16.761604199+00:00');
+CREATE TABLE sessions (
+			id           TEXT PRIMARY KEY,
+			user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			token_hash   TEXT NOT NULL UNIQUE,
+			device       TEXT NOT NULL,
+			user_agent   TEXT NOT NULL,
+			created_at   TIMESTAMP NOT NULL,
+			last_seen_at TIMESTAMP NOT NULL,
+			expires_at   TIMESTAMP NOT NULL
+		, access_expires_at TIMESTAMP NOT NULL DEFAULT '');
+INSERT INTO sessions VALUES('68db879b956dbfa4',1,'b1cb0b5e698a641b3dab1cd6a8a9be6d699c5fc1b652c58e42517e05b2fa3658','','','2026-10-16 15:42:16.616429498+00:00','2026-10-16 15:42:16.616429498+00:00','2026-11-15 15:42:16.616429498+00:00','2026-10-16 15:57:16.616429498+00:00');
+INSERT INTO sessions VALUES('93cd4e06b4b0759a',2,'65d1377edf697a6bcb9f590b815b4d0a6e1d8e87ea381c156ef7bedb06a70b30','','','2026-10-16 15:42:16.76007964+00:00','2026-10-16 15:42:16.76007964+00:00','2026-11-15 15:42:16.76007964+00:00','2026-10-16 15:57:16.76007964+00:00');
+CREATE TABLE refresh_tokens (
+				token_hash TEXT PRIMARY KEY,
+				session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL,
+				used_at    TIMESTAMP
+			);
+INSERT INTO refresh_tokens VALUES('6dc1ab25f68a31ef71c44f323151ca44462c3c6cc8c74ad4c31576a94d26ad29','68db879b956dbfa4','2026-10-16 15:42:16.616429498+00:00',NULL);
+INSERT INTO refresh_tokens VALUES('3ed445059223d6cb205aeb473daa9efbf269095a3973f8c94850ba0ee9af4992','93cd4e06b4b0759a','2026-10-16 15:42:16.76007964+00:00',NULL);
+CREATE TABLE user_tokens (
+				token_hash TEXT PRIMARY KEY,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				purpose    TEXT NOT NULL,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL
+			, attempts INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE outbox (
+				id              INTEGER PRIMARY KEY AUTOINCREMENT,
+				recipient       TEXT NOT NULL,
+				subject         TEXT NOT NULL,
+				body            TEXT NOT NULL,
+				status          TEXT NOT NULL,
+				attempts        INTEGER NOT NULL,
+				last_error      TEXT NOT NULL,
+				next_attempt_at TIMESTAMP NOT NULL,
+				created_at      TIMESTAMP NOT NULL,
+				sent_at         TIMESTAMP
+			);
+CREATE TABLE identities (
+				provider   TEXT NOT NULL,
+				subject    TEXT NOT NULL,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (provider, subject)
+			);
+CREATE TABLE api_keys (
+				id           TEXT PRIMARY KEY,
+				user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				name         TEXT NOT NULL,
+				prefix       TEXT NOT NULL,
+				token_hash   TEXT NOT NULL UNIQUE,
+				scopes       TEXT NOT NULL,
+				created_at   TIMESTAMP NOT NULL,
+				expires_at   TIMESTAMP,
+				last_used_at TIMESTAMP
+			);
+INSERT INTO sqlite_sequence VALUES('users',2);
+INSERT INTO sqlite_sequence VALUES('novels',1);
+INSERT INTO sqlite_sequence VALUES('chapters',2);
+INSERT INTO sqlite_sequence VALUES('comments',2);
+CREATE UNIQUE INDEX users_email ON users (email_norm);
+CREATE INDEX novels_author_id ON novels (author_id);
+CREATE INDEX novels_updated_at ON novels (updated_at);
+CREATE INDEX chapters_novel_id ON chapters (novel_id, position);
+CREATE INDEX comments_novel_id ON comments (novel_id, created_at);
+CREATE INDEX bookmarks_novel_id ON bookmarks (novel_id);
+CREATE INDEX sessions_user_id ON sessions (user_id);
+CREATE INDEX sessions_expires_at ON sessions (expires_at);
+CREATE INDEX refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE INDEX user_tokens_user_id ON user_tokens (user_id, purpose);
+CREATE INDEX outbox_due ON outbox (status, next_attempt_at);
+CREATE INDEX identities_user_id ON identities (user_id);
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
+COMMIT;
+PRAGMA user_version = 10;
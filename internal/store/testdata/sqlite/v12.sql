@@ -0,0 +1,134 @@
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE users (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				username      TEXT NOT NULL,
+				username_norm TEXT NOT NULL UNIQUE,
+				email         TEXT NOT NULL,
+				email_norm    TEXT NOT NULL,
+				password_salt TEXT NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL
+			, email_verified_at TIMESTAMP, totp_secret TEXT NOT NULL DEFAULT '', totp_pending TEXT NOT NULL DEFAULT '', totp_last_step INTEGER NOT NULL DEFAULT 0, recovery_codes TEXT NOT NULL DEFAULT '', role TEXT NOT NULL DEFAULT 'author', failed_logins INTEGER NOT NULL DEFAULT 0, last_failed_login TIMESTAMP, locked_until TIMESTAMP, display_name TEXT NOT NULL DEFAULT '', bio TEXT NOT NULL DEFAULT '', avatar_url TEXT NOT NULL DEFAULT '');
+INSERT INTO users VALUES(1,'ada','ada','ada@example.com','ada@example.com','','$argon2id$v=19$m=65536,t=3,p=2$IY9UAp+s1uwV/a8j2G+wEQ$xZOQSD41nIxgvt/bnfx3G1vuL/lCPmv1mWglyV+I4fo','2026-10-16 15:42:21.946696413+00:00',NULL,'','',0,'','author',0,NULL,NULL,'','','');
+INSERT INTO users VALUES(2,'bo','bo','bo@example.com','bo@example.com','','$argon2id$v=19$m=65536,t=3,p=2$PTj7tHlC2h9RHvPVecNbbw$/Hq2HSEUOt6wSBUCQPe0F046z0kNevHoe3P7xAE06XY','2026-10-16 15:42:22.117708608+00:00',NULL,'','',0,'','author',0,NULL,NULL,'','','');
+CREATE TABLE novels (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				author_id   INTEGER NOT NULL REFERENCES users (id),
+				title       TEXT NOT NULL,
+				description TEXT NOT NULL,
+				genre       TEXT NOT NULL,
+				status      TEXT NOT NULL,
+				created_at  TIMESTAMP NOT NULL,
+				updated_at  TIMESTAMP NOT NULL
+			);
+INSERT INTO novels VALUES(1,1,'Novel','About it','drama','published','2026-10-16 15:42:21.947537282+00:00','2026-10-16 15:42:22.118895381+00:00');
+CREATE TABLE chapters (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				title      TEXT NOT NULL,
+				content    TEXT NOT NULL,
+				position   INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			);
+INSERT INTO chapters VALUES(1,1,'One','First chapter, revised.',1,'2026-10-16 15:42:21.947829718+00:00','2026-10-16 15:42:22.118895381+00:00');
+INSERT INTO chapters VALUES(2,1,'Two','Second chapter.',2,'2026-10-16 15:42:22.118550958+00:00','2026-10-16 15:42:22.118550958+00:00');
+CREATE TABLE bookmarks (
+				user_id     INTEGER NOT NULL REFERENCES users (id),
+				novel_id    INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id  INTEGER,
+				chapter_pos INTEGER,
+				updated_at  TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, novel_id)
+			);
+INSERT INTO bookmarks VALUES(2,1,1,1,'2026-10-16 15:42:22.119380908+00:00');
+CREATE TABLE sessions (
+			id           TEXT PRIMARY KEY,
+			user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			token_hash   TEXT NOT NULL UNIQUE,
+			device       TEXT NOT NULL,
+			user_agent   TEXT NOT NULL,
+			created_at   TIMESTAMP NOT NULL,
+			last_seen_at TIMESTAMP NOT NULL,
+			expires_at   TIMESTAMP NOT NULL
+		, access_expires_at TIMESTAMP NOT NULL DEFAULT '');
+INSERT INTO sessions VALUES('6a266b05d69142c2',1,'8629c8fe90a5d132eb1617af68fb525b9de42d97ce13d92b1acdfb43b92efbb1','','','2026-10-16 15:42:21.94697949+00:00','2026-10-16 15:42:21.94697949+00:00','2026-11-15 15:42:21.94697949+00:00','2026-10-16 15:57:21.94697949+00:00');
+INSERT INTO sessions VALUES('a61c84af84fae33c',2,'e388a17d5151eb80632ffd736ce0f10c9c55511be2d1e2a9802acd9838bc45c6','','','2026-10-16 15:42:22.11797946+00:00','2026-10-16 15:42:22.11797946+00:00','2026-11-15 15:42:22.11797946+00:00','2026-10-16 15:57:22.11797946+00:00');
+CREATE TABLE refresh_tokens (
+				token_hash TEXT PRIMARY KEY,
+				session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL,
+				used_at    TIMESTAMP
+			);
+INSERT INTO refresh_tokens VALUES('76dbb4224d011b56d14b2703043bb1d5b2dc0150f7bc5a4ecf046f6fac82bae4','6a266b05d69142c2','2026-10-16 15:42:21.94697949+00:00',NULL);
+INSERT INTO refresh_tokens VALUES('55317fb043b51e67b92dd649f34ce86b8c38f34695b5c76e0d20d021a699051f','a61c84af84fae33c','2026-10-16 15:42:22.11797946+00:00',NULL);
+CREATE TABLE user_tokens (
+				token_hash TEXT PRIMARY KEY,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				purpose    TEXT NOT NULL,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL
+			, attempts INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE outbox (
+				id              INTEGER PRIMARY KEY AUTOINCREMENT,
+				recipient       TEXT NOT NULL,
+				subject         TEXT NOT NULL,
+				body            TEXT NOT NULL,
+				status          TEXT NOT NULL,
+				attempts        INTEGER NOT NULL,
+				last_error      TEXT NOT NULL,
+				next_attempt_at TIMESTAMP NOT NULL,
+				created_at      TIMESTAMP NOT NULL,
+				sent_at         TIMESTAMP
+			);
+CREATE TABLE identities (
+				provider   TEXT NOT NULL,
+				subject    TEXT NOT NULL,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (provider, subject)
+			);
+CREATE TABLE api_keys (
+				id           TEXT PRIMARY KEY,
+				user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				name         TEXT NOT NULL,
+				prefix       TEXT NOT NULL,
+				token_hash   TEXT NOT NULL UNIQUE,
+				scopes       TEXT NOT NULL,
+				created_at   TIMESTAMP NOT NULL,
+				expires_at   TIMESTAMP,
+				last_used_at TIMESTAMP
+			);
+CREATE TABLE IF NOT EXISTS "comments" (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+			chapter_id INTEGER,
+			user_id    INTEGER REFERENCES users (id) ON DELETE SET NULL,
+			body       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+INSERT INTO comments VALUES(1,1,1,1,'First!','2026-10-16 15:42:21.948132553+00:00');
+INSERT INTO comments VALUES(2,1,NULL,2,'Hello','2026-10-16 15:42:22.119138219+00:00');
+INSERT INTO sqlite_sequence VALUES('comments',2);
+INSERT INTO sqlite_sequence VALUES('users',2);
+INSERT INTO sqlite_sequence VALUES('novels',1);
+INSERT INTO sqlite_sequence VALUES('chapters',2);
+CREATE UNIQUE INDEX users_email ON users (email_norm);
+CREATE INDEX novels_author_id ON novels (author_id);
+CREATE INDEX novels_updated_at ON novels (updated_at);
+CREATE INDEX chapters_novel_id ON chapters (novel_id, position);
+CREATE INDEX bookmarks_novel_id ON bookmarks (novel_id);
+CREATE INDEX sessions_user_id ON sessions (user_id);
+CREATE INDEX sessions_expires_at ON sessions (expires_at);
+CREATE INDEX refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE INDEX user_tokens_user_id ON user_tokens (user_id, purpose);
+CREATE INDEX outbox_due ON outbox (status, next_attempt_at);
+CREATE INDEX identities_user_id ON identities (user_id);
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
+CREATE INDEX comments_novel_id ON comments (novel_id, created_at);
+CREATE INDEX comments_user_id ON comments (user_id);
+COMMIT;
+PRAGMA user_version = 12;
@@ -0,0 +1,148 @@
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE users (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				username      TEXT NOT NULL,
+				username_norm TEXT NOT NULL UNIQUE,
+				email         TEXT NOT NULL,
+				email_norm    TEXT NOT NULL,
+				password_salt TEXT NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL
+			, email_verified_at TIMESTAMP, totp_secret TEXT NOT NULL DEFAULT '', totp_pending TEXT NOT NULL DEFAULT '', totp_last_step INTEGER NOT NULL DEFAULT 0, recovery_codes TEXT NOT NULL DEFAULT '', role TEXT NOT NULL DEFAULT 'author', failed_logins INTEGER NOT NULL DEFAULT 0, last_failed_login TIMESTAMP, locked_until TIMESTAMP, display_name TEXT NOT NULL DEFAULT '', bio TEXT NOT NULL DEFAULT '', avatar_url TEXT NOT NULL DEFAULT '');
+INSERT INTO users VALUES(1,'ada','ada','ada@example.com','ada@example.com','','$argon2id$v=19$m=65536,t=3,p=2$5GSIWOlyAYryiiQjzlRPfg$uSnvBvpY/0PULXJQoVlceI4ixBYRcw1+0Qw/tH4YOfM','2026-10-16 15:42:24.877203702+00:00',NULL,'','',0,'','author',0,NULL,NULL,'','','');
+INSERT INTO users VALUES(2,'bo','bo','bo@example.com','bo@example.com','','$argon2id$v=19$m=65536,t=3,p=2$OXo0TpjWk2Q32QMdqULNlw$+vPTT194bQZl1pd9LAWqBTWOjWlhZ291WmVEsRsFEgc','2026-10-16 15:42:25.02301191+00:00',NULL,'','',0,'','author',0,NULL,NULL,'','','');
+CREATE TABLE novels (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				author_id   INTEGER NOT NULL REFERENCES users (id),
+				title       TEXT NOT NULL,
+				description TEXT NOT NULL,
+				genre       TEXT NOT NULL,
+				status      TEXT NOT NULL,
+				created_at  TIMESTAMP NOT NULL,
+				updated_at  TIMESTAMP NOT NULL
+			);
+INSERT INTO novels VALUES(1,1,'Novel','About it','drama','published','2026-10-16 15:42:24.877976644+00:00','2026-10-16 15:42:25.024318835+00:00');
+CREATE TABLE chapters (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				title      TEXT NOT NULL,
+				content    TEXT NOT NULL,
+				position   INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			);
+INSERT INTO chapters VALUES(1,1,'One','First chapter, revised.',1,'2026-10-16 15:42:24.87823531+00:00','2026-10-16 15:42:25.024318835+00:00');
+INSERT INTO chapters VALUES(2,1,'Two','Second chapter.',2,'2026-10-16 15:42:25.023922697+00:00','2026-10-16 15:42:25.023922697+00:00');
+CREATE TABLE bookmarks (
+				user_id     INTEGER NOT NULL REFERENCES users (id),
+				novel_id    INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id  INTEGER,
+				chapter_pos INTEGER,
+				updated_at  TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, novel_id)
+			);
+INSERT INTO bookmarks VALUES(2,1,1,1,'2026-10-16 15:42:25.024952417+00:00');
+CREATE TABLE sessions (
+			id           TEXT PRIMARY KEY,
+			user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			token_hash   TEXT NOT NULL UNIQUE,
+			device       TEXT NOT NULL,
+			user_agent   TEXT NOT NULL,
+			created_at   TIMESTAMP NOT NULL,
+			last_seen_at TIMESTAMP NOT NULL,
+			expires_at   TIMESTAMP NOT NULL
+		, access_expires_at TIMESTAMP NOT NULL DEFAULT '');
+INSERT INTO sessions VALUES('00e20f24b6de37b6',1,'8faab70a7bf5faa1350d8fe880f3338cea3f27151ae86a7de3809819d8f984e1','','','2026-10-16 15:42:24.877471469+00:00','2026-10-16 15:42:24.877471469+00:00','2026-11-15 15:42:24.877471469+00:00','2026-10-16 15:57:24.877471469+00:00');
+INSERT INTO sessions VALUES('082de19d1f1b6531',2,'b9ba81e68145aac47211980e994f452274dcb3439b5b11451fedfb9cec797b80','','','2026-10-16 15:42:25.023299766+00:00','2026-10-16 15:42:25.023299766+00:00','2026-11-15 15:42:25.023299766+00:00','2026-10-16 15:57:25.023299766+00:00');
+CREATE TABLE refresh_tokens (
+				token_hash TEXT PRIMARY KEY,
+				session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL,
+				used_at    TIMESTAMP
+			);
+INSERT INTO refresh_tokens VALUES('7cd109163ef1efedcdd2b3e1a191be7cde047984ea121ebfe6d07b9c4bc8c3b1','00e20f24b6de37b6','2026-10-16 15:42:24.877471469+00:00',NULL);
+INSERT INTO refresh_tokens VALUES('4210c9720c7775dcc356a8871d702d9fb9a27c5454fb47b10126a849238a0813','082de19d1f1b6531','2026-10-16 15:42:25.023299766+00:00',NULL);
+CREATE TABLE user_tokens (
+				token_hash TEXT PRIMARY KEY,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				purpose    TEXT NOT NULL,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL
+			, attempts INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE outbox (
+				id              INTEGER PRIMARY KEY AUTOINCREMENT,
+				recipient       TEXT NOT NULL,
+				subject         TEXT NOT NULL,
+				body            TEXT NOT NULL,
+				status          TEXT NOT NULL,
+				attempts        INTEGER NOT NULL,
+				last_error      TEXT NOT NULL,
+				next_attempt_at TIMESTAMP NOT NULL,
+				created_at      TIMESTAMP NOT NULL,
+				sent_at         TIMESTAMP
+			);
+CREATE TABLE identities (
+				provider   TEXT NOT NULL,
+				subject    TEXT NOT NULL,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (provider, subject)
+			);
+CREATE TABLE api_keys (
+				id           TEXT PRIMARY KEY,
+				user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				name         TEXT NOT NULL,
+				prefix       TEXT NOT NULL,
+				token_hash   TEXT NOT NULL UNIQUE,
+				scopes       TEXT NOT NULL,
+				created_at   TIMESTAMP NOT NULL,
+				expires_at   TIMESTAMP,
+				last_used_at TIMESTAMP
+			);
+CREATE TABLE IF NOT EXISTS "comments" (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+			chapter_id INTEGER,
+			user_id    INTEGER REFERENCES users (id) ON DELETE SET NULL,
+			body       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+INSERT INTO comments VALUES(1,1,1,1,'First!','2026-10-16 15:42:24.878862159+00:00');
+INSERT INTO comments VALUES(2,1,NULL,2,'Hello','2026-10-16 15:42:25.024620603+00:00');
+CREATE TABLE chapter_revisions (
+				chapter_id    INTEGER NOT NULL REFERENCES chapters (id) ON DELETE CASCADE,
+				number        INTEGER NOT NULL,
+				author_id     INTEGER REFERENCES users (id) ON DELETE SET NULL,
+				content       TEXT NOT NULL,
+				words         INTEGER NOT NULL,
+				restored_from INTEGER,
+				created_at    TIMESTAMP NOT NULL,
+				PRIMARY KEY (chapter_id, number)
+			);
+INSERT INTO chapter_revisions VALUES(1,1,1,'First chapter.',2,NULL,'2026-10-16 15:42:24.87823531+00:00');
+INSERT INTO chapter_revisions VALUES(2,1,1,'Second chapter.',2,NULL,'2026-10-16 15:42:25.023922697+00:00');
+INSERT INTO chapter_revisions VALUES(1,2,1,'First chapter, revised.',3,NULL,'2026-10-16 15:42:25.024318835+00:00');
+INSERT INTO sqlite_sequence VALUES('comments',2);
+INSERT INTO sqlite_sequence VALUES('users',2);
+INSERT INTO sqlite_sequence VALUES('novels',1);
+INSERT INTO sqlite_sequence VALUES('chapters',2);
+CREATE UNIQUE INDEX users_email ON users (email_norm);
+CREATE INDEX novels_author_id ON novels (author_id);
+CREATE INDEX novels_updated_at ON novels (updated_at);
+CREATE INDEX chapters_novel_id ON chapters (novel_id, position);
+CREATE INDEX bookmarks_novel_id ON bookmarks (novel_id);
+CREATE INDEX sessions_user_id ON sessions (user_id);
+CREATE INDEX sessions_expires_at ON sessions (expires_at);
+CREATE INDEX refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE INDEX user_tokens_user_id ON user_tokens (user_id, purpose);
+CREATE INDEX outbox_due ON outbox (status, next_attempt_at);
+CREATE INDEX identities_user_id ON identities (user_id);
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
+CREATE INDEX comments_novel_id ON comments (novel_id, created_at);
+CREATE INDEX comments_user_id ON comments (user_id);
+CREATE INDEX chapter_revisions_author_id ON chapter_revisions (author_id);
+COMMIT;
+PRAGMA user_version = 13;
@@ -0,0 +1,150 @@
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE users (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				username      TEXT NOT NULL,
+				username_norm TEXT NOT NULL UNIQUE,
+				email         TEXT NOT NULL,
+				email_norm    TEXT NOT NULL,
+				password_salt TEXT NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL
+			, email_verified_at TIMESTAMP, totp_secret TEXT NOT NULL DEFAULT '', totp_pending TEXT NOT NULL DEFAULT '', totp_last_step INTEGER NOT NULL DEFAULT 0, recovery_codes TEXT NOT NULL DEFAULT '', role TEXT NOT NULL DEFAULT 'author', failed_logins INTEGER NOT NULL DEFAULT 0, last_failed_login TIMESTAMP, locked_until TIMESTAMP, display_name TEXT NOT NULL DEFAULT '', bio TEXT NOT NULL DEFAULT '', avatar_url TEXT NOT NULL DEFAULT '');
+INSERT INTO users VALUES(1,'ada','ada','ada@example.com','ada@example.com','','$argon2id$v=19$m=65536,t=3,p=2$XVSGxxZ0vollGaSs+GMMUg$uKV1fDzX9dH5gRmcGOBKtap3zvk2RL0EBsc+36cU6SE','2026-10-16 15:42:29.886333176+00:00',NULL,'','',0,'','author',0,NULL,NULL,'','','');
+INSERT INTO users VALUES(2,'bo','bo','bo@example.com','bo@example.com','','$argon2id$v=19$m=65536,t=3,p=2$G6bZpwXkyL5sW+20ztnnQw$XdHb1tT7G7YMUaP4HiP1YI5sBrB5383yGRmYZPIINoQ','2026-10-16 15:42:30.031573812+00:00',NULL,'','',0,'','author',0,NULL,NULL,'','','');
+CREATE TABLE novels (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				author_id   INTEGER NOT NULL REFERENCES users (id),
+				title       TEXT NOT NULL,
+				description TEXT NOT NULL,
+				genre       TEXT NOT NULL,
+				status      TEXT NOT NULL,
+				created_at  TIMESTAMP NOT NULL,
+				updated_at  TIMESTAMP NOT NULL
+			, publish_at TIMESTAMP);
+INSERT INTO novels VALUES(1,1,'Novel','About it','drama','published','2026-10-16 15:42:29.887102481+00:00','2026-10-16 15:42:30.032900912+00:00',NULL);
+CREATE TABLE chapters (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				title      TEXT NOT NULL,
+				content    TEXT NOT NULL,
+				position   INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			, publish_at TIMESTAMP, status TEXT NOT NULL DEFAULT 'published');
+INSERT INTO chapters VALUES(1,1,'One','First chapter, revised.',1,'2026-10-16 15:42:29.887371041+00:00','2026-10-16 15:42:30.032900912+00:00',NULL,'published');
+INSERT INTO chapters VALUES(2,1,'Two','Second chapter.',2,'2026-10-16 15:42:30.032384625+00:00','2026-10-16 15:42:30.032384625+00:00','2099-01-01 00:00:00+00:00','draft');
+CREATE TABLE bookmarks (
+				user_id     INTEGER NOT NULL REFERENCES users (id),
+				novel_id    INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id  INTEGER,
+				chapter_pos INTEGER,
+				updated_at  TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, novel_id)
+			);
+INSERT INTO bookmarks VALUES(2,1,1,1,'2026-10-16 15:42:30.033650115+00:00');
+CREATE TABLE sessions (
+			id           TEXT PRIMARY KEY,
+			user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			token_hash   TEXT NOT NULL UNIQUE,
+			device       TEXT NOT NULL,
+			user_agent   TEXT NOT NULL,
+			created_at   TIMESTAMP NOT NULL,
+			last_seen_at TIMESTAMP NOT NULL,
+			expires_at   TIMESTAMP NOT NULL
+		, access_expires_at TIMESTAMP NOT NULL DEFAULT '');
+INSERT INTO sessions VALUES('e3b60074299c3378',1,'4b8af38da6188fb744e78532ca3e8f6a5dbf9af06c0623960f8258d6b8e74a7e','','','2026-10-16 15:42:29.886604689+00:00','2026-10-16 15:42:29.886604689+00:00','2026-11-15 15:42:29.886604689+00:00','2026-10-16 15:57:29.886604689+00:00');
+INSERT INTO sessions VALUES('d7af611c9c4ca3d7',2,'8f756b444cfeeb76c8f6a815f4f65c510e075c517c013af6e0211883cedd2dee','','','2026-10-16 15:42:30.031839261+00:00','2026-10-16 15:42:30.031839261+00:00','2026-11-15 15:42:30.031839261+00:00','2026-10-16 15:57:30.031839261+00:00');
+CREATE TABLE refresh_tokens (
+				token_hash TEXT PRIMARY KEY,
+				session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL,
+				used_at    TIMESTAMP
+			);
+INSERT INTO refresh_tokens VALUES('78974aa43994144feff119d1a4d13d549d0e591f6abf713bc28a06599ec5717b','e3b60074299c3378','2026-10-16 15:42:29.886604689+00:00',NULL);
+INSERT INTO refresh_tokens VALUES('e672454b110ac1c376482c75dd810010ec330474fb4de2ef84f1fe0dd23c4240','d7af611c9c4ca3d7','2026-10-16 15:42:30.031839261+00:00',NULL);
+CREATE TABLE user_tokens (
+				token_hash TEXT PRIMARY KEY,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				purpose    TEXT NOT NULL,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL
+			, attempts INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE outbox (
+				id              INTEGER PRIMARY KEY AUTOINCREMENT,
+				recipient       TEXT NOT NULL,
+				subject         TEXT NOT NULL,
+				body            TEXT NOT NULL,
+				status          TEXT NOT NULL,
+				attempts        INTEGER NOT NULL,
+				last_error      TEXT NOT NULL,
+				next_attempt_at TIMESTAMP NOT NULL,
+				created_at      TIMESTAMP NOT NULL,
+				sent_at         TIMESTAMP
+			);
+CREATE TABLE identities (
+				provider   TEXT NOT NULL,
+				subject    TEXT NOT NULL,
+				user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				email      TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (provider, subject)
+			);
+CREATE TABLE api_keys (
+				id           TEXT PRIMARY KEY,
+				user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				name         TEXT NOT NULL,
+				prefix       TEXT NOT NULL,
+				token_hash   TEXT NOT NULL UNIQUE,
+				scopes       TEXT NOT NULL,
+				created_at   TIMESTAMP NOT NULL,
+				expires_at   TIMESTAMP,
+				last_used_at TIMESTAMP
+			);
+CREATE TABLE IF NOT EXISTS "comments" (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+			chapter_id INTEGER,
+			user_id    INTEGER REFERENCES users (id) ON DELETE SET NULL,
+			body       TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+INSERT INTO comments VALUES(1,1,1,1,'First!','2026-10-16 15:42:29.887817491+00:00');
+INSERT INTO comments VALUES(2,1,NULL,2,'Hello','2026-10-16 15:42:30.033378828+00:00');
+CREATE TABLE chapter_revisions (
+				chapter_id    INTEGER NOT NULL REFERENCES chapters (id) ON DELETE CASCADE,
+				number        INTEGER NOT NULL,
+				author_id     INTEGER REFERENCES users (id) ON DELETE SET NULL,
+				content       TEXT NOT NULL,
+				words         INTEGER NOT NULL,
+				restored_from INTEGER,
+				created_at    TIMESTAMP NOT NULL,
+				PRIMARY KEY (chapter_id, number)
+			);
+INSERT INTO chapter_revisions VALUES(1,1,1,'First chapter.',2,NULL,'2026-10-16 15:42:29.887371041+00:00');
+INSERT INTO chapter_revisions VALUES(2,1,1,'Second chapter.',2,NULL,'2026-10-16 15:42:30.032384625+00:00');
+INSERT INTO chapter_revisions VALUES(1,2,1,'First chapter, revised.',3,NULL,'2026-10-16 15:42:30.032900912+00:00');
+INSERT INTO sqlite_sequence VALUES('comments',2);
+INSERT INTO sqlite_sequence VALUES('users',2);
+INSERT INTO sqlite_sequence VALUES('novels',1);
+INSERT INTO sqlite_sequence VALUES('chapters',2);
+CREATE UNIQUE INDEX users_email ON users (email_norm);
+CREATE INDEX novels_author_id ON novels (author_id);
+CREATE INDEX novels_updated_at ON novels (updated_at);
+CREATE INDEX chapters_novel_id ON chapters (novel_id, position);
+CREATE INDEX bookmarks_novel_id ON bookmarks (novel_id);
+CREATE INDEX sessions_user_id ON sessions (user_id);
+CREATE INDEX sessions_expires_at ON sessions (expires_at);
+CREATE INDEX refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE INDEX user_tokens_user_id ON user_tokens (user_id, purpose);
+CREATE INDEX outbox_due ON outbox (status, next_attempt_at);
+CREATE INDEX identities_user_id ON identities (user_id);
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
+CREATE INDEX comments_novel_id ON comments (novel_id, created_at);
+CREATE INDEX comments_user_id ON comments (user_id);
+CREATE INDEX chapter_revisions_author_id ON chapter_revisions (author_id);
+CREATE INDEX novels_publish_at ON novels (publish_at) WHERE publish_at IS NOT NULL;
+CREATE INDEX chapters_publish_at ON chapters (publish_at) WHERE publish_at IS NOT NULL;
+COMMIT;
+PRAGMA user_version = 15;
@@ -0,0 +1,74 @@
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE users (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				username      TEXT NOT NULL,
+				username_norm TEXT NOT NULL UNIQUE,
+				email         TEXT NOT NULL,
+				email_norm    TEXT NOT NULL,
+				password_salt TEXT NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL
+			);
+INSERT INTO users VALUES(1,'ada','ada','ada@example.com','ada@example.com','','$argon2id$v=19$m=65536,t=3,p=2$60OfUW/3DKLOycAvGWbAYg$LLhdC4YM5oy3NrpMBO+3Diix2FILZ8Z9qC8HZRWgnDA','2026-10-16 15:42:00.557919167+00:00');
+INSERT INTO users VALUES(2,'bo','bo','bo@example.com','bo@example.com','','$argon2id$v=19$m=65536,t=3,p=2$BGdHPcuPbEKJZFIH8YwaoQ$FlDosuBDcBdCcP4gfvudo+GfoYd/Ixh9eFyiPsVaTQ4','2026-10-16 15:42:00.701224637+00:00');
+CREATE TABLE sessions (
+				token_hash   TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE
+			);
+INSERT INTO sessions VALUES('6f65ae799281a4c508e8b025b3a52d790441cca932682c200da32342eb7d6042',1);
+INSERT INTO sessions VALUES('ddef26124d77383d9120fce8e5d4a3fd37b35aba65bfc540d82af3b0565d8ff1',2);
+CREATE TABLE novels (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				author_id   INTEGER NOT NULL REFERENCES users (id),
+				title       TEXT NOT NULL,
+				description TEXT NOT NULL,
+				genre       TEXT NOT NULL,
+				status      TEXT NOT NULL,
+				created_at  TIMESTAMP NOT NULL,
+				updated_at  TIMESTAMP NOT NULL
+			);
+INSERT INTO novels VALUES(1,1,'Novel','About it','drama','published','2026-10-16 15:42:00.55877799+00:00','2026-10-16 15:42:00.70239641+00:00');
+CREATE TABLE chapters (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				title      TEXT NOT NULL,
+				content    TEXT NOT NULL,
+				position   INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			);
+INSERT INTO chapters VALUES(1,1,'One','First chapter, revised.',1,'2026-10-16 15:42:00.55910898+00:00','2026-10-16 15:42:00.70239641+00:00');
+INSERT INTO chapters VALUES(2,1,'Two','Second chapter.',2,'2026-10-16 15:42:00.702051513+00:00','2026-10-16 15:42:00.702051513+00:00');
+CREATE TABLE comments (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				novel_id   INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id INTEGER,
+				user_id    INTEGER NOT NULL REFERENCES users (id),
+				body       TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);
+INSERT INTO comments VALUES(1,1,1,1,'First!','2026-10-16 15:42:00.559448412+00:00');
+INSERT INTO comments VALUES(2,1,NULL,2,'Hello','2026-10-16 15:42:00.702584443+00:00');
+CREATE TABLE bookmarks (
+				user_id     INTEGER NOT NULL REFERENCES users (id),
+				novel_id    INTEGER NOT NULL REFERENCES novels (id) ON DELETE CASCADE,
+				chapter_id  INTEGER,
+				chapter_pos INTEGER,
+				updated_at  TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, novel_id)
+			);
+INSERT INTO bookmarks VALUES(2,1,1,1,'2026-10-16 15:42:00.702810974+00:00');
+INSERT INTO sqlite_sequence VALUES('users',2);
+INSERT INTO sqlite_sequence VALUES('novels',1);
+INSERT INTO sqlite_sequence VALUES('chapters',2);
+INSERT INTO sqlite_sequence VALUES('comments',2);
+CREATE UNIQUE INDEX users_email ON users (email_norm);
+CREATE INDEX sessions_user_id ON sessions (user_id);
+CREATE INDEX novels_author_id ON novels (author_id);
+CREATE INDEX novels_updated_at ON novels (updated_at);
+CREATE INDEX chapters_novel_id ON chapters (novel_id, position);
+CREATE INDEX comments_novel_id ON comments (novel_id, created_at);
+CREATE INDEX bookmarks_novel_id ON bookmarks (novel_id);
+COMMIT;
+PRAGMA user_version = 2;
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"novella/internal/model"
+	"novella/internal/totp"
+)
+
+const (
+	totpIssuer           = "Novella"
+	challengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+var ErrTwoFactorRequired = errors.New("two-factor authentication required")
+
+// Challenge is returned as the error of Login when the user has two-factor
+// authentication enabled. No session is opened until Token is passed to
+// CompleteLogin together with a code.
+type Challenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+func (c *Challenge) Error() string { return ErrTwoFactorRequired.Error() }
+
+func (c *Challenge) Unwrap() error { return ErrTwoFactorRequired }
+
+// TwoFactorSetup is what an authenticator app needs to enroll; URL is the
+// otpauth:// URI usually shown as a QR code.
+type TwoFactorSetup struct {
+	Secret string
+	URL    string
+}
+
+func newTwoFactorSetup(user model.User) (TwoFactorSetup, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+	return TwoFactorSetup{Secret: secret, URL: totp.URL(totpIssuer, user.Email, secret)}, nil
+}
+
+// enableTwoFactor confirms the pending secret with code and returns the new
+// recovery codes.
+func enableTwoFactor(user *model.User, code string, now time.Time) ([]string, error) {
+	if user.TwoFactorEnabled {
+		return nil, ErrConflict
+	}
+	if user.TOTPPending == "" {
+		return nil, errors.New("two-factor setup has not been started")
+	}
+	step, ok := totp.Validate(user.TOTPPending, code, now, 0)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.TwoFactorEnabled = true
+	user.TOTPSecret = user.TOTPPending
+	user.TOTPPending = ""
+	user.TOTPLastStep = step
+	user.RecoveryCodes = hashes
+	return codes, nil
+}
+
+func disableTwoFactor(user *model.User) {
+	user.TwoFactorEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPPending = ""
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+}
+
+// checkSecondFactor accepts a current TOTP code or an unused recovery code,
+// and updates user so that neither can be used again.
+func checkSecondFactor(user *model.User, code string, now time.Time) bool {
+	if !user.TwoFactorEnabled {
+		return false
+	}
+	if step, ok := totp.Validate(user.TOTPSecret, code, now, user.TOTPLastStep); ok {
+		user.TOTPLastStep = step
+		return true
+	}
+	hash := hashToken(normalizeRecoveryCode(code))
+	if i := slices.Index(user.RecoveryCodes, hash); i >= 0 {
+		user.RecoveryCodes = slices.Delete(slices.Clone(user.RecoveryCodes), i, i+1)
+		return true
+	}
+	return false
+}
+
+// Recovery codes are 10 hex digits shown as xxxxx-xxxxx; only their digests
+// are stored.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		raw, err := randomHex(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
@@ -0,0 +1,587 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"novella/internal/model"
+)
+
+var (
+	errJournalClosed = errors.New("store: journal is closed")
+	errJournalGap    = errors.New("journal gap")
+)
+
+const (
+	kindUser     = "user"
+	kindSession  = "session"
+	kindRefresh  = "refresh_token"
+	kindToken    = "user_token"
+	kindMail     = "mail"
+	kindIdentity = "identity"
+	kindAPIKey   = "api_key"
+	kindNovel    = "novel"
+	kindChapter  = "chapter"
+	kindRevision = "revision"
+	kindComment  = "comment"
+	kindBookmark = "bookmark"
+)
+
+// walEntry is one line of the journal. Every mutating Store method commits
+// exactly one entry, so an entry is the unit of atomicity on replay.
+type walEntry struct {
+	Seq     uint64  `json:"seq"`
+	Version int     `json:"v,omitempty"`
+	Ops     []walOp `json:"ops"`
+}
+
+type walOp struct {
+	Kind  string          `json:"kind"`
+	Key   string          `json:"key"`
+	Del   bool            `json:"del,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+
+	value any
+}
+
+type userRecord struct {
+	model.User
+	PasswordSalt  string   `json:"password_salt"`
+	PasswordHash  string   `json:"password_hash"`
+	TOTPSecret    string   `json:"totp_secret,omitempty"`
+	TOTPPending   string   `json:"totp_pending,omitempty"`
+	TOTPLastStep  int64    `json:"totp_last_step,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+
+	FailedLogins    int        `json:"failed_logins,omitempty"`
+	LastFailedLogin *time.Time `json:"last_failed_login,omitempty"`
+}
+
+func newUserRecord(u model.User) userRecord {
+	return userRecord{
+		User:          u,
+		PasswordSalt:  u.PasswordSalt,
+		PasswordHash:  u.PasswordHash,
+		TOTPSecret:    u.TOTPSecret,
+		TOTPPending:   u.TOTPPending,
+		TOTPLastStep:  u.TOTPLastStep,
+		RecoveryCodes: u.RecoveryCodes,
+
+		FailedLogins:    u.FailedLogins,
+		LastFailedLogin: u.LastFailedLogin,
+	}
+}
+
+func (r userRecord) user() model.User {
+	u := r.User
+	u.PasswordSalt = r.PasswordSalt
+	u.PasswordHash = r.PasswordHash
+	u.TOTPSecret = r.TOTPSecret
+	u.TOTPPending = r.TOTPPending
+	u.TOTPLastStep = r.TOTPLastStep
+	u.RecoveryCodes = r.RecoveryCodes
+	u.FailedLogins = r.FailedLogins
+	u.LastFailedLogin = r.LastFailedLogin
+	return u
+}
+
+type sessionRecord struct {
+	model.Session
+	TokenHash string `json:"token_hash"`
+}
+
+func newSessionRecord(sess model.Session) sessionRecord {
+	return sessionRecord{Session: sess, TokenHash: sess.TokenHash}
+}
+
+func (r sessionRecord) session() model.Session {
+	sess := r.Session
+	sess.TokenHash = r.TokenHash
+	return sess
+}
+
+type apiKeyRecord struct {
+	model.APIKey
+	TokenHash string `json:"token_hash"`
+}
+
+func newAPIKeyRecord(k model.APIKey) apiKeyRecord {
+	return apiKeyRecord{APIKey: k, TokenHash: k.TokenHash}
+}
+
+func (r apiKeyRecord) apiKey() model.APIKey {
+	k := r.APIKey
+	k.TokenHash = r.TokenHash
+	return k
+}
+
+func idKey(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func putUser(u model.User) walOp {
+	return walOp{Kind: kindUser, Key: idKey(u.ID), value: newUserRecord(u)}
+}
+
+func delUser(id int64) walOp {
+	return walOp{Kind: kindUser, Key: idKey(id), Del: true}
+}
+
+func putSession(sess model.Session) walOp {
+	return walOp{Kind: kindSession, Key: sess.ID, value: newSessionRecord(sess)}
+}
+
+func delSession(id string) walOp {
+	return walOp{Kind: kindSession, Key: id, Del: true}
+}
+
+func putRefresh(rt model.RefreshToken) walOp {
+	return walOp{Kind: kindRefresh, Key: rt.TokenHash, value: rt}
+}
+
+func delRefresh(hash string) walOp {
+	return walOp{Kind: kindRefresh, Key: hash, Del: true}
+}
+
+func putUserToken(t model.UserToken) walOp {
+	return walOp{Kind: kindToken, Key: t.TokenHash, value: t}
+}
+
+func delUserToken(hash string) walOp {
+	return walOp{Kind: kindToken, Key: hash, Del: true}
+}
+
+func putMail(m model.OutboxMessage) walOp {
+	return walOp{Kind: kindMail, Key: idKey(m.ID), value: m}
+}
+
+func delMail(id int64) walOp {
+	return walOp{Kind: kindMail, Key: idKey(id), Del: true}
+}
+
+func putIdentity(id model.Identity) walOp {
+	return walOp{Kind: kindIdentity, Key: identityKey(id.Provider, id.Subject), value: id}
+}
+
+func delIdentity(provider, subject string) walOp {
+	return walOp{Kind: kindIdentity, Key: identityKey(provider, subject), Del: true}
+}
+
+func putAPIKey(k model.APIKey) walOp {
+	return walOp{Kind: kindAPIKey, Key: k.ID, value: newAPIKeyRecord(k)}
+}
+
+func delAPIKey(id string) walOp {
+	return walOp{Kind: kindAPIKey, Key: id, Del: true}
+}
+
+func putNovel(n model.Novel) walOp {
+	return walOp{Kind: kindNovel, Key: idKey(n.ID), value: n}
+}
+
+func delNovel(id int64) walOp {
+	return walOp{Kind: kindNovel, Key: idKey(id), Del: true}
+}
+
+func putChapter(ch model.Chapter) walOp {
+	return walOp{Kind: kindChapter, Key: idKey(ch.ID), value: ch}
+}
+
+func delChapter(id int64) walOp {
+	return walOp{Kind: kindChapter, Key: idKey(id), Del: true}
+}
+
+func putRevision(r model.Revision) walOp {
+	return walOp{Kind: kindRevision, Key: revisionKey(r.ChapterID, r.Number), value: r}
+}
+
+func putComment(c model.Comment) walOp {
+	return walOp{Kind: kindComment, Key: idKey(c.ID), value: c}
+}
+
+func delComment(id int64) walOp {
+	return walOp{Kind: kindComment, Key: idKey(id), Del: true}
+}
+
+func putBookmark(b model.Bookmark) walOp {
+	return walOp{Kind: kindBookmark, Key: bookmarkKey(b.UserID, b.NovelID), value: b}
+}
+
+func delBookmark(key string) walOp {
+	return walOp{Kind: kindBookmark, Key: key, Del: true}
+}
+
+// commitLocked appends ops to the journal as a single entry and then applies
+// them to the in-memory maps. Memory is only touched once the entry is on disk.
+func (s *Store) commitLocked(ops ...walOp) error {
+	for i := range ops {
+		if ops[i].Del {
+			continue
+		}
+		data, err := json.Marshal(ops[i].value)
+		if err != nil {
+			return err
+		}
+		ops[i].Value = data
+	}
+
+	if s.dbPath != "" {
+		if s.journal == nil {
+			return errJournalClosed
+		}
+		entry := walEntry{Seq: s.seq + 1, Version: schemaVersion, Ops: ops}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		line, err := s.encodeJournalLine(data)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if err := s.appendJournalLocked(line); err != nil {
+			return err
+		}
+		s.seq = entry.Seq
+	}
+
+	for _, op := range ops {
+		if err := s.applyLocked(op); err != nil {
+			return err
+		}
+	}
+
+	if s.dbPath != "" && s.journalSize >= s.compactThreshold() {
+		if err := s.compactLocked(); err != nil {
+			log.Printf("store: compaction failed, journal keeps growing: %v", err)
+		}
+	}
+	return nil
+}
+
+// appendJournalLocked writes and fsyncs one entry. On failure the file is
+// cut back to the last complete entry so a short write (e.g. a full disk)
+// cannot leave garbage in front of the next entry.
+func (s *Store) appendJournalLocked(line []byte) error {
+	_, err := s.journal.Write(line)
+	if err == nil {
+		err = s.journal.Sync()
+	}
+	if err != nil {
+		if terr := s.journal.Truncate(s.journalSize); terr != nil {
+			return fmt.Errorf("%w (truncating journal: %v)", err, terr)
+		}
+		return err
+	}
+	s.journalSize += int64(len(line))
+	return nil
+}
+
+func (s *Store) applyLocked(op walOp) error {
+	var id int64
+	if op.Kind != kindSession && op.Kind != kindRefresh && op.Kind != kindToken && op.Kind != kindIdentity && op.Kind != kindAPIKey && op.Kind != kindBookmark &&
+		op.Kind != kindRevision {
+		var err error
+		id, err = strconv.ParseInt(op.Key, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s key %q", op.Kind, op.Key)
+		}
+	}
+
+	switch op.Kind {
+	case kindUser:
+		if old, ok := s.usersByID[id]; ok {
+			delete(s.usersByEmail, normalize(old.Email))
+			delete(s.usersByUsername, normalize(old.Username))
+			delete(s.usersByID, id)
+		}
+		if op.Del {
+			return nil
+		}
+		var r userRecord
+		if err := json.Unmarshal(op.Value, &r); err != nil {
+			return err
+		}
+		s.indexUserLocked(r.user())
+	case kindSession:
+		if old, ok := s.sessionsByID[op.Key]; ok {
+			delete(s.sessionsByToken, old.TokenHash)
+			delete(s.sessionsByID, op.Key)
+		}
+		if op.Del {
+			for _, hash := range s.refreshBySession[op.Key] {
+				delete(s.refreshTokens, hash)
+			}
+			delete(s.refreshBySession, op.Key)
+			return nil
+		}
+		var r sessionRecord
+		if err := json.Unmarshal(op.Value, &r); err != nil {
+			return err
+		}
+		s.indexSessionLocked(r.session())
+	case kindRefresh:
+		if op.Del {
+			if rt, ok := s.refreshTokens[op.Key]; ok {
+				s.refreshBySession[rt.SessionID] = slices.DeleteFunc(s.refreshBySession[rt.SessionID], func(hash string) bool { return hash == op.Key })
+				delete(s.refreshTokens, op.Key)
+			}
+			return nil
+		}
+		var rt model.RefreshToken
+		if err := json.Unmarshal(op.Value, &rt); err != nil {
+			return err
+		}
+		rt.TokenHash = op.Key
+		s.indexRefreshLocked(rt)
+	case kindToken:
+		if op.Del {
+			delete(s.userTokens, op.Key)
+			return nil
+		}
+		var t model.UserToken
+		if err := json.Unmarshal(op.Value, &t); err != nil {
+			return err
+		}
+		t.TokenHash = op.Key
+		s.userTokens[op.Key] = t
+	case kindIdentity:
+		if op.Del {
+			delete(s.identities, op.Key)
+			return nil
+		}
+		var id model.Identity
+		if err := json.Unmarshal(op.Value, &id); err != nil {
+			return err
+		}
+		s.identities[op.Key] = id
+	case kindAPIKey:
+		if old, ok := s.apiKeys[op.Key]; ok {
+			delete(s.apiKeysByToken, old.TokenHash)
+			delete(s.apiKeys, op.Key)
+		}
+		if op.Del {
+			return nil
+		}
+		var r apiKeyRecord
+		if err := json.Unmarshal(op.Value, &r); err != nil {
+			return err
+		}
+		s.indexAPIKeyLocked(r.apiKey())
+	case kindMail:
+		if op.Del {
+			delete(s.outbox, id)
+			return nil
+		}
+		var m model.OutboxMessage
+		if err := json.Unmarshal(op.Value, &m); err != nil {
+			return err
+		}
+		s.outbox[id] = m
+		s.nextMailID = max(s.nextMailID, id)
+	case kindNovel:
+		if op.Del {
+			delete(s.novelsByID, id)
+			return nil
+		}
+		var n model.Novel
+		if err := json.Unmarshal(op.Value, &n); err != nil {
+			return err
+		}
+		s.novelsByID[n.ID] = n
+		s.nextNovelID = max(s.nextNovelID, n.ID)
+	case kindChapter:
+		if op.Del {
+			if ch, ok := s.chaptersByID[id]; ok {
+				s.chapterIDsByNovel[ch.NovelID] = removeID(s.chapterIDsByNovel[ch.NovelID], id)
+				delete(s.chaptersByID, id)
+			}
+			delete(s.revisions, id)
+			return nil
+		}
+		var ch model.Chapter
+		if err := json.Unmarshal(op.Value, &ch); err != nil {
+			return err
+		}
+		if _, ok := s.chaptersByID[ch.ID]; !ok {
+			s.chapterIDsByNovel[ch.NovelID] = append(s.chapterIDsByNovel[ch.NovelID], ch.ID)
+		}
+		s.chaptersByID[ch.ID] = ch
+		s.nextChapterID = max(s.nextChapterID, ch.ID)
+	case kindRevision:
+		var r model.Revision
+		if err := json.Unmarshal(op.Value, &r); err != nil {
+			return err
+		}
+		s.indexRevisionLocked(r)
+	case kindComment:
+		if op.Del {
+			if c, ok := s.commentsByID[id]; ok {
+				s.commentIDsByNovel[c.NovelID] = removeID(s.commentIDsByNovel[c.NovelID], id)
+				delete(s.commentsByID, id)
+			}
+			return nil
+		}
+		var c model.Comment
+		if err := json.Unmarshal(op.Value, &c); err != nil {
+			return err
+		}
+		if _, ok := s.commentsByID[c.ID]; !ok {
+			s.commentIDsByNovel[c.NovelID] = append(s.commentIDsByNovel[c.NovelID], c.ID)
+		}
+		s.commentsByID[c.ID] = c
+		s.nextCommentID = max(s.nextCommentID, c.ID)
+	case kindBookmark:
+		if op.Del {
+			delete(s.bookmarks, op.Key)
+			return nil
+		}
+		var b model.Bookmark
+		if err := json.Unmarshal(op.Value, &b); err != nil {
+			return err
+		}
+		s.bookmarks[op.Key] = b
+	default:
+		return fmt.Errorf("unknown journal record kind %q", op.Kind)
+	}
+	return nil
+}
+
+func (s *Store) indexUserLocked(u model.User) {
+	s.usersByID[u.ID] = u
+	s.usersByEmail[normalize(u.Email)] = u.ID
+	s.usersByUsername[normalize(u.Username)] = u.ID
+	s.nextUserID = max(s.nextUserID, u.ID)
+}
+
+func (s *Store) indexSessionLocked(sess model.Session) {
+	s.sessionsByID[sess.ID] = sess
+	s.sessionsByToken[sess.TokenHash] = sess.ID
+}
+
+func (s *Store) indexAPIKeyLocked(k model.APIKey) {
+	s.apiKeys[k.ID] = k
+	s.apiKeysByToken[k.TokenHash] = k.ID
+}
+
+func (s *Store) indexRefreshLocked(rt model.RefreshToken) {
+	if _, ok := s.refreshTokens[rt.TokenHash]; !ok {
+		s.refreshBySession[rt.SessionID] = append(s.refreshBySession[rt.SessionID], rt.TokenHash)
+	}
+	s.refreshTokens[rt.TokenHash] = rt
+}
+
+// indexRevisionLocked keeps each chapter's revisions in order of number.
+func (s *Store) indexRevisionLocked(r model.Revision) {
+	revs := s.revisions[r.ChapterID]
+	i := sort.Search(len(revs), func(i int) bool { return revs[i].Number >= r.Number })
+	if i < len(revs) && revs[i].Number == r.Number {
+		revs[i] = r
+		return
+	}
+	s.revisions[r.ChapterID] = slices.Insert(revs, i, r)
+}
+
+func removeID(ids []int64, id int64) []int64 {
+	for i := range ids {
+		if ids[i] == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+// replayJournalLocked applies every entry newer than the loaded snapshot and
+// returns the offset of the end of the last complete entry. A torn final line
+// left by a crash mid-append is ignored; corruption anywhere else is an error.
+func (s *Store) replayJournalLocked(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var offset int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		data, err := s.decodeJournalLine(bytes.TrimSpace(line))
+		if errors.Is(err, ErrWrongKey) || errors.Is(err, ErrNoKey) {
+			return offset, err
+		}
+		var entry walEntry
+		if err == nil {
+			err = json.Unmarshal(data, &entry)
+		}
+		if err != nil {
+			if _, peekErr := br.Peek(1); errors.Is(peekErr, io.EOF) {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("corrupt journal entry at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+		if entry.Seq <= s.seq {
+			continue
+		}
+		if entry.Seq != s.seq+1 {
+			return offset, fmt.Errorf("%w: expected entry %d, found %d", errJournalGap, s.seq+1, entry.Seq)
+		}
+		if entry.Version != schemaVersion {
+			if err := migrateEntry(&entry); err != nil {
+				return offset, fmt.Errorf("journal entry %d: %w", entry.Seq, err)
+			}
+			s.migrated = true
+		}
+		for _, op := range entry.Ops {
+			if err := s.applyLocked(op); err != nil {
+				return offset, fmt.Errorf("journal entry %d: %w", entry.Seq, err)
+			}
+		}
+		s.seq = entry.Seq
+	}
+}
+
+func (s *Store) journalPath() string {
+	return s.dbPath + ".wal"
+}
+
+func (s *Store) prevJournalPath() string {
+	return s.journalPath() + ".prev"
+}
+
+func (s *Store) replayJournalFileLocked(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+	return s.replayJournalLocked(f)
+}
+
+// openJournalLocked opens the journal for appending, dropping any torn tail
+// past the last entry replayed by readLocked.
+func (s *Store) openJournalLocked() error {
+	f, err := os.OpenFile(s.journalPath(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(s.journalSize); err != nil {
+		f.Close()
+		return err
+	}
+	s.journal = f
+	return nil
+}